@@ -6,26 +6,40 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	// side-effect 注册 Provider
 	_ "gollm-mini/internal/provider/huggingface"
+	_ "gollm-mini/internal/provider/mock"
 	_ "gollm-mini/internal/provider/ollama"
 	_ "gollm-mini/internal/provider/openai"
+	_ "gollm-mini/internal/provider/replay"
 
+	"gollm-mini/internal/cache"
 	"gollm-mini/internal/cli"
+	"gollm-mini/internal/config"
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/memory"
 	"gollm-mini/internal/server"
+	"gollm-mini/internal/storage"
 	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
 )
 
 func main() {
 	// --------- CLI 参数解析 ---------
-	mode := flag.String("mode", "chat", "运行模式：chat / server / template")
-	provider := flag.String("provider", "ollama", "Provider：ollama / openai / hf ...")
+	mode := flag.String("mode", "chat", "运行模式：chat / server / batch / template / memory / keys")
+	providerName := flag.String("provider", "ollama", "Provider：ollama / openai / hf ...")
 	model := flag.String("model", "llama3", "模型名称：llama3 / gpt-4o-mini ...")
 	stream := flag.Bool("stream", true, "是否实时输出（结构化 JSON 会自动关闭）")
 	schemaPath := flag.String("schema", "", "JSON Schema 文件路径（触发结构化模式）")
 	sessionID := flag.String("sid", "", "对话 Session ID")
+	tenantFlag := flag.String("tenant", "", "租户：会话 / 模板所在的命名空间；keys create 时为 Key 绑定的租户")
+
+	remote := flag.String("remote", "", "远程模式：chat 请求发往该 gollm-mini 服务，如 http://localhost:8080")
+	apiKey := flag.String("api-key", os.Getenv("GOLLM_API_KEY"), "远程模式使用的 API Key，默认 $GOLLM_API_KEY")
 
 	port := flag.String("port", "8080", "server 端口")
 	system := flag.String("system", "", "覆盖 system 指令文本")
@@ -33,12 +47,110 @@ func main() {
 	tplFlag := flag.String("tpl", "", "模板名称")
 	varsFlag := flag.String("vars", "{}", "JSON 格式变量")
 
+	// 生成参数：仅在显式指定时生效，否则沿用模板 / 模型默认
+	temperature := flag.Float64("temperature", 0, "采样温度")
+	maxTokens := flag.Int("max-tokens", 0, "最大生成 token 数")
+	topP := flag.Float64("top-p", 0, "nucleus sampling top_p")
+	stop := flag.String("stop", "", "停止序列，逗号分隔")
+	seed := flag.Int("seed", 0, "随机种子")
+
+	toolsFlag := flag.String("tools", "", "启用的工具，逗号分隔：calculator,current_time")
+	cacheFlag := flag.String("cache", "read-write", "缓存模式：off / read-write / read-only / refresh")
+
+	fallback := flag.String("fallback", "", "备用链，如 \"openai:gpt-4o-mini -> hf\"")
+	fallbackOn := flag.String("fallback-on", "", "触发切换的错误类别：conn_refused,5xx,timeout,context_length（默认全部）")
+	contextStrategy := flag.String("context", "keep-system", "上下文裁剪策略：tail / keep-system / pin-first:N / summary[:pin-first:N]")
+	summarizer := flag.String("summarizer", "", "摘要模型，如 ollama:llama3（summary 策略默认当前模型，会话压缩默认 ollama:llama3）")
+	compact := flag.Bool("compact", false, "立即压缩 -sid 指定的会话后退出")
+	overwrite := flag.Bool("overwrite", false, "memory import 时覆盖已存在的会话")
+	compactEvery := flag.Duration("compact-every", memory.DefaultCompactPolicy.Every, "server 自动压缩会话的扫描间隔，0 关闭")
+	batchIn := flag.String("in", "", "batch 输入 JSONL：每行为模板变量、{\"vars\":{...}} 或 {\"messages\":[...]}，- 为标准输入")
+	batchOut := flag.String("out", "", "batch 输出 JSONL，默认 <in>.out.jsonl；已存在时跳过已成功的行继续执行")
+	concurrency := flag.Int("concurrency", 4, "batch 同时处理的行数")
+	jobWorkers := flag.Int("job-workers", 2, "server 并发执行的异步任务数（POST /jobs）")
+	webhookAllow := flag.String("webhook-allow", "", "允许接收任务 webhook 的内网网段，逗号分隔的 CIDR，如 10.0.0.0/8（默认只允许公网地址）")
+	compactThreshold := flag.Int("compact-threshold", memory.DefaultCompactPolicy.Threshold, "会话超过该 token 数时自动压缩")
+	flag.String("providers", "", "具名 Provider 定义文件（JSON 数组），如 vllm-a / lmstudio")
+	flag.String("catalog", "", "模型目录文件（YAML / JSON）：上下文窗口、价格、能力")
+	storageFlag := flag.String("storage", storage.Bolt, "存储后端：bolt / sqlite / memory")
+	dataDir := flag.String("data-dir", "", "数据目录（缓存 / 会话 / 模板 / 评分记录），默认 $GOLLM_DATA_DIR 或当前目录")
+
+	configFile := flag.String("config", config.DefaultPath, "配置文件（YAML），不存在时忽略；命令行参数优先")
+	profile := flag.String("profile", "", "配置文件中的 profile，默认 $GOLLM_PROFILE 或文件中的 profile 字段")
+
 	timeout := flag.Duration("timeout", 5*time.Minute, "全局超时时间")
 	flag.Parse()
 
+	// 配置文件只填充命令行未显式指定的参数；server 热加载时同样以命令行为准
+	explicit := map[string]string{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = f.Value.String() })
+	reloader, err := config.NewReloader(func() (config.Config, error) {
+		_, required := explicit["config"]
+		c, err := config.Load(*configFile, *profile, required)
+		for name, v := range explicit {
+			c.Override(name, v)
+		}
+		return c, err
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	conf := reloader.Current()
+	for name, v := range conf.Flags() {
+		if _, ok := explicit[name]; !ok {
+			if err := flag.Set(name, v); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: config %s: %v\n", name, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	var genOpts types.GenerateOptions
+	set := map[string]bool{} // 命令行或配置文件指定过的参数
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		switch f.Name {
+		case "temperature":
+			genOpts.Temperature = temperature
+		case "max-tokens":
+			genOpts.MaxTokens = *maxTokens
+		case "top-p":
+			genOpts.TopP = topP
+		case "stop":
+			genOpts.Stop = strings.Split(*stop, ",")
+		case "seed":
+			genOpts.Seed = seed
+		}
+	})
+
+	if err := tenant.Validate(*tenantFlag); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	sid := *sessionID
+	if sid != "" {
+		if sid, err = tenant.Qualify(*tenantFlag, sid); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	// 启动时打开存储，配置或文件错误直接退出
+	if err := openStores(*storageFlag, *dataDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer storage.CloseAll()
+
 	// ---------- 模板管理子命令 ----------
 	if *mode == "template" {
-		store, _ := template.Open("templates.db")
+		store, err := template.Open("templates")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		store = store.In(*tenantFlag)
 		switch flag.Arg(0) {
 		case "add":
 			name := flag.Arg(1)
@@ -61,27 +173,114 @@ func main() {
 		}
 	}
 
+	// ---------- 会话管理子命令 ----------
+	if *mode == "memory" {
+		if err := cli.RunMemory(flag.Args(), *tenantFlag, *overwrite); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// ---------- API Key 管理子命令 ----------
+	if *mode == "keys" {
+		if err := cli.RunKeys(flag.Args(), *tenantFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 结构化模式自动关闭流式
 	if *schemaPath != "" {
 		*stream = false
 	}
 
+	cacheMode, err := cache.ParseMode(*cacheFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	fallbackClasses, err := core.ParseFallbackClasses(splitList(*fallbackOn))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	if *mode == "batch" && !set["timeout"] {
+		ctx, cancel = context.WithCancel(context.Background()) // 批量任务耗时不定，未显式指定时不设超时
+	}
 	defer cancel()
 
+	compactPolicy := memory.DefaultCompactPolicy
+	compactPolicy.Every, compactPolicy.Threshold = *compactEvery, *compactThreshold
+
 	switch *mode {
 	case "chat":
-		err := cli.RunChat(
-			ctx,
-			*provider,
-			*model,
-			*schemaPath,
-			*tplFlag,
-			*varsFlag,
-			*system,
-			*sessionID, // ← 将 session 透传给 RunChat
-			*stream,
-		)
+		if *compact {
+			if err := cli.Compact(ctx, sid, *summarizer, *providerName, *model, compactPolicy); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+		cfg := cli.Config{
+			Provider:  *providerName,
+			Model:     *model,
+			Schema:    *schemaPath,
+			Tpl:       *tplFlag,
+			Vars:      *varsFlag,
+			System:    *system,
+			SessionID: sid, // ← 将 session 透传给 RunChat（已带租户前缀）
+			Stream:    *stream,
+			Options:   genOpts,
+			Cache:     cacheMode,
+			Tools:     splitList(*toolsFlag),
+
+			Fallback:   *fallback,
+			FallbackOn: fallbackClasses,
+			Context:    *contextStrategy,
+			Summarizer: *summarizer,
+		}
+		if *remote != "" {
+			// 会话与租户由服务端解析；未指定的 Provider / 模型使用服务端默认
+			cfg.Remote, cfg.APIKey, cfg.Tenant = *remote, *apiKey, *tenantFlag
+			cfg.SessionID = *sessionID
+			if !set["provider"] {
+				cfg.Provider = ""
+			}
+			if !set["model"] {
+				cfg.Model = ""
+			}
+		}
+		if err := cli.RunChat(ctx, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+	case "batch":
+		err := cli.RunBatch(ctx, cli.BatchConfig{
+			Config: cli.Config{
+				Provider: *providerName,
+				Model:    *model,
+				Schema:   *schemaPath,
+				Tpl:      *tplFlag,
+				System:   *system,
+				Options:  genOpts,
+				Cache:    cacheMode,
+				Tenant:   *tenantFlag,
+
+				Fallback:   *fallback,
+				FallbackOn: fallbackClasses,
+				Context:    *contextStrategy,
+				Summarizer: *summarizer,
+			},
+			In:          *batchIn,
+			Out:         *batchOut,
+			Concurrency: *concurrency,
+		})
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
@@ -89,7 +288,18 @@ func main() {
 
 	case "server":
 		fmt.Println("REST server listening on :" + *port)
-		if err := server.Run(ctx, ":"+*port); err != nil && err != http.ErrServerClosed {
+		err := server.Run(ctx, server.Config{
+			Addr:        ":" + *port,
+			Provider:    *providerName,
+			Model:       *model,
+			APIKeys:     conf.Server.Auth.APIKeys,
+			Reloader:    reloader,
+			JobWorkers:  *jobWorkers,
+			WebhookNets: splitList(*webhookAllow),
+			Compact:     compactPolicy,
+			Summarizer:  *summarizer,
+		})
+		if err != nil && err != http.ErrServerClosed {
 			fmt.Fprintln(os.Stderr, "Error:", err)
 			os.Exit(1)
 		}
@@ -99,3 +309,25 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// openStores 配置存储后端并打开各模块的库
+func openStores(backend, dir string) error {
+	if err := storage.Configure(storage.Config{Backend: backend, Dir: dir}); err != nil {
+		return err
+	}
+	if err := cache.Open(); err != nil {
+		return err
+	}
+	return memory.Open()
+}
+
+// splitList 解析逗号分隔参数，忽略空项
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,343 @@
+// Package apikey 管理服务端 API Key：明文只在创建时返回一次，库中只存 SHA-256。
+// 每个 Key 带权限范围、可选的租户、每日 token / 费用配额与每分钟请求数上限，用量按 UTC 自然日累计。
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+// 权限范围；admin 包含其余全部
+const (
+	ScopeChat          = "chat"           // 调用模型：/chat、/v1、/optimizer、/jobs、会话重新生成等
+	ScopeAdmin         = "admin"          // /admin、/cache、会话删除 / 导入 / 压缩
+	ScopeTemplateWrite = "template-write" // 保存 / 删除模板
+)
+
+// Scopes 全部可用的权限范围
+var Scopes = []string{ScopeChat, ScopeAdmin, ScopeTemplateWrite}
+
+var (
+	ErrNotFound      = errors.New("api key not found")
+	ErrQuotaExceeded = errors.New("daily quota exceeded")
+	ErrRateLimited   = errors.New("rate limit exceeded")
+)
+
+// Key 一个 API Key 的元数据；配额字段为 0 表示不限
+type Key struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Prefix      string    `json:"prefix"` // 明文前几位，便于辨认
+	Hash        string    `json:"hash,omitempty"`
+	Scopes      []string  `json:"scopes"`
+	Tenant      string    `json:"tenant,omitempty"` // 绑定的租户，为空即默认租户；见 BoundTenant
+	DailyTokens int       `json:"daily_tokens"`     // 每日 prompt + completion token 上限
+	DailyCost   float64   `json:"daily_cost"`       // 每日费用上限（USD）
+	RPM         int       `json:"rpm"`              // 每分钟请求数上限
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AnyTenant Key.Tenant 取该值时可用 X-Tenant 选择任意租户
+const AnyTenant = "*"
+
+// BoundTenant Key 固定使用的租户；fixed 为 false 时可用 X-Tenant 选择租户，
+// 仅限未绑定租户的 admin Key 与显式授予 AnyTenant 的 Key
+func (k Key) BoundTenant() (t string, fixed bool) {
+	if k.Tenant == AnyTenant || (k.Tenant == tenant.Default && k.Allows(ScopeAdmin)) {
+		return "", false
+	}
+	return k.Tenant, true
+}
+
+// Allows 是否具备 scope 权限
+func (k Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage 一个 Key 在某一天的累计用量
+type Usage struct {
+	Day              string  `json:"day"`      // UTC 日期 2006-01-02
+	Requests         int     `json:"requests"` // 计量的模型调用次数
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (u Usage) Tokens() int { return u.PromptTokens + u.CompletionTokens }
+
+const dbName = "apikeys"
+
+var (
+	bucketKeys   = []byte("keys")   // id → Key
+	bucketHashes = []byte("hashes") // sha256(secret) → id
+	bucketUsage  = []byte("usage")  // id/day → Usage
+)
+
+var (
+	db    storage.DB
+	dbErr error
+	once  sync.Once
+)
+
+func open() (storage.DB, error) {
+	once.Do(func() {
+		if db, dbErr = storage.Open(dbName); dbErr != nil {
+			return
+		}
+		dbErr = db.Update(func(tx storage.Tx) error {
+			for _, b := range [][]byte{bucketKeys, bucketHashes, bucketUsage} {
+				if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return db, dbErr
+}
+
+// Open 打开 Key 库，启动时调用以尽早暴露错误
+func Open() error {
+	_, err := open()
+	return err
+}
+
+func view(fn func(tx storage.Tx) error) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.View(fn)
+}
+
+func update(fn func(tx storage.Tx) error) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.Update(fn)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func today() string { return time.Now().UTC().Format("2006-01-02") }
+
+func usageKey(id, day string) []byte { return []byte(id + "/" + day) }
+
+// Create 生成新 Key 并保存，返回明文（之后无法再取回）
+func Create(k Key) (string, Key, error) {
+	if len(k.Scopes) == 0 {
+		k.Scopes = []string{ScopeChat}
+	}
+	for _, s := range k.Scopes {
+		if !validScope(s) {
+			return "", Key{}, fmt.Errorf("unknown scope %q (%s)", s, strings.Join(Scopes, " / "))
+		}
+	}
+	if k.Tenant != AnyTenant {
+		if err := tenant.Validate(k.Tenant); err != nil {
+			return "", Key{}, err
+		}
+	}
+	if k.DailyTokens < 0 || k.DailyCost < 0 || k.RPM < 0 {
+		return "", Key{}, errors.New("quota and rpm must be >= 0")
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", Key{}, err
+	}
+	secret := "gk-" + hex.EncodeToString(raw)
+	k.ID = helper.NewID("key-")
+	k.Prefix = secret[:10]
+	k.Hash = hash(secret)
+	k.CreatedAt = time.Now()
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", Key{}, err
+	}
+	err = update(func(tx storage.Tx) error {
+		if err := tx.Bucket(bucketKeys).Put([]byte(k.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketHashes).Put([]byte(k.Hash), []byte(k.ID))
+	})
+	if err != nil {
+		return "", Key{}, err
+	}
+	return secret, k, nil
+}
+
+func validScope(s string) bool {
+	for _, v := range Scopes {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup 按明文查找 Key
+func Lookup(secret string) (Key, error) {
+	var k Key
+	err := view(func(tx storage.Tx) error {
+		id := tx.Bucket(bucketHashes).Get([]byte(hash(secret)))
+		if id == nil {
+			return ErrNotFound
+		}
+		return getKey(tx, string(id), &k)
+	})
+	return k, err
+}
+
+// Get 按 ID 读取 Key
+func Get(id string) (Key, error) {
+	var k Key
+	err := view(func(tx storage.Tx) error { return getKey(tx, id, &k) })
+	return k, err
+}
+
+func getKey(tx storage.Tx, id string, k *Key) error {
+	data := tx.Bucket(bucketKeys).Get([]byte(id))
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, k)
+}
+
+// List 按创建时间列出全部 Key
+func List() ([]Key, error) {
+	var out []Key
+	err := view(func(tx storage.Tx) error {
+		return tx.Bucket(bucketKeys).ForEach(func(_, v []byte) error {
+			var k Key
+			if err := json.Unmarshal(v, &k); err != nil {
+				return err
+			}
+			out = append(out, k)
+			return nil
+		})
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, err
+}
+
+// Count Key 数量；为 0 时服务端只按配置文件中的静态 Key 鉴权
+func Count() (int, error) {
+	n := 0
+	err := view(func(tx storage.Tx) error {
+		n = tx.Bucket(bucketKeys).KeyN()
+		return nil
+	})
+	return n, err
+}
+
+// Delete 吊销 Key 并删除其用量记录
+func Delete(id string) error {
+	err := update(func(tx storage.Tx) error {
+		var k Key
+		if err := getKey(tx, id, &k); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketKeys).Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketHashes).Delete([]byte(k.Hash)); err != nil {
+			return err
+		}
+		ub := tx.Bucket(bucketUsage)
+		var keys [][]byte
+		err := ub.Scan([]byte(id+"/"), func(k, _ []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := ub.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		forgetLimiter(id)
+	}
+	return err
+}
+
+// Today Key 今天（UTC）的用量
+func Today(id string) (Usage, error) {
+	u := Usage{Day: today()}
+	err := view(func(tx storage.Tx) error {
+		if data := tx.Bucket(bucketUsage).Get(usageKey(id, u.Day)); data != nil {
+			return json.Unmarshal(data, &u)
+		}
+		return nil
+	})
+	return u, err
+}
+
+// Record 把一次调用的用量计入今天，返回累计值
+func Record(id string, usage types.Usage, cost float64) (Usage, error) {
+	u := Usage{Day: today()}
+	err := update(func(tx storage.Tx) error {
+		b := tx.Bucket(bucketUsage)
+		if data := b.Get(usageKey(id, u.Day)); data != nil {
+			if err := json.Unmarshal(data, &u); err != nil {
+				return err
+			}
+		}
+		u.Requests++
+		u.PromptTokens += usage.PromptTokens
+		u.CompletionTokens += usage.CompletionTokens
+		u.Cost += cost
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		return b.Put(usageKey(id, u.Day), data)
+	})
+	return u, err
+}
+
+// CheckQuota 今天的用量已达到配额时返回 ErrQuotaExceeded；
+// 配额在调用前检查，最后一次调用可能略微超出
+func CheckQuota(k Key) error {
+	if k.DailyTokens == 0 && k.DailyCost == 0 {
+		return nil
+	}
+	u, err := Today(k.ID)
+	if err != nil {
+		return err
+	}
+	if k.DailyTokens > 0 && u.Tokens() >= k.DailyTokens {
+		return fmt.Errorf("%w: %d/%d tokens", ErrQuotaExceeded, u.Tokens(), k.DailyTokens)
+	}
+	if k.DailyCost > 0 && u.Cost >= k.DailyCost {
+		return fmt.Errorf("%w: $%.4f/$%.4f", ErrQuotaExceeded, u.Cost, k.DailyCost)
+	}
+	return nil
+}
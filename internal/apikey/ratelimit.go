@@ -0,0 +1,42 @@
+package apikey
+
+import (
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+type limiterEntry struct {
+	rpm int
+	l   *rate.Limiter
+}
+
+var (
+	limMu    sync.Mutex
+	limiters = map[string]limiterEntry{}
+)
+
+// Allow 按 Key 的 RPM 限流（令牌桶，容量为 RPM），超出时返回 ErrRateLimited；
+// 计数只在进程内，重启后重新开始
+func Allow(k Key) error {
+	if k.RPM <= 0 {
+		return nil
+	}
+	limMu.Lock()
+	e, ok := limiters[k.ID]
+	if !ok || e.rpm != k.RPM {
+		e = limiterEntry{rpm: k.RPM, l: rate.NewLimiter(rate.Limit(float64(k.RPM)/60), k.RPM)}
+		limiters[k.ID] = e
+	}
+	limMu.Unlock()
+	if !e.l.Allow() {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+func forgetLimiter(id string) {
+	limMu.Lock()
+	defer limMu.Unlock()
+	delete(limiters, id)
+}
@@ -0,0 +1,307 @@
+// Package batch 批量生成：逐行读取 JSONL（模板变量或 messages），以有限并发调用模型，
+// 每完成一行就向输出 JSONL 追加一条结果。重跑同一输出文件时跳过已成功的行，从中断处继续
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/types"
+)
+
+// Row 一行输入：有 messages 时直接使用，否则用 vars 渲染模板；
+// 两者都没有时整行对象即为变量
+type Row struct {
+	ID       string            `json:"id,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	Messages []types.Message   `json:"messages,omitempty"`
+}
+
+// Result 一行输出
+type Result struct {
+	Line      int         `json:"line"` // 输入行号，从 1 计
+	ID        string      `json:"id,omitempty"`
+	Output    string      `json:"output,omitempty"`
+	JSON      any         `json:"json,omitempty"` // 结构化模式
+	Usage     types.Usage `json:"usage"`
+	ServedBy  string      `json:"served_by,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	LatencyMs int64       `json:"latency_ms"`
+}
+
+// Config 批量参数
+type Config struct {
+	Template    *template.Template    // 为空时每行都必须带 messages
+	System      string                // 覆盖模板的 system
+	Schema      string                // JSON Schema 路径，非空即结构化输出
+	Options     types.GenerateOptions // 显式指定的生成参数，优先于模板 options
+	Concurrency int                   // 同时处理的行数，默认 4
+
+	NewLLM   func() (*core.LLM, error)            // 每行新建一个 LLM（缓存模式、fallback 等由调用方设置）
+	Progress func(done, total int)                // 可选：每完成一行回调
+	Usage    func(servedBy string, u types.Usage) // 可选：每次调用的用量，用于计费
+}
+
+// Summary 一次运行的统计；Skipped 为此前已成功、本次跳过的行
+type Summary struct {
+	Total     int         `json:"total"`
+	Skipped   int         `json:"skipped"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Usage     types.Usage `json:"usage"`
+	ElapsedMs int64       `json:"elapsed_ms"`
+}
+
+// Run 处理 in 中的每一行并把结果追加到 outPath。ctx 取消时停止派发，
+// 被中断的行不写结果，下次以同一 outPath 重跑即可续上；失败的行也会重试
+func Run(ctx context.Context, cfg Config, in io.Reader, outPath string) (Summary, error) {
+	start := time.Now()
+	var sum Summary
+	if cfg.NewLLM == nil {
+		return sum, errors.New("batch: NewLLM is required")
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	lines, err := readLines(in)
+	if err != nil {
+		return sum, err
+	}
+	done, err := resume(outPath)
+	if err != nil {
+		return sum, err
+	}
+
+	var todo []int // 待处理的行号
+	for i, l := range lines {
+		if len(bytes.TrimSpace(l)) == 0 {
+			continue
+		}
+		sum.Total++
+		if done[i+1] {
+			sum.Skipped++
+			continue
+		}
+		todo = append(todo, i+1)
+	}
+
+	out, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return sum, err
+	}
+	defer out.Close()
+
+	var (
+		mu       sync.Mutex
+		writeErr error
+		finished = sum.Skipped
+	)
+	record := func(r Result) {
+		data, err := json.Marshal(r)
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			_, err = out.Write(append(data, '\n')) // 整行一次写入，崩溃时最多丢最后一行
+		}
+		if err != nil && writeErr == nil {
+			writeErr = err
+		}
+		if r.Error == "" {
+			sum.Succeeded++
+		} else {
+			sum.Failed++
+		}
+		sum.Usage.PromptTokens += r.Usage.PromptTokens
+		sum.Usage.CompletionTokens += r.Usage.CompletionTokens
+		sum.Usage.TrimmedTokens += r.Usage.TrimmedTokens
+		finished++
+		if cfg.Progress != nil {
+			cfg.Progress(finished, sum.Total)
+		}
+	}
+	if cfg.Progress != nil {
+		cfg.Progress(finished, sum.Total)
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				r := runRow(ctx, cfg, n, lines[n-1])
+				if ctx.Err() != nil && r.Error != "" {
+					continue // 被中断，留给下次
+				}
+				record(r)
+			}
+		}()
+	}
+dispatch:
+	for _, n := range todo {
+		select {
+		case queue <- n:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	sum.ElapsedMs = time.Since(start).Milliseconds()
+	if writeErr != nil {
+		return sum, writeErr
+	}
+	return sum, ctx.Err()
+}
+
+// runRow 渲染并生成一行
+func runRow(ctx context.Context, cfg Config, n int, line []byte) Result {
+	res := Result{Line: n}
+	row, err := ParseRow(line)
+	res.ID = row.ID
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	msgs, opts, err := cfg.prompt(row)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	llm, err := cfg.NewLLM()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	begin := time.Now()
+	if cfg.Schema != "" {
+		var out map[string]interface{}
+		res.Usage, err = llm.StructuredGenerate(ctx, msgs, cfg.Schema, opts, &out)
+		res.JSON = out
+	} else {
+		res.Output, res.Usage, err = llm.Generate(ctx, msgs, opts)
+	}
+	res.LatencyMs = time.Since(begin).Milliseconds()
+	res.ServedBy = res.Usage.ServedBy
+	if cfg.Usage != nil {
+		cfg.Usage(res.ServedBy, res.Usage)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// prompt 组装一行的消息与生成参数
+func (cfg Config) prompt(row Row) ([]types.Message, types.GenerateOptions, error) {
+	if len(row.Messages) > 0 {
+		return row.Messages, cfg.Options, nil
+	}
+	if cfg.Template == nil {
+		return nil, cfg.Options, errors.New("row has no messages and no template is set")
+	}
+	msgs, err := cfg.Template.Render(row.Vars, nil, cfg.System)
+	return msgs, cfg.Options.Merge(cfg.Template.Options), err
+}
+
+// ParseRow 解析一行输入，见 Row；变量中的非字符串值按 JSON 文本传给模板
+func ParseRow(line []byte) (Row, error) {
+	var row Row
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(line, &obj); err != nil {
+		return row, fmt.Errorf("invalid row: %w", err)
+	}
+	if v, ok := obj["id"]; ok {
+		row.ID = text(v)
+	}
+	if v, ok := obj["messages"]; ok {
+		if err := json.Unmarshal(v, &row.Messages); err != nil {
+			return row, fmt.Errorf("invalid messages: %w", err)
+		}
+		return row, nil
+	}
+	vars := obj
+	if v, ok := obj["vars"]; ok {
+		vars = nil // 新 map：不能与整行合并，否则 id / vars 会混进变量
+		if err := json.Unmarshal(v, &vars); err != nil {
+			return row, fmt.Errorf("invalid vars: %w", err)
+		}
+	}
+	row.Vars = make(map[string]string, len(vars))
+	for k, v := range vars {
+		row.Vars[k] = text(v)
+	}
+	return row, nil
+}
+
+func text(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	return strings.TrimSpace(string(v))
+}
+
+func readLines(r io.Reader) ([][]byte, error) {
+	var lines [][]byte
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		lines = append(lines, append([]byte(nil), sc.Bytes()...))
+	}
+	return lines, sc.Err()
+}
+
+// resume 读取已有输出，只保留成功的行（失败与崩溃时写了一半的行会重跑），返回已完成的行号
+func resume(path string) (map[int]bool, error) {
+	done := map[int]bool{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kept bytes.Buffer
+	for _, l := range bytes.Split(data, []byte("\n")) {
+		var r Result
+		if json.Unmarshal(l, &r) != nil || r.Line <= 0 || r.Error != "" || done[r.Line] {
+			continue
+		}
+		done[r.Line] = true
+		kept.Write(l)
+		kept.WriteByte('\n')
+	}
+	if kept.Len() == len(data) {
+		return done, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Write(kept.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return done, os.Rename(tmp.Name(), path)
+}
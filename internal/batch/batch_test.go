@@ -0,0 +1,171 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/provider/mock"
+	"gollm-mini/internal/types"
+)
+
+func TestParseRow(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		want Row
+	}{
+		{
+			"flat vars",
+			`{"id": 7, "topic": "Go", "n": 3}`,
+			Row{ID: "7", Vars: map[string]string{"id": "7", "topic": "Go", "n": "3"}},
+		},
+		{
+			"vars object",
+			`{"id": "a", "vars": {"topic": "Go", "tags": ["x"]}}`,
+			Row{ID: "a", Vars: map[string]string{"topic": "Go", "tags": `["x"]`}},
+		},
+		{
+			"messages",
+			`{"id": "b", "messages": [{"role": "user", "content": "hi"}], "vars": {"topic": "ignored"}}`,
+			Row{ID: "b", Messages: []types.Message{{Role: types.RoleUser, Content: "hi"}}},
+		},
+	}
+	for _, tc := range cases {
+		got, err := ParseRow([]byte(tc.line))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, line := range []string{`not json`, `{"vars": [1]}`, `{"messages": "hi"}`} {
+		if _, err := ParseRow([]byte(line)); err == nil {
+			t.Errorf("%s: want error", line)
+		}
+	}
+}
+
+func newLLM(name string) func() (*core.LLM, error) {
+	return func() (*core.LLM, error) {
+		llm, err := core.New(name, "m")
+		if err != nil {
+			return nil, err
+		}
+		llm.SetCacheMode(cache.ModeOff)
+		llm.SetRetryPolicy(core.RetryPolicy{})
+		return llm, nil
+	}
+}
+
+func readResults(t *testing.T, path string) []Result {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []Result
+	for _, l := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var r Result
+		if err := json.Unmarshal(l, &r); err != nil {
+			t.Fatalf("output line %q: %v", l, err)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// 中断后以同一输出文件重跑：已成功的行跳过，失败、被中断与写了一半的行重跑，每个 id 只留一条结果
+func TestRunResume(t *testing.T) {
+	var in strings.Builder
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		if i == 2 {
+			in.WriteString("\n") // 空行不计数，但占行号
+		}
+		fmt.Fprintf(&in, `{"id": %q, "messages": [{"role": "user", "content": %q}]}`+"\n", id, id)
+	}
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+
+	// 第一次：a 成功、b 失败、c 成功，d 卡住时取消
+	mock.Register("batch-mock-1",
+		mock.Response{Text: "a"},
+		mock.Response{Err: &provider.Error{Kind: provider.KindBadRequest, Err: errors.New("bad b")}},
+		mock.Response{Text: "c"},
+		mock.Response{Latency: time.Hour},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := Config{
+		Concurrency: 1,
+		NewLLM:      newLLM("batch-mock-1"),
+		Progress: func(done, _ int) {
+			if done == 3 {
+				cancel()
+			}
+		},
+	}
+	sum, err := Run(ctx, cfg, strings.NewReader(in.String()), out)
+	if !errors.Is(err, context.Canceled) || sum.Total != 5 || sum.Succeeded != 2 || sum.Failed != 1 {
+		t.Fatalf("first run: %+v, %v", sum, err)
+	}
+
+	// 模拟崩溃：最后一行只写了一半
+	f, err := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"line": 6, "id": "e", "outp`)
+	f.Close()
+
+	// 第二次：回显 Provider，只应收到 b、d、e
+	m := mock.Register("batch-mock-2")
+	cfg = Config{Concurrency: 2, NewLLM: newLLM("batch-mock-2")}
+	sum, err = Run(context.Background(), cfg, strings.NewReader(in.String()), out)
+	if err != nil || sum.Total != 5 || sum.Skipped != 2 || sum.Succeeded != 3 || sum.Failed != 0 {
+		t.Fatalf("resume: %+v, %v", sum, err)
+	}
+	var asked []string
+	for _, req := range m.Requests() {
+		asked = append(asked, req[len(req)-1].Content)
+	}
+	slices.Sort(asked)
+	if !slices.Equal(asked, []string{"b", "d", "e"}) {
+		t.Errorf("resumed rows %q, want b d e", asked)
+	}
+
+	got := map[string]Result{}
+	for _, r := range readResults(t, out) {
+		if _, dup := got[r.ID]; dup {
+			t.Errorf("id %s written twice", r.ID)
+		}
+		got[r.ID] = r
+	}
+	want := map[string]struct {
+		line   int
+		output string
+	}{"a": {1, "a"}, "b": {2, "mock: b"}, "c": {4, "c"}, "d": {5, "mock: d"}, "e": {6, "mock: e"}}
+	for id, w := range want {
+		r, ok := got[id]
+		if !ok || r.Line != w.line || r.Output != w.output || r.Error != "" {
+			t.Errorf("%s: %+v, want line %d output %q", id, r, w.line, w.output)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("%d results, want %d", len(got), len(want))
+	}
+}
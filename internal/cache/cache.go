@@ -1,43 +1,91 @@
 package cache
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tenant"
 	"gollm-mini/internal/types"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	bolt "go.etcd.io/bbolt"
 )
 
 const bucket = "prompt_cache"
 
+// DefaultTTL 每条缓存默认有效期，可由 SetTTL 覆盖
+const DefaultTTL = 24 * time.Hour
+
+var ttl atomic.Int64
+
+// SetTTL 修改缓存有效期，d <= 0 恢复默认；可在运行中调用
+func SetTTL(d time.Duration) { ttl.Store(int64(d)) }
+
+// TTL 当前缓存有效期
+func TTL() time.Duration {
+	if d := time.Duration(ttl.Load()); d > 0 {
+		return d
+	}
+	return DefaultTTL
+}
+
 const (
-	TTL       = 24 * time.Hour // 每条缓存有效期
-	MaxEntry  = 100_000        // 总缓存条数上限
-	EvictSize = 500            // 超限时每次清理数量
+	MaxEntry  = 100_000 // 总缓存条数上限
+	EvictSize = 500     // 超限时每次清理数量
 )
 
 // ---- 单例 DB ----
 var (
-	db   *bolt.DB
-	once sync.Once
+	db    storage.DB
+	dbErr error
+	once  sync.Once
 )
 
-// open 单例
-func openDB() *bolt.DB {
+// openDB 单例，存储名 prompt_cache
+func openDB() (storage.DB, error) {
 	once.Do(func() {
-		db, _ = bolt.Open("prompt_cache.db", 0600, &bolt.Options{Timeout: 1 * time.Second})
-		_ = db.Update(func(tx *bolt.Tx) error {
-			_, _ = tx.CreateBucketIfNotExists([]byte(bucket))
-			return nil
+		if db, dbErr = storage.Open("prompt_cache"); dbErr != nil {
+			return
+		}
+		dbErr = db.Update(func(tx storage.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			return err
 		})
 	})
-	return db
+	return db, dbErr
 }
 
+// Open 打开缓存库，启动时调用以尽早暴露错误
+func Open() error {
+	_, err := openDB()
+	return err
+}
+
+// Mode 单次请求使用缓存的方式
+type Mode string
+
+const (
+	ModeOff       Mode = "off"        // 不读不写
+	ModeReadWrite Mode = "read-write" // 命中直接返回，未命中生成后写入（默认）
+	ModeReadOnly  Mode = "read-only"  // 只读，不写入新结果
+	ModeRefresh   Mode = "refresh"    // 跳过读取，重新生成并覆盖
+)
+
+// ParseMode 解析字符串，空串视为 read-write
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeReadWrite, nil
+	case ModeOff, ModeReadWrite, ModeReadOnly, ModeRefresh:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown cache mode %q (off / read-write / read-only / refresh)", s)
+}
+
+func (m Mode) CanRead() bool  { return m == ModeReadWrite || m == ModeReadOnly }
+func (m Mode) CanWrite() bool { return m == ModeReadWrite || m == ModeRefresh }
+
 // KeyFromMessages 根据 provider+model+messages 生成 SHA256
 func KeyFromMessages(provider, model string, msgs any) string {
 	b, _ := json.Marshal(msgs)
@@ -45,6 +93,14 @@ func KeyFromMessages(provider, model string, msgs any) string {
 	return fmt.Sprintf("%s|%s|%x", provider, model, sum)
 }
 
+// KeyFromRequest 在 messages 之外把生成参数也纳入 key，温度 / stop 不同不会互相命中
+func KeyFromRequest(provider, model string, msgs []types.Message, opts types.GenerateOptions) string {
+	return KeyFromMessages(provider, model, struct {
+		Messages []types.Message       `json:"messages"`
+		Options  types.GenerateOptions `json:"options"`
+	}{msgs, opts})
+}
+
 // Value 保存模型文本+Usage
 type Value struct {
 	Text  string      `json:"text"`
@@ -52,10 +108,13 @@ type Value struct {
 	At    time.Time   `json:"at"`
 }
 
-// Get 查询缓存
+// Get 查询缓存；存储不可用时视为未命中
 func Get(key string) (val Value, ok bool) {
-	db := openDB()
-	_ = db.View(func(tx *bolt.Tx) error {
+	db, err := openDB()
+	if err != nil {
+		return val, false
+	}
+	_ = db.View(func(tx storage.Tx) error {
 		v := tx.Bucket([]byte(bucket)).Get([]byte(key))
 		if v == nil {
 			return nil
@@ -63,7 +122,7 @@ func Get(key string) (val Value, ok bool) {
 		_ = json.Unmarshal(v, &val)
 
 		// TTL 判定
-		if time.Since(val.At) > TTL {
+		if time.Since(val.At) > TTL() {
 			ok = false
 			return nil
 		}
@@ -75,14 +134,18 @@ func Get(key string) (val Value, ok bool) {
 
 // Put 写入缓存
 func Put(key string, val Value) {
-	db := openDB()
-	_ = db.Update(func(tx *bolt.Tx) error {
+	db, err := openDB()
+	if err != nil {
+		return
+	}
+	_ = db.Update(func(tx storage.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 
 		// 检查是否超限
-		stats := b.Stats()
-		if stats.KeyN >= MaxEntry {
-			evictOldest(b)
+		if b.KeyN() >= MaxEntry {
+			if err := evictOldest(b); err != nil {
+				return err
+			}
 		}
 
 		val.At = time.Now()
@@ -91,32 +154,40 @@ func Put(key string, val Value) {
 	})
 }
 
-func evictOldest(b *bolt.Bucket) {
-	c := b.Cursor()
-	count := 0
-	for k, v := c.First(); k != nil && count < EvictSize; k, v = c.Next() {
+// evictOldest 先删过期的，不足 EvictSize 条再按 key 顺序补足
+func evictOldest(b storage.Bucket) error {
+	var expired, rest [][]byte
+	_ = b.ForEach(func(k, v []byte) error {
 		var val Value
-		if err := json.Unmarshal(v, &val); err == nil {
-			// 删除过期 or 最老的
-			if time.Since(val.At) > TTL {
-				_ = b.Delete(k)
-				count++
+		if err := json.Unmarshal(v, &val); err == nil && time.Since(val.At) > TTL() {
+			if len(expired) < EvictSize {
+				expired = append(expired, append([]byte{}, k...))
 			}
+		} else if len(rest) < EvictSize {
+			rest = append(rest, append([]byte{}, k...))
 		}
-	}
+		return nil
+	})
 
-	if count < EvictSize {
-		c := b.Cursor()
-		for k, _ := c.First(); k != nil && count < EvictSize; k, _ = c.Next() {
-			_ = b.Delete(k)
-			count++
+	victims := append(expired, rest...)
+	if len(victims) > EvictSize {
+		victims = victims[:EvictSize]
+	}
+	for _, k := range victims {
+		if err := b.Delete(k); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
+// ClearAll 清空全部租户的缓存
 func ClearAll() error {
-	db := openDB()
-	return db.Update(func(tx *bolt.Tx) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx storage.Tx) error {
 		_ = tx.DeleteBucket([]byte(bucket))
 		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
 		return err
@@ -124,21 +195,66 @@ func ClearAll() error {
 }
 
 func DeleteKey(key string) error {
-	db := openDB()
-	return db.Update(func(tx *bolt.Tx) error {
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx storage.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 		return b.Delete([]byte(key))
 	})
 }
 
+// DeletePrefix 删除 prefix 开头的 key；只删除与 prefix 同一租户的条目，
+// 默认租户的空前缀不会波及 "@<tenant>/" 开头的租户缓存
 func DeletePrefix(prefix string) error {
-	db := openDB()
-	return db.Update(func(tx *bolt.Tx) error {
+	_, err := deletePrefix(prefix)
+	return err
+}
+
+// DeleteTenant 删除租户 t 的全部缓存，返回删除条数
+func DeleteTenant(t string) (int, error) { return deletePrefix(tenant.Prefix(t)) }
+
+func deletePrefix(prefix string) (int, error) {
+	db, err := openDB()
+	if err != nil {
+		return 0, err
+	}
+	owner, _ := tenant.Split(prefix)
+	var n int
+	err = db.Update(func(tx storage.Tx) error {
 		b := tx.Bucket([]byte(bucket))
-		c := b.Cursor()
-		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
-			_ = b.Delete(k)
+		var keys [][]byte
+		_ = b.Scan([]byte(prefix), func(k, _ []byte) error {
+			if t, _ := tenant.Split(string(k)); t == owner {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
 		}
+		n = len(keys)
 		return nil
 	})
+	return n, err
+}
+
+// Tenants 各租户（含默认租户）的缓存条数
+func Tenants() (map[string]int, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int{}
+	err = db.View(func(tx storage.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, _ []byte) error {
+			t, _ := tenant.Split(string(k))
+			out[t]++
+			return nil
+		})
+	})
+	return out, err
 }
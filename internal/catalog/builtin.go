@@ -0,0 +1,40 @@
+package catalog
+
+// 内置条目，可被 -catalog 文件覆盖；价格单位 USD / 1K tokens
+var builtin = []Model{
+	{
+		Provider: "openai", Model: "gpt-4o-mini",
+		ContextWindow: 128000, MaxOutput: 16384,
+		PromptPrice: 0.00015, CompletionPrice: 0.0006,
+		Capabilities: Capabilities{Streaming: true, Tools: true, JSON: true, Vision: true},
+	},
+	{
+		Provider: "openai", Model: "gpt-4o",
+		ContextWindow: 128000, MaxOutput: 16384,
+		PromptPrice: 0.0025, CompletionPrice: 0.01,
+		Capabilities: Capabilities{Streaming: true, Tools: true, JSON: true, Vision: true},
+	},
+	{
+		Provider: "openai", Model: "gpt-3.5-turbo",
+		ContextWindow: 16385, MaxOutput: 4096,
+		PromptPrice: 0.0005, CompletionPrice: 0.0015,
+		Capabilities: Capabilities{Streaming: true, Tools: true, JSON: true},
+	},
+	// 本地 Ollama 视为 0 成本；默认上下文 8K
+	{
+		Provider: "ollama", Model: "*",
+		ContextWindow: 8192,
+		Capabilities:  Capabilities{Streaming: true, Tools: true, JSON: true},
+	},
+	{
+		Provider: "ollama", Model: "llama3",
+		ContextWindow: 8192,
+		Capabilities:  Capabilities{Streaming: true, Tools: true, JSON: true},
+	},
+	// HF 为伪流式，不支持函数调用
+	{
+		Provider: "hf", Model: "*",
+		ContextWindow: 2048, MaxOutput: 1024,
+		Capabilities: Capabilities{Streaming: true},
+	},
+}
@@ -0,0 +1,201 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"gollm-mini/internal/tokenizer"
+)
+
+// Capabilities 模型支持的特性
+type Capabilities struct {
+	Streaming bool `json:"streaming" yaml:"streaming"`
+	Tools     bool `json:"tools" yaml:"tools"`
+	JSON      bool `json:"json" yaml:"json"` // 原生 JSON mode；提示词约束的结构化输出（StructuredGenerate）不要求
+	Vision    bool `json:"vision" yaml:"vision"`
+}
+
+// Model 目录中的一项；Model 为 "*" 时作为该 provider 的默认值
+type Model struct {
+	Provider        string       `json:"provider" yaml:"provider"`
+	Model           string       `json:"model" yaml:"model"`
+	ContextWindow   int          `json:"context_window" yaml:"context_window"`     // 输入 + 输出总 token
+	MaxOutput       int          `json:"max_output" yaml:"max_output"`             // 单次输出上限，0 不限
+	PromptPrice     float64      `json:"prompt_price" yaml:"prompt_price"`         // USD / 1K tokens
+	CompletionPrice float64      `json:"completion_price" yaml:"completion_price"` // USD / 1K tokens
+	Tokenizer       string       `json:"tokenizer,omitempty" yaml:"tokenizer"`     // cl100k_base / o200k_base，空按模型名推断
+	Capabilities    Capabilities `json:"capabilities" yaml:"capabilities"`
+}
+
+// 目录里查不到时使用，与旧的 core.maxCtx 一致
+const DefaultContextWindow = 3000
+
+// Fallback 未登记模型的默认描述：保守窗口，免费，能力全开不做拦截
+func Fallback(provider, model string) Model {
+	return Model{
+		Provider:      provider,
+		Model:         model,
+		ContextWindow: DefaultContextWindow,
+		Capabilities:  Capabilities{Streaming: true, Tools: true, JSON: true, Vision: true},
+	}
+}
+
+// Cost 按单价计算 USD
+func (m Model) Cost(promptTok, compTok int) float64 {
+	return (float64(promptTok)*m.PromptPrice + float64(compTok)*m.CompletionPrice) / 1000
+}
+
+// PromptBudget 截断时留给输入的 token 数：窗口减去输出预留（maxTokens 或 MaxOutput），
+// 预留最多占一半窗口
+func (m Model) PromptBudget(maxTokens int) int {
+	reserve := maxTokens
+	if reserve <= 0 {
+		reserve = m.MaxOutput
+	}
+	if reserve > m.ContextWindow/2 {
+		reserve = m.ContextWindow / 2
+	}
+	return m.ContextWindow - reserve
+}
+
+// Validate 检查请求是否超出模型能力；need 为本次请求用到的特性（携带工具、要求 JSON 输出等）
+func (m Model) Validate(maxTokens int, need Capabilities) error {
+	for _, c := range []struct {
+		need, has bool
+		name      string
+	}{
+		{need.Streaming, m.Capabilities.Streaming, "streaming"},
+		{need.Tools, m.Capabilities.Tools, "tools"},
+		{need.JSON, m.Capabilities.JSON, "JSON output"},
+		{need.Vision, m.Capabilities.Vision, "vision"},
+	} {
+		if c.need && !c.has {
+			return fmt.Errorf("%s:%s does not support %s", m.Provider, m.Model, c.name)
+		}
+	}
+	if m.MaxOutput > 0 && maxTokens > m.MaxOutput {
+		return fmt.Errorf("%s:%s: max_tokens %d exceeds max output %d", m.Provider, m.Model, maxTokens, m.MaxOutput)
+	}
+	if maxTokens >= m.ContextWindow {
+		return fmt.Errorf("%s:%s: max_tokens %d exceeds context window %d", m.Provider, m.Model, maxTokens, m.ContextWindow)
+	}
+	return nil
+}
+
+type key struct{ provider, model string }
+
+var (
+	mu     sync.RWMutex
+	models = map[key]Model{}
+)
+
+func init() { Add(builtin...) }
+
+// Add 登记或覆盖条目
+func Add(list ...Model) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, m := range list {
+		models[key{m.Provider, m.Model}] = m
+		if m.Tokenizer != "" && m.Model != "*" {
+			tokenizer.MapModel(m.Model, m.Tokenizer)
+		}
+	}
+}
+
+// Load 读取 YAML / JSON 目录文件（按扩展名区分），条目覆盖内置值
+func Load(path string) error {
+	list, err := Read(path)
+	if err != nil {
+		return err
+	}
+	Add(list...)
+	return nil
+}
+
+// Read 解析并校验目录文件，不登记
+func Read(path string) ([]Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Model
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &list)
+	default:
+		err = yaml.Unmarshal(data, &list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("catalog %s: %w", path, err)
+	}
+	for i, m := range list {
+		if m.Provider == "" || m.Model == "" {
+			return nil, fmt.Errorf("catalog %s: entry %d: provider and model are required", path, i)
+		}
+		if m.ContextWindow <= 0 {
+			return nil, fmt.Errorf("catalog %s: %s:%s: context_window must be > 0", path, m.Provider, m.Model)
+		}
+	}
+	return list, nil
+}
+
+// Reset 把目录整体替换为内置条目加 list（热加载）
+func Reset(list ...Model) {
+	next := make(map[key]Model, len(builtin)+len(list))
+	for _, m := range append(append([]Model{}, builtin...), list...) {
+		next[key{m.Provider, m.Model}] = m
+		if m.Tokenizer != "" && m.Model != "*" {
+			tokenizer.MapModel(m.Model, m.Tokenizer)
+		}
+	}
+	mu.Lock()
+	models = next
+	mu.Unlock()
+}
+
+// Lookup 先查 provider:model，再查 provider:*
+func Lookup(provider, model string) (Model, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if m, ok := models[key{provider, model}]; ok {
+		return m, true
+	}
+	if m, ok := models[key{provider, "*"}]; ok {
+		m.Model = model
+		return m, true
+	}
+	return Model{}, false
+}
+
+// Get 同 Lookup，查不到时返回 Fallback
+func Get(provider, model string) Model {
+	if m, ok := Lookup(provider, model); ok {
+		return m
+	}
+	return Fallback(provider, model)
+}
+
+// List 按 provider、model 排序返回全部条目
+func List() []Model {
+	mu.RLock()
+	out := make([]Model, 0, len(models))
+	for _, m := range models {
+		out = append(out, m)
+	}
+	mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].Model < out[j].Model
+	})
+	return out
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"gollm-mini/internal/batch"
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
+)
+
+// BatchConfig 批量模式参数；Provider / 模型 / 模板 / schema / 缓存 / fallback 等沿用 Config
+type BatchConfig struct {
+	Config
+	In          string // 输入 JSONL，"-" 为标准输入
+	Out         string // 输出 JSONL，默认 <in>.out.jsonl；已存在时续跑
+	Concurrency int
+}
+
+// RunBatch 批量生成；Ctrl-C 时等待进行中的行结束前退出，重跑同一命令即可继续
+func RunBatch(ctx context.Context, cfg BatchConfig) error {
+	if cfg.In == "" {
+		return errors.New("batch requires -in")
+	}
+	if cfg.Out == "" {
+		if cfg.In == "-" {
+			return errors.New("batch requires -out when reading stdin")
+		}
+		cfg.Out = strings.TrimSuffix(cfg.In, ".jsonl") + ".out.jsonl"
+	}
+	in := os.Stdin
+	if cfg.In != "-" {
+		f, err := os.Open(cfg.In)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var tpl *template.Template
+	if cfg.Tpl != "" {
+		store, err := template.Open("templates")
+		if err != nil {
+			return err
+		}
+		t, err := store.In(cfg.Tenant).Latest(cfg.Tpl)
+		if err != nil {
+			return err
+		}
+		tpl = &t
+	}
+	newLLM := func() (*core.LLM, error) {
+		llm, err := core.New(cfg.Provider, cfg.Model)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Cache != "" {
+			llm.SetCacheMode(cfg.Cache)
+		}
+		llm.SetCacheNamespace(tenant.Prefix(cfg.Tenant))
+		if cfg.Fallback != "" {
+			if err := llm.WithFallback(cfg.Fallback, cfg.FallbackOn); err != nil {
+				return nil, err
+			}
+		}
+		return llm, llm.UseContextStrategy(cfg.Context, cfg.Summarizer)
+	}
+	if _, err := newLLM(); err != nil { // 参数错误时尽早退出
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sum, err := batch.Run(ctx, batch.Config{
+		Template:    tpl,
+		System:      cfg.System,
+		Schema:      cfg.Schema,
+		Options:     cfg.Options,
+		Concurrency: cfg.Concurrency,
+		NewLLM:      newLLM,
+		Progress: func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\r⏳ %d/%d", done, total)
+		},
+	}, in, cfg.Out)
+	fmt.Fprintln(os.Stderr)
+	fmt.Printf("📦 total=%d skipped=%d ok=%d failed=%d | prompt=%d completion=%d | %.1fs → %s\n",
+		sum.Total, sum.Skipped, sum.Succeeded, sum.Failed,
+		sum.Usage.PromptTokens, sum.Usage.CompletionTokens, float64(sum.ElapsedMs)/1000, cfg.Out)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted, rerun the same command to resume: %w", err)
+		}
+		return err
+	}
+	if sum.Failed > 0 {
+		fmt.Println("ℹ️ 失败的行会在下次运行时重试")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/memory"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+const commandHelp = `/regen              重新生成上一条回答
+/edit <n> <text>    修改第 n 条消息（见 /history）并从此继续
+/undo               撤销最后一轮
+/fork [sid]         复制当前会话到新 sid 并切换过去
+/history            显示当前分支
+/checkout <node>    切换到以 node 结尾的分支（见 /tree）
+/tree               显示全部分支`
+
+// commandResult 分支命令的效果：history 非 nil 时替换本地历史，
+// input 非空时以它作为本轮 user 消息继续生成，回答经 turn.Save 写入会话
+type commandResult struct {
+	history []types.Message
+	input   string
+	session string
+	turn    memory.Turn
+}
+
+// runCommand 处理聊天中的 / 命令，均需 -sid
+func runCommand(sid, line string) (commandResult, error) {
+	fields := strings.Fields(line)
+	cmd := fields[0]
+	if cmd == "/help" {
+		fmt.Println(commandHelp)
+		return commandResult{}, nil
+	}
+	if sid == "" {
+		return commandResult{}, fmt.Errorf("%s requires -sid", cmd)
+	}
+
+	switch cmd {
+	case "/regen":
+		turn, err := memory.Regenerate(sid)
+		if err != nil {
+			return commandResult{}, err
+		}
+		return continueFrom(turn), nil
+
+	case "/edit":
+		if len(fields) < 3 {
+			return commandResult{}, errors.New("usage: /edit <n> <text>")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return commandResult{}, fmt.Errorf("invalid message index %q", fields[1])
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(line, cmd)), fields[1]))
+		turn, err := memory.Edit(sid, n, text)
+		if err != nil {
+			return commandResult{}, err
+		}
+		if path := turn.Messages; path[len(path)-1].Role != types.RoleUser {
+			fmt.Println("✏️  已修改")
+			return commandResult{history: path}, nil
+		}
+		return continueFrom(turn), nil
+
+	case "/undo":
+		path, err := memory.Undo(sid)
+		if err != nil {
+			return commandResult{}, err
+		}
+		fmt.Println("↩️  已撤销最后一轮")
+		return commandResult{history: path}, nil
+
+	case "/fork":
+		newID := helper.NewID("sess-")
+		if len(fields) > 1 {
+			newID = fields[1]
+		}
+		t, _ := tenant.Split(sid) // 新会话与原会话同属一个租户
+		qid, err := tenant.Qualify(t, newID)
+		if err != nil {
+			return commandResult{}, err
+		}
+		if err := memory.Fork(sid, qid); err != nil {
+			return commandResult{}, err
+		}
+		fmt.Printf("🌿 已复制到会话 %s\n", newID)
+		return commandResult{session: qid}, nil
+
+	case "/history":
+		s, err := memory.Get(sid)
+		if err != nil {
+			return commandResult{}, err
+		}
+		for i, m := range s.Messages {
+			fmt.Printf("[%d] %s: %s\n", i, m.Role, m.Content)
+		}
+		return commandResult{}, nil
+
+	case "/checkout":
+		if len(fields) < 2 {
+			return commandResult{}, errors.New("usage: /checkout <node>")
+		}
+		node, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return commandResult{}, fmt.Errorf("invalid node %q", fields[1])
+		}
+		path, err := memory.Checkout(sid, node)
+		if err != nil {
+			return commandResult{}, err
+		}
+		return commandResult{history: path}, nil
+
+	case "/tree":
+		t, err := memory.GetTree(sid)
+		if err != nil {
+			return commandResult{}, err
+		}
+		printTree(t)
+		return commandResult{}, nil
+	}
+	return commandResult{}, fmt.Errorf("unknown command %s (try /help)", cmd)
+}
+
+// continueFrom 上文以 user 消息结尾：其余为历史，最后一条作为本轮输入
+func continueFrom(turn memory.Turn) commandResult {
+	path := turn.Messages
+	last := path[len(path)-1]
+	return commandResult{history: path[:len(path)-1], input: last.Content, turn: turn}
+}
+
+// withSystem 会话中不保存 CLI 的 system 指令，切换分支后补回
+func withSystem(history []types.Message, sys types.Message) []types.Message {
+	if len(history) > 0 && history[0].Role == types.RoleSystem {
+		return history
+	}
+	return append([]types.Message{sys}, history...)
+}
+
+func printTree(t memory.Tree) {
+	active := map[int]bool{}
+	for _, id := range t.Path() {
+		active[id] = true
+	}
+	var walk func(parent, depth int)
+	walk = func(parent, depth int) {
+		for _, id := range t.Children(parent) {
+			n := t.Nodes[id]
+			mark := " "
+			if active[id] {
+				mark = "*"
+			}
+			content := []rune(strings.ReplaceAll(n.Message.Content, "\n", " "))
+			if len(content) > 60 {
+				content = append(content[:60], '…')
+			}
+			fmt.Printf("%s %s#%d %s: %s\n", mark, strings.Repeat("  ", depth), id, n.Message.Role, string(content))
+			walk(id, depth+1)
+		}
+	}
+	walk(-1, 0)
+}
@@ -8,20 +8,44 @@ import (
 	"os"
 	"strings"
 
+	"gollm-mini/internal/cache"
 	"gollm-mini/internal/core"
-	"gollm-mini/internal/helper"
 	"gollm-mini/internal/memory"
 	"gollm-mini/internal/template"
 	"gollm-mini/internal/types"
 )
 
-const defaultCtx = 3000 // fallback
+// Config 交互式对话的全部参数（由命令行解析而来）
+type Config struct {
+	Provider  string
+	Model     string
+	Schema    string // JSON Schema 路径，非空即结构化模式
+	Tpl       string
+	Vars      string // JSON 格式模板变量
+	System    string // 覆盖 system 指令
+	SessionID string
+	Stream    bool
+	Options   types.GenerateOptions
+	Cache     cache.Mode
+	Tools     []string // 启用的工具名
+
+	Fallback   string               // 如 "openai:gpt-4o-mini -> hf"
+	FallbackOn []core.FallbackClass // 为空时全部类别
+
+	Context    string // 上下文裁剪策略，见 window.Parse
+	Summarizer string // summary 策略使用的 "provider:model"，空为当前模型
+
+	Remote string // 非空时作为远程客户端，请求该地址的 /chat
+	APIKey string // 远程模式的 API Key
+	Tenant string // 远程模式的 X-Tenant；batch 模式下为模板与缓存的命名空间
+}
 
 // RunChat 交互式 CLI
-func RunChat(ctx context.Context,
-	provider, model, schema, tplName, varJSON, sysOverride, sessionID string,
-	stream bool,
-) error {
+func RunChat(ctx context.Context, cfg Config) error {
+	if cfg.Remote != "" {
+		return runRemote(ctx, cfg)
+	}
+	opts := cfg.Options
 
 	// ---------- 1. 载入模板 ----------
 	var (
@@ -29,48 +53,59 @@ func RunChat(ctx context.Context,
 		tplLoaded bool
 		vars      map[string]string
 	)
-	if tplName != "" {
-		store, err := template.Open("templates.db")
+	if cfg.Tpl != "" {
+		store, err := template.Open("templates")
 		if err != nil {
 			return err
 		}
-		if tpl, err = store.Latest(tplName); err != nil {
+		if tpl, err = store.Latest(cfg.Tpl); err != nil {
 			return err
 		}
 		tplLoaded = true
-		_ = json.Unmarshal([]byte(varJSON), &vars)
+		opts = opts.Merge(tpl.Options)
+		_ = json.Unmarshal([]byte(cfg.Vars), &vars)
 		if vars == nil {
 			vars = make(map[string]string)
 		}
 	}
 
 	// ---------- 2. 创建 LLM ----------
-	llm, err := core.New(provider, model)
+	llm, err := core.New(cfg.Provider, cfg.Model)
 	if err != nil {
 		return err
 	}
+	if cfg.Cache != "" {
+		llm.SetCacheMode(cfg.Cache)
+	}
+	if cfg.Fallback != "" {
+		if err := llm.WithFallback(cfg.Fallback, cfg.FallbackOn); err != nil {
+			return err
+		}
+	}
+	if err := llm.UseContextStrategy(cfg.Context, cfg.Summarizer); err != nil {
+		return err
+	}
 
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("🔹 gollm-mini | 交互模式，exit 退出")
+	fmt.Println("🔹 gollm-mini | 交互模式，exit 退出，/help 查看分支命令")
 
 	// ---------- 3. 初始化对话历史 ----------
 	var history []types.Message
-	if sessionID != "" {
-		if hist, e := memory.Load(sessionID); e == nil {
+	if cfg.SessionID != "" {
+		if hist, e := memory.Load(cfg.SessionID); e == nil {
 			history = hist
 		}
 	}
 
-	if len(history) == 0 { // 插入 System
-		sys := sysOverride
-		if sys == "" {
-			sys = template.DefaultSystem
-		}
-		history = []types.Message{{Role: types.RoleSystem, Content: sys}}
+	sys := cfg.System
+	if sys == "" {
+		sys = template.DefaultSystem
 	}
+	sysMsg := types.Message{Role: types.RoleSystem, Content: sys}
+	history = withSystem(history, sysMsg) // 插入 System
 
-	// context token limit
-	ctxLimit := defaultCtx
+	// context token limit：模板未指定时取模型目录中的输入预算
+	ctxLimit := llm.Spec().PromptBudget(opts.MaxTokens)
 	if tplLoaded && tpl.MaxLen > 0 {
 		ctxLimit = tpl.MaxLen
 	}
@@ -84,11 +119,46 @@ func RunChat(ctx context.Context,
 			return nil
 		}
 
+		// ----- 4.0 分支命令：/regen /edit /undo /fork /history /checkout -----
+		var turn *memory.Turn // 分支命令准备的一轮，回答由它写入会话
+		if strings.HasPrefix(userInput, "/") {
+			res, err := runCommand(cfg.SessionID, userInput)
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
+			}
+			if res.session != "" {
+				cfg.SessionID = res.session
+			}
+			if res.history != nil {
+				history = withSystem(res.history, sysMsg)
+			}
+			if res.input == "" {
+				continue
+			}
+			userInput, turn = res.input, &res.turn
+		}
+
+		// remember 记录本轮问答到本地历史与会话
+		remember := func(ans string) {
+			userMsg := types.Message{Role: types.RoleUser, Content: userInput}
+			assistantMsg := types.Message{Role: types.RoleAssistant, Content: ans}
+			history = append(history, userMsg, assistantMsg)
+			if cfg.SessionID == "" {
+				return
+			}
+			if turn != nil {
+				_ = turn.Save(ans)
+				return
+			}
+			_ = memory.Append(cfg.SessionID, []types.Message{userMsg, assistantMsg})
+		}
+
 		// ----- 4.1 组装 prompt -----
 		var messages []types.Message
 		if tplLoaded {
 			vars["input"] = userInput
-			msgs, err := tpl.Render(vars, history, sysOverride)
+			msgs, err := tpl.Render(vars, history, cfg.System)
 			if err != nil {
 				fmt.Println("Render Err:", err)
 				continue
@@ -101,32 +171,51 @@ func RunChat(ctx context.Context,
 		}
 
 		// 4.1.1 截断
-		messages = helper.TruncateMessages(messages, ctxLimit)
+		fit, err := llm.FitContext(ctx, messages, ctxLimit)
+		if err != nil {
+			fmt.Println("Error：上下文裁剪失败:", err)
+			continue
+		}
+		messages = fit.Messages
+		if fit.Trimmed > 0 {
+			fmt.Printf("✂️  裁剪 %d 条消息 / %d tokens\n", len(fit.Dropped), fit.Trimmed)
+		}
 
 		// ----- 4.2 结构化输出 -----
-		if schema != "" {
+		if cfg.Schema != "" {
 			var result map[string]interface{}
-			if _, err := llm.StructuredGenerate(ctx, messages, schema, &result); err != nil {
+			if _, err := llm.StructuredGenerate(ctx, messages, cfg.Schema, opts, &result); err != nil {
 				fmt.Println("Error：结构化失败:", err)
 				continue
 			}
 			pretty, _ := json.MarshalIndent(result, "", "  ")
 			fmt.Println("🤖 JSON:\n", string(pretty))
 
-			userMsg := types.Message{Role: types.RoleUser, Content: userInput}
-			assistantMsg := types.Message{Role: types.RoleAssistant, Content: string(pretty)}
-			history = append(history, userMsg, assistantMsg)
+			remember(string(pretty))
+			continue
+		}
 
-			if sessionID != "" {
-				_ = memory.Append(sessionID, []types.Message{userMsg, assistantMsg})
+		// ----- 4.3 工具调用 -----
+		if len(cfg.Tools) > 0 {
+			ans, steps, _, err := llm.RunTools(ctx, messages, cfg.Tools, opts)
+			for _, st := range steps {
+				for _, tc := range st.ToolCalls {
+					fmt.Printf("🔧 %s(%s)\n", tc.Name, tc.Arguments)
+				}
+			}
+			if err != nil {
+				fmt.Println("Error:", err)
+				continue
 			}
+			fmt.Println("🤖:", ans)
+			remember(ans)
 			continue
 		}
 
-		// ----- 4.3 普通问答 -----
-		if stream {
+		// ----- 4.4 普通问答 -----
+		if cfg.Stream {
 			var buf strings.Builder
-			if _, err := llm.Stream(ctx, messages, func(ch types.Chunk) {
+			if _, err := llm.Stream(ctx, messages, opts, func(ch types.Chunk) {
 				fmt.Print(ch.Content)
 				buf.WriteString(ch.Content)
 			}); err != nil {
@@ -134,27 +223,15 @@ func RunChat(ctx context.Context,
 				continue
 			}
 			ans := buf.String()
-			userMsg := types.Message{Role: types.RoleUser, Content: userInput}
-			assistantMsg := types.Message{Role: types.RoleAssistant, Content: ans}
-			history = append(history, userMsg, assistantMsg)
-
-			if sessionID != "" {
-				_ = memory.Append(sessionID, []types.Message{userMsg, assistantMsg})
-			}
+			remember(ans)
 		} else {
-			ans, _, err := llm.Generate(ctx, messages)
+			ans, _, err := llm.Generate(ctx, messages, opts)
 			if err != nil {
 				fmt.Println("Error:", err)
 				continue
 			}
 			fmt.Println("🤖:", ans)
-			userMsg := types.Message{Role: types.RoleUser, Content: userInput}
-			assistantMsg := types.Message{Role: types.RoleAssistant, Content: ans}
-			history = append(history, userMsg, assistantMsg)
-
-			if sessionID != "" {
-				_ = memory.Append(sessionID, []types.Message{userMsg, assistantMsg})
-			}
+			remember(ans)
 		}
 	}
 }
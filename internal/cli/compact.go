@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/memory"
+)
+
+// Compact 立即压缩会话；summarizer 为空时用 provider:model 本身写摘要
+func Compact(ctx context.Context, sid, summarizer, provider, model string, p memory.CompactPolicy) error {
+	if sid == "" {
+		return errors.New("-compact requires -sid")
+	}
+	if summarizer == "" {
+		summarizer = provider + ":" + model
+	}
+	sum, err := core.NewSummarizer(summarizer)
+	if err != nil {
+		return err
+	}
+	res, err := memory.Compact(ctx, sid, p, sum, true)
+	if err != nil {
+		return err
+	}
+	if !res.Compacted {
+		fmt.Printf("会话 %s 无需压缩（%d tokens）\n", sid, res.TokensBefore)
+		return nil
+	}
+	fmt.Printf("🗜️  会话 %s：%d → %d tokens，归档 %d 条消息\n", sid, res.TokensBefore, res.TokensAfter, res.Archived)
+	return nil
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gollm-mini/internal/apikey"
+	"gollm-mini/internal/tenant"
+)
+
+// RunKeys API Key 管理子命令；create 时 Key 绑定到租户 t（为空即默认租户，admin Key 不绑定），
+// -any-tenant 允许用 X-Tenant 选择任意租户：
+//
+//	list | create [-scopes chat,admin] [-any-tenant] [-daily-tokens N] [-daily-cost USD] [-rpm N] <name> | delete <id>
+func RunKeys(args []string, t string) error {
+	if len(args) == 0 {
+		return errors.New("usage: -mode=keys list|create|delete ...")
+	}
+	switch args[0] {
+	case "list":
+		list, err := apikey.List()
+		if err != nil {
+			return err
+		}
+		for _, k := range list {
+			u, err := apikey.Today(k.ID)
+			if err != nil {
+				return err
+			}
+			bound := apikey.AnyTenant
+			if t, fixed := k.BoundTenant(); fixed {
+				bound = tenant.Name(t)
+			}
+			fmt.Printf("%-28s %-12s %-13s %-10s %-28s tokens %s  cost %s  rpm %s\n",
+				k.ID, k.Name, k.Prefix+"…", bound, strings.Join(k.Scopes, ","),
+				quota(float64(u.Tokens()), float64(k.DailyTokens), "%.0f"),
+				quota(u.Cost, k.DailyCost, "%.4f"),
+				limit(k.RPM))
+		}
+		fmt.Printf("共 %d 个 Key\n", len(list))
+		return nil
+
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ContinueOnError)
+		scopes := fs.String("scopes", apikey.ScopeChat, "权限范围，逗号分隔："+strings.Join(apikey.Scopes, " / "))
+		tokens := fs.Int("daily-tokens", 0, "每日 token 上限，0 不限")
+		cost := fs.Float64("daily-cost", 0, "每日费用上限（USD），0 不限")
+		rpm := fs.Int("rpm", 0, "每分钟请求数上限，0 不限")
+		anyTenant := fs.Bool("any-tenant", false, "允许用 X-Tenant 选择任意租户")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *anyTenant {
+			if t != tenant.Default {
+				return errors.New("-any-tenant cannot be combined with -tenant")
+			}
+			t = apikey.AnyTenant
+		}
+		if fs.NArg() == 0 {
+			return errors.New("usage: -mode=keys create [-scopes ...] [-any-tenant] [-daily-tokens N] [-daily-cost USD] [-rpm N] <name>")
+		}
+		secret, k, err := apikey.Create(apikey.Key{
+			Name: fs.Arg(0), Scopes: splitScopes(*scopes), Tenant: t,
+			DailyTokens: *tokens, DailyCost: *cost, RPM: *rpm,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id:  %s\nkey: %s\n（明文只显示这一次）\n", k.ID, secret)
+		return nil
+
+	case "delete":
+		if len(args) < 2 {
+			return errors.New("usage: -mode=keys delete <id>")
+		}
+		return apikey.Delete(args[1])
+	}
+	return fmt.Errorf("unknown keys command %q", args[0])
+}
+
+func splitScopes(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// quota 显示 已用/上限，上限为 0 时只显示已用
+func quota(used, max float64, format string) string {
+	if max <= 0 {
+		return fmt.Sprintf(format, used)
+	}
+	return fmt.Sprintf(format+"/"+format, used, max)
+}
+
+func limit(n int) string {
+	if n <= 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
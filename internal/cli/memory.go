@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"gollm-mini/internal/memory"
+	"gollm-mini/internal/tenant"
+)
+
+// RunMemory 租户 t 的会话管理子命令：
+//
+//	list [offset] [limit] | get <sid> | export [file] [sid...] | import <file> | delete <sid>
+func RunMemory(args []string, t string, overwrite bool) error {
+	if len(args) == 0 {
+		return errors.New("usage: -mode=memory list|get|export|import|delete ...")
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+
+	switch args[0] {
+	case "list":
+		offset, _ := strconv.Atoi(arg(1))
+		limit, _ := strconv.Atoi(arg(2))
+		if limit <= 0 {
+			limit = 50
+		}
+		list, total, err := memory.List(t, offset, limit)
+		if err != nil {
+			return err
+		}
+		for _, s := range list {
+			updated := "-"
+			if !s.UpdatedAt.IsZero() {
+				updated = s.UpdatedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-24s %5d msgs  %s\n", s.ID, s.Messages, updated)
+		}
+		fmt.Printf("共 %d 个会话\n", total)
+		return nil
+
+	case "get":
+		if arg(1) == "" {
+			return errors.New("usage: -mode=memory get <sid>")
+		}
+		sid, err := tenant.Qualify(t, arg(1))
+		if err != nil {
+			return err
+		}
+		s, err := memory.Get(sid)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+
+	case "export":
+		var w io.Writer = os.Stdout
+		if f := arg(1); f != "" && f != "-" {
+			out, err := os.Create(f)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			w = out
+		}
+		var ids []string
+		if len(args) > 2 {
+			ids = args[2:]
+		}
+		return memory.Export(w, t, ids...)
+
+	case "import":
+		var r io.Reader = os.Stdin
+		if f := arg(1); f != "" && f != "-" {
+			in, err := os.Open(f)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			r = in
+		}
+		res, err := memory.Import(r, t, overwrite)
+		fmt.Printf("导入 %d 个会话，跳过 %d 个已存在的会话\n", res.Imported, res.Skipped)
+		return err
+
+	case "delete":
+		if arg(1) == "" {
+			return errors.New("usage: -mode=memory delete <sid>")
+		}
+		sid, err := tenant.Qualify(t, arg(1))
+		if err != nil {
+			return err
+		}
+		return memory.Delete(sid)
+	}
+	return fmt.Errorf("unknown memory command %q", args[0])
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"gollm-mini/internal/sse"
+	"gollm-mini/internal/types"
+)
+
+// runRemote 作为远程客户端对话：每轮请求 cfg.Remote 的 POST /chat，流式输出按 sse 协议解析。
+// 会话、模板与缓存都在服务端；未指定 -sid 时在本地保留历史，每轮完整发送
+func runRemote(ctx context.Context, cfg Config) error {
+	base := strings.TrimRight(cfg.Remote, "/")
+	var vars map[string]string
+	if cfg.Tpl != "" {
+		_ = json.Unmarshal([]byte(cfg.Vars), &vars)
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+	}
+	var history []types.Message
+	if cfg.System != "" && cfg.SessionID == "" && cfg.Tpl == "" {
+		history = append(history, types.Message{Role: types.RoleSystem, Content: cfg.System})
+	}
+	fallbackOn := make([]string, 0, len(cfg.FallbackOn))
+	for _, c := range cfg.FallbackOn {
+		fallbackOn = append(fallbackOn, string(c))
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("🔹 gollm-mini | 远程模式 %s，exit 退出\n", base)
+	for {
+		fmt.Print("\n👤 > ")
+		userInput, err := reader.ReadString('\n')
+		userInput = strings.TrimSpace(userInput)
+		if userInput == "exit" || (err != nil && userInput == "") {
+			return nil
+		}
+		if strings.HasPrefix(userInput, "/") {
+			fmt.Println("远程模式不支持分支命令，请使用 /memory/{sid}/... 接口")
+			continue
+		}
+
+		req := types.ChatRequest{
+			Provider:        cfg.Provider,
+			Model:           cfg.Model,
+			System:          cfg.System,
+			Schema:          cfg.Schema, // 服务端上的路径
+			Stream:          cfg.Stream && cfg.Schema == "" && len(cfg.Tools) == 0,
+			SessionID:       cfg.SessionID,
+			Cache:           string(cfg.Cache),
+			Tools:           cfg.Tools,
+			Fallback:        cfg.Fallback,
+			FallbackOn:      fallbackOn,
+			Context:         cfg.Context,
+			Summarizer:      cfg.Summarizer,
+			GenerateOptions: cfg.Options,
+		}
+		user := types.Message{Role: types.RoleUser, Content: userInput}
+		if cfg.Tpl != "" {
+			vars["input"] = userInput
+			req.Tpl, req.Vars = cfg.Tpl, vars
+		} else {
+			req.Messages = append(history, user)
+		}
+
+		ans, err := remoteChat(ctx, base, cfg, req)
+		if err != nil {
+			fmt.Println("\nError:", err)
+			continue
+		}
+		if cfg.SessionID == "" && cfg.Tpl == "" {
+			history = append(history, user, types.Message{Role: types.RoleAssistant, Content: ans})
+		}
+	}
+}
+
+// remoteChat 发送一轮请求并打印回答，返回回答文本
+func remoteChat(ctx context.Context, base string, cfg Config, req types.ChatRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/chat", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	hr.Header.Set("Content-Type", "application/json")
+	if cfg.APIKey != "" {
+		hr.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	if cfg.Tenant != "" {
+		hr.Header.Set("X-Tenant", cfg.Tenant)
+	}
+	resp, err := http.DefaultClient.Do(hr)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(raw, &e) == nil && e.Error != "" {
+			return "", fmt.Errorf("%s: %s", resp.Status, e.Error)
+		}
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(raw)))
+	}
+
+	if !req.Stream {
+		var out types.ChatResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return "", err
+		}
+		if out.ErrMsg != "" {
+			return "", errors.New(out.ErrMsg)
+		}
+		text := out.Text
+		if out.JSON != nil {
+			pretty, _ := json.MarshalIndent(out.JSON, "", "  ")
+			text = string(pretty)
+			fmt.Println("🤖 JSON:\n", text)
+		} else {
+			fmt.Println("🤖:", text)
+		}
+		printUsage(sse.FromUsage(out.Usage), out.ServedBy, "")
+		return text, nil
+	}
+
+	if v := resp.Header.Get(sse.Header); v != strconv.Itoa(sse.Version) {
+		return "", fmt.Errorf("unsupported stream protocol %q (want %d)", v, sse.Version)
+	}
+	var (
+		buf       strings.Builder
+		streamErr error
+	)
+	err = sse.Read(resp.Body, func(ev sse.Event) error {
+		switch ev.Name {
+		case sse.EventDelta:
+			var d sse.Delta
+			if err := ev.Decode(&d); err != nil {
+				return err
+			}
+			fmt.Print(d.Content)
+			buf.WriteString(d.Content)
+		case sse.EventError:
+			var e sse.Error
+			if err := ev.Decode(&e); err != nil {
+				return err
+			}
+			streamErr = errors.New(e.Message)
+		case sse.EventDone:
+			var d sse.Done
+			if err := ev.Decode(&d); err != nil {
+				return err
+			}
+			fmt.Println()
+			printUsage(d.Usage, d.ServedBy, d.FinishReason)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), streamErr
+}
+
+func printUsage(u sse.Usage, servedBy, finish string) {
+	parts := []string{fmt.Sprintf("%d + %d tokens", u.PromptTokens, u.CompletionTokens)}
+	if servedBy != "" {
+		parts = append(parts, servedBy)
+	}
+	if finish != "" && finish != sse.FinishStop {
+		parts = append(parts, finish)
+	}
+	fmt.Println("📊", strings.Join(parts, " · "))
+}
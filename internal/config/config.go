@@ -0,0 +1,254 @@
+// Package config 读取 gollm.yaml：顶层为公共配置，profiles 下的同名字段按所选 profile 覆盖。
+// 字符串值支持 ${VAR} 与 ${VAR:-default} 环境变量插值，密钥不必写进文件。
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/catalog"
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/optimizer"
+	"gollm-mini/internal/provider"
+)
+
+// DefaultPath 未指定 -config 时读取的文件，不存在则忽略
+const DefaultPath = "gollm.yaml"
+
+// Config 一个 profile 展开后的完整配置；空字段表示沿用命令行默认值
+type Config struct {
+	Path    string `yaml:"-"` // 配置文件路径（文件可能不存在）
+	Profile string `yaml:"-"` // 实际使用的 profile，空为顶层配置
+
+	Provider   string                   `yaml:"provider"`       // 默认 Provider
+	Model      string                   `yaml:"model"`          // 默认模型
+	Providers  map[string]provider.Spec `yaml:"providers"`      // 具名 Provider 与凭据；key 为名称，type 缺省同名
+	Judge      string                   `yaml:"judge"`          // optimizer 评分模型 "provider:model"
+	Summarizer string                   `yaml:"summarizer"`     // 摘要模型 "provider:model"
+	Catalog    string                   `yaml:"catalog"`        // 模型目录文件
+	SpecsFile  string                   `yaml:"providers_file"` // 具名 Provider 的 JSON 文件（同 -providers）
+
+	RateLimits map[string]core.RateLimit `yaml:"rate_limits"` // 按 Provider 名称限流
+
+	DataDir string `yaml:"data_dir"`
+	Storage string `yaml:"storage"` // bolt / sqlite / memory
+
+	Cache CacheConfig      `yaml:"cache"`
+	Retry core.RetryPolicy `yaml:"retry"`
+
+	Server ServerConfig `yaml:"server"`
+}
+
+type CacheConfig struct {
+	Mode string        `yaml:"mode"` // off / read-write / read-only / refresh
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+type ServerConfig struct {
+	Port string     `yaml:"port"`
+	Auth AuthConfig `yaml:"auth"`
+}
+
+// AuthConfig 服务端鉴权；APIKeys 为空时不鉴权
+type AuthConfig struct {
+	APIKeys []string `yaml:"api_keys"` // 请求头 Authorization: Bearer <key> 或 X-API-Key
+}
+
+// file gollm.yaml 的结构
+type file struct {
+	Profile  string `yaml:"profile"` // 默认 profile
+	Config   `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// Load 读取配置并展开 profile（为空时取 GOLLM_PROFILE，再取文件中的 profile 字段）。
+// required 为 false 时文件不存在返回默认配置。
+func Load(path, profile string, required bool) (Config, error) {
+	def := Config{Retry: core.DefaultRetryPolicy}
+	if path == "" {
+		path = DefaultPath
+	}
+	def.Path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		if profile != "" {
+			return def, fmt.Errorf("profile %q requested but %s not found", profile, path)
+		}
+		return def, nil
+	}
+	if err != nil {
+		return def, err
+	}
+	cfg, err := Parse(data, profile)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// Parse 解析 YAML 内容，见 Load
+func Parse(data []byte, profile string) (Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return Config{}, err
+	}
+	interpolate(&root)
+
+	f := file{Config: Config{Retry: core.DefaultRetryPolicy}}
+	if err := root.Decode(&f); err != nil {
+		return Config{}, err
+	}
+	if profile == "" {
+		profile = os.Getenv("GOLLM_PROFILE")
+	}
+	if profile == "" {
+		profile = f.Profile
+	}
+	cfg := f.Config
+	if profile != "" {
+		node, ok := f.Profiles[profile]
+		if !ok {
+			return Config{}, fmt.Errorf("unknown profile %q (have %v)", profile, profileNames(f.Profiles))
+		}
+		if err := node.Decode(&cfg); err != nil {
+			return Config{}, fmt.Errorf("profile %s: %w", profile, err)
+		}
+		cfg.Profile = profile
+	}
+	for name, s := range cfg.Providers {
+		s.Name = name
+		if s.Type == "" {
+			s.Type = name
+		}
+		cfg.Providers[name] = s
+	}
+	return cfg, nil
+}
+
+// flagFields 命令行参数名 → 对应的配置项
+func (c *Config) flagFields() map[string]*string {
+	return map[string]*string{
+		"provider":   &c.Provider,
+		"model":      &c.Model,
+		"summarizer": &c.Summarizer,
+		"catalog":    &c.Catalog,
+		"providers":  &c.SpecsFile,
+		"data-dir":   &c.DataDir,
+		"storage":    &c.Storage,
+		"cache":      &c.Cache.Mode,
+		"port":       &c.Server.Port,
+	}
+}
+
+// Flags 与命令行参数对应的配置项，key 为参数名；只含非空值
+func (c Config) Flags() map[string]string {
+	out := map[string]string{}
+	for name, p := range c.flagFields() {
+		if *p != "" {
+			out[name] = *p
+		}
+	}
+	return out
+}
+
+// Override 用显式指定的命令行参数覆盖配置；与配置无关的参数忽略
+func (c *Config) Override(flag, value string) {
+	if p, ok := c.flagFields()[flag]; ok {
+		*p = value
+	}
+}
+
+// resolved 校验通过、待生效的外部文件内容
+type resolved struct {
+	specs  []provider.Spec
+	models []catalog.Model
+}
+
+// resolve 读取并校验 Provider 与模型目录文件，不修改任何全局状态
+func (c Config) resolve() (resolved, error) {
+	var r resolved
+	if c.SpecsFile != "" {
+		list, err := provider.ReadSpecs(c.SpecsFile)
+		if err != nil {
+			return r, err
+		}
+		r.specs = list
+	}
+	names := make([]string, 0, len(c.Providers))
+	for name := range c.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.specs = append(r.specs, c.Providers[name])
+	}
+	if c.Catalog != "" {
+		models, err := catalog.Read(c.Catalog)
+		if err != nil {
+			return r, err
+		}
+		r.models = models
+	}
+	return r, nil
+}
+
+// Apply 把配置写入各模块：具名 Provider、模型目录、限流、缓存 TTL、重试策略、评分模型。
+// 先校验全部内容，出错时不做任何修改；可在运行中重复调用
+func (c Config) Apply() error {
+	r, err := c.resolve()
+	if err != nil {
+		return err
+	}
+	return c.commit(r)
+}
+
+func (c Config) commit(r resolved) error {
+	if err := provider.ReplaceSpecs(r.specs); err != nil {
+		return err
+	}
+	catalog.Reset(r.models...)
+	core.SetRateLimits(c.RateLimits)
+	cache.SetTTL(c.Cache.TTL)
+	core.SetDefaultRetryPolicy(c.Retry)
+	optimizer.SetJudge(c.Judge)
+	return nil
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate 替换所有标量中的 ${VAR} / ${VAR:-default}；未设置且无默认值时为空串
+func interpolate(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && envRef.MatchString(n.Value) {
+		n.Value = envRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			m := envRef.FindStringSubmatch(ref)
+			if v, ok := os.LookupEnv(m[1]); ok && v != "" {
+				return v
+			}
+			return m[2]
+		})
+		if n.Style == 0 {
+			n.Tag = "" // 未加引号的值按替换后的内容重新推断类型，如 ${RETRIES:-3}
+		}
+	}
+	for _, c := range n.Content {
+		interpolate(c)
+	}
+}
+
+func profileNames(m map[string]yaml.Node) []string {
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
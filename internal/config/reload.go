@@ -0,0 +1,260 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// Change 重新加载前后不同的一项；密钥只显示摘要
+type Change struct {
+	Key     string `json:"key"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	Restart bool   `json:"restart_required,omitempty"` // 端口、存储等需重启才生效
+}
+
+// 这些配置只在启动时读取
+var restartKeys = []string{"server.port", "data_dir", "storage"}
+
+// Reloader 持有当前配置；Reload 重新读取并在校验通过后整体生效，失败时保持原配置
+type Reloader struct {
+	load func() (Config, error)
+
+	mu    sync.Mutex
+	cur   Config
+	snap  map[string]string
+	hooks []func(Config)
+}
+
+// NewReloader 首次加载并应用配置；load 通常为 Load 加上命令行覆盖
+func NewReloader(load func() (Config, error)) (*Reloader, error) {
+	c, err := load()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.commit(r); err != nil {
+		return nil, err
+	}
+	return &Reloader{load: load, cur: c, snap: snapshot(c, r)}, nil
+}
+
+// Current 当前生效的配置
+func (r *Reloader) Current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cur
+}
+
+// OnReload 注册重新加载成功后的回调（在 Reload 的锁内按注册顺序调用）
+func (r *Reloader) OnReload(fn func(Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// Reload 重新读取配置与其引用的文件，返回变化项
+func (r *Reloader) Reload() ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.commit(res); err != nil {
+		return nil, err
+	}
+	snap := snapshot(c, res)
+	changes := diff(r.snap, snap)
+	r.cur, r.snap = c, snap
+	for _, fn := range r.hooks {
+		fn(c)
+	}
+	return changes, nil
+}
+
+// Watch 收到 SIGHUP 或配置文件、模型目录、Provider 文件变化时重新加载，直到 ctx 结束
+func (r *Reloader) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[CONFIG] file watch disabled: %v", err)
+	} else {
+		defer w.Close()
+	}
+	watched := map[string]bool{} // 监听目录（编辑器常以替换文件的方式保存）
+	files := r.files()
+	watch := func() {
+		if w == nil {
+			return
+		}
+		for f := range files {
+			dir := filepath.Dir(f)
+			if watched[dir] {
+				continue
+			}
+			if err := w.Add(dir); err != nil {
+				log.Printf("[CONFIG] watch %s: %v", dir, err)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+	watch()
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if w != nil {
+		events, errs = w.Events, w.Errors
+	}
+	var debounce <-chan time.Time
+	reload := func(reason string) {
+		changes, err := r.Reload()
+		if err != nil {
+			log.Printf("[CONFIG] reload (%s) failed, keeping previous config: %v", reason, err)
+			return
+		}
+		log.Printf("[CONFIG] reloaded (%s): %d change(s)", reason, len(changes))
+		for _, ch := range changes {
+			log.Printf("[CONFIG]   %s: %q -> %q", ch.Key, ch.Old, ch.New)
+		}
+		files = r.files()
+		watch()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload("SIGHUP")
+		case ev := <-events:
+			if files[filepath.Clean(ev.Name)] && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(300 * time.Millisecond) // 合并一次保存产生的多个事件
+			}
+		case err := <-errs:
+			log.Printf("[CONFIG] watch error: %v", err)
+		case <-debounce:
+			debounce = nil
+			reload("file change")
+		}
+	}
+}
+
+// files 需要监听的文件（绝对路径）
+func (r *Reloader) files() map[string]bool {
+	c := r.Current()
+	out := map[string]bool{}
+	for _, f := range []string{c.Path, c.Catalog, c.SpecsFile} {
+		if f == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(f); err == nil {
+			out[abs] = true
+		}
+	}
+	return out
+}
+
+// snapshot 把配置与其引用文件的内容展开为 key → value，用于对比
+func snapshot(c Config, r resolved) map[string]string {
+	out := map[string]string{}
+	c.Providers = nil // 与 Provider 文件合并后单独展开
+	flatten(out, "", c)
+	for _, s := range r.specs {
+		flatten(out, "providers."+s.Name, s)
+	}
+	for _, m := range r.models {
+		flatten(out, "catalog."+m.Provider+":"+m.Model, m)
+	}
+	return out
+}
+
+func flatten(out map[string]string, prefix string, v any) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return
+	}
+	var tree any
+	if yaml.Unmarshal(data, &tree) != nil {
+		return
+	}
+	walk(out, prefix, tree)
+}
+
+func walk(out map[string]string, prefix string, v any) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		for k, sub := range t {
+			walk(out, join(k), sub)
+		}
+	case []any:
+		for i, sub := range t {
+			walk(out, join(fmt.Sprint(i)), sub)
+		}
+	case nil:
+	default:
+		s := fmt.Sprint(t)
+		if isSecret(prefix) && s != "" {
+			sum := sha256.Sum256([]byte(s))
+			s = fmt.Sprintf("<redacted:%x>", sum[:4])
+		}
+		out[prefix] = s
+	}
+}
+
+func isSecret(key string) bool {
+	return strings.Contains(key, "api_key")
+}
+
+func diff(old, next map[string]string) []Change {
+	var out []Change
+	for k, v := range next {
+		if o, ok := old[k]; !ok || o != v {
+			out = append(out, Change{Key: k, Old: old[k], New: v})
+		}
+	}
+	for k, v := range old {
+		if _, ok := next[k]; !ok {
+			out = append(out, Change{Key: k, Old: v})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	for i := range out {
+		for _, rk := range restartKeys {
+			if out[i].Key == rk {
+				out[i].Restart = true
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/tokenizer"
+	"gollm-mini/internal/types"
+	"gollm-mini/internal/window"
+)
+
+const summarizerSystem = "You maintain a running summary of a conversation. " +
+	"Merge the previous summary with the new messages. Keep facts, names, numbers, decisions and open questions. " +
+	"Reply with the summary only, in at most 200 words."
+
+// SetContextStrategy 设置本实例（含 fallback 链）超出上下文窗口时的裁剪策略，默认 window.Default
+func (l *LLM) SetContextStrategy(s window.Strategy) {
+	l.strategy = s
+	for _, fb := range l.fallbacks {
+		fb.strategy = s
+	}
+}
+
+// UseContextStrategy 按描述设置策略（见 window.Parse）；
+// summarizer 为 "provider:model"，为空时用本实例自身做摘要
+func (l *LLM) UseContextStrategy(spec, summarizer string) error {
+	var sum window.Summarizer
+	if strings.HasPrefix(strings.TrimSpace(spec), "summary") {
+		sum = l.Summarizer()
+		if summarizer != "" {
+			var err error
+			if sum, err = NewSummarizer(summarizer); err != nil {
+				return err
+			}
+		}
+	}
+	st, err := window.Parse(spec, sum)
+	if err != nil {
+		return err
+	}
+	l.SetContextStrategy(st)
+	return nil
+}
+
+// NewSummarizer 按 "provider:model" 创建摘要函数
+func NewSummarizer(target string) (window.Summarizer, error) {
+	name, model, _ := strings.Cut(target, ":")
+	l, err := New(name, model)
+	if err != nil {
+		return nil, fmt.Errorf("summarizer: %w", err)
+	}
+	return l.Summarizer(), nil
+}
+
+// FitContext 按本实例的策略把消息裁剪到 budget 以内
+func (l *LLM) FitContext(ctx context.Context, msgs []types.Message, budget int) (window.Result, error) {
+	st := l.strategy
+	if st == nil {
+		st = window.Default
+	}
+	return st.Apply(ctx, msgs, budget, tokenizer.ForModel(l.model))
+}
+
+// Summarizer 用本实例生成滚动摘要；摘要调用不走缓存，也不再触发摘要
+func (l *LLM) Summarizer() window.Summarizer {
+	return func(ctx context.Context, previous string, dropped []types.Message) (string, error) {
+		var b strings.Builder
+		if previous != "" {
+			b.WriteString("Previous summary:\n" + previous + "\n\n")
+		}
+		b.WriteString("New messages:\n")
+		for _, m := range dropped {
+			if m.Content == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s: %s\n", m.Role, m.Content)
+		}
+
+		s := *l
+		s.fallbacks = nil
+		s.strategy = window.KeepSystem{}
+		txt, _, err := s.generate(ctx, []types.Message{
+			{Role: types.RoleSystem, Content: summarizerSystem},
+			{Role: types.RoleUser, Content: b.String()},
+		}, types.GenerateOptions{}, cache.ModeOff)
+		return strings.TrimSpace(txt), err
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gollm-mini/internal/monitor"
+	"gollm-mini/internal/provider"
+)
+
+// FallbackClass 触发切换到链中下一个 Provider 的错误类别
+type FallbackClass string
+
+const (
+	FallbackConnRefused   FallbackClass = "conn_refused"
+	FallbackServerError   FallbackClass = "5xx"
+	FallbackTimeout       FallbackClass = "timeout"
+	FallbackContextLength FallbackClass = "context_length"
+)
+
+// DefaultFallbackOn 未指定类别时全部启用
+var DefaultFallbackOn = []FallbackClass{
+	FallbackConnRefused, FallbackServerError, FallbackTimeout, FallbackContextLength,
+}
+
+// ParseFallbackClasses 校验类别名；为空返回 DefaultFallbackOn
+func ParseFallbackClasses(s []string) ([]FallbackClass, error) {
+	if len(s) == 0 {
+		return DefaultFallbackOn, nil
+	}
+	out := make([]FallbackClass, 0, len(s))
+	for _, v := range s {
+		c := FallbackClass(strings.TrimSpace(v))
+		switch c {
+		case FallbackConnRefused, FallbackServerError, FallbackTimeout, FallbackContextLength:
+			out = append(out, c)
+		default:
+			return nil, fmt.Errorf("unknown fallback class %q", v)
+		}
+	}
+	return out, nil
+}
+
+// Target fallback 链中的一环
+type Target struct {
+	Provider string
+	Model    string
+}
+
+func (t Target) String() string { return t.Provider + ":" + t.Model }
+
+// ParseChain 解析 "ollama:llama3 -> openai:gpt-4o-mini"；
+// 只按第一个冒号切分，Ollama 的 "llama3:8b" 这类模型名保持完整
+func ParseChain(spec string) ([]Target, error) {
+	var chain []Target
+	for _, part := range strings.Split(spec, "->") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, model, _ := strings.Cut(part, ":")
+		if name == "" {
+			return nil, fmt.Errorf("invalid fallback target %q", part)
+		}
+		chain = append(chain, Target{Provider: name, Model: model})
+	}
+	return chain, nil
+}
+
+// NewChain 以链首为主 Provider、其余为 fallback 创建 LLM
+func NewChain(spec string, on []FallbackClass) (*LLM, error) {
+	chain, err := ParseChain(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("empty fallback chain")
+	}
+	l, err := New(chain[0].Provider, chain[0].Model)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.addFallbacks(chain[1:], on); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// WithFallback 在当前 LLM 之后追加 fallback 链（不含自身）
+func (l *LLM) WithFallback(spec string, on []FallbackClass) error {
+	chain, err := ParseChain(spec)
+	if err != nil {
+		return err
+	}
+	return l.addFallbacks(chain, on)
+}
+
+func (l *LLM) addFallbacks(chain []Target, on []FallbackClass) error {
+	if len(on) == 0 {
+		on = DefaultFallbackOn
+	}
+	for _, t := range chain {
+		fb, err := New(t.Provider, t.Model)
+		if err != nil {
+			return err
+		}
+		// 缓存模式、缓存前缀、裁剪策略与重试策略跟随主实例；之后的 Set* 也会同步到链上
+		fb.cacheMode, fb.cacheNS, fb.strategy, fb.retry = l.cacheMode, l.cacheNS, l.strategy, l.retry
+		l.fallbacks = append(l.fallbacks, fb)
+	}
+	l.fallbackOn = map[FallbackClass]bool{}
+	for _, c := range on {
+		l.fallbackOn[c] = true
+	}
+	return nil
+}
+
+// id "provider:model"，即 Usage.ServedBy
+func (l *LLM) id() string { return l.name + ":" + l.model }
+
+// chain 主实例 + fallback；调用期间只读，可并发使用
+func (l *LLM) chain() []*LLM {
+	return append([]*LLM{l}, l.fallbacks...)
+}
+
+// shouldFallback 调用方自身取消 / 超时不切换；否则按错误类别判断
+func (l *LLM) shouldFallback(ctx context.Context, err error) (FallbackClass, bool) {
+	if err == nil || ctx.Err() != nil {
+		return "", false
+	}
+	c := classifyError(err)
+	return c, c != "" && l.fallbackOn[c]
+}
+
+func (l *LLM) noteFallback(from, to *LLM, class FallbackClass, err error) {
+	monitor.Fallback.WithLabelValues(from.name, to.name, string(class)).Inc()
+	log.Printf("[FALLBACK] from=%s:%s to=%s:%s reason=%s err=%v",
+		from.name, from.model, to.name, to.model, class, err)
+}
+
+// markServed 记录实际完成请求的实例，返回其 id
+func markServed(by *LLM) string {
+	monitor.Served.WithLabelValues(by.name, by.model).Inc()
+	return by.id()
+}
+
+// classifyError 把 provider.ErrorKind 映射到 fallback 类别；
+// conn_refused 覆盖所有连接层失败（拒绝、重置、DNS）
+func classifyError(err error) FallbackClass {
+	switch provider.KindOf(err) {
+	case provider.KindConnection:
+		return FallbackConnRefused
+	case provider.KindServer, provider.KindOverloaded:
+		return FallbackServerError
+	case provider.KindTimeout:
+		return FallbackTimeout
+	case provider.KindContextLength:
+		return FallbackContextLength
+	}
+	return ""
+}
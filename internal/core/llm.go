@@ -2,124 +2,334 @@ package core
 
 import (
 	"context"
+	"errors"
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/catalog"
 	"gollm-mini/internal/helper"
 	"gollm-mini/internal/monitor"
 	"log"
+	"strings"
 	"time"
 
 	"gollm-mini/internal/provider"
+	"gollm-mini/internal/tokenizer"
 	"gollm-mini/internal/types"
-)
-
-const (
-	maxCtx = 3000
+	"gollm-mini/internal/window"
 )
 
 type LLM struct {
-	name  string
-	model string
-	p     provider.Provider
+	name      string
+	model     string
+	p         provider.Provider
+	cacheMode cache.Mode
+	cacheNS   string // 缓存 key 前缀，多租户隔离
+	retry     RetryPolicy
+	strategy  window.Strategy // 上下文裁剪策略
+
+	fallbacks  []*LLM                 // 按顺序尝试的备用 Provider
+	fallbackOn map[FallbackClass]bool // 哪些错误类别触发切换
 }
 
 func (l *LLM) Provider() string { return l.name }
 
 func (l *LLM) Model() string { return l.model }
 
-// New 创建一个 LLM 实例并注入模型名（若 Provider 支持）
+// Spec 本实例在模型目录中的描述，未登记时为 catalog.Fallback
+func (l *LLM) Spec() catalog.Model { return catalog.Get(l.name, l.model) }
+
+// SetCacheMode 设置本实例（含 fallback 链）的缓存模式，默认 read-write
+func (l *LLM) SetCacheMode(m cache.Mode) {
+	l.cacheMode = m
+	for _, fb := range l.fallbacks {
+		fb.cacheMode = m
+	}
+}
+
+// SetCacheNamespace 给本实例（含 fallback 链）的缓存 key 加前缀（如 tenant.Prefix），不同前缀互不命中
+func (l *LLM) SetCacheNamespace(ns string) {
+	l.cacheNS = ns
+	for _, fb := range l.fallbacks {
+		fb.cacheNS = ns
+	}
+}
+
+// SetRetryPolicy 覆盖本实例（含 fallback 链）的重试策略，默认见 SetDefaultRetryPolicy
+func (l *LLM) SetRetryPolicy(p RetryPolicy) {
+	l.retry = p
+	for _, fb := range l.fallbacks {
+		fb.retry = p
+	}
+}
+
+// New 创建一个 LLM 实例，底层 Provider 为独立新建，不与其他请求共享
 func New(providerName, model string) (*LLM, error) {
-	p, err := provider.Get(providerName)
+	return NewWithConfig(providerName, provider.Config{Model: model})
+}
+
+// NewWithConfig 允许额外指定 BaseURL / APIKey / Options
+func NewWithConfig(providerName string, cfg provider.Config) (*LLM, error) {
+	p, err := provider.New(providerName, cfg)
 	if err != nil {
 		return nil, err
 	}
-	if ms, ok := p.(provider.ModelSetter); ok && model != "" {
-		ms.SetModel(model)
+	// 未指定模型时以 Provider 实际使用的为准，目录查询、缓存 key 与 served_by 都依赖它
+	model := cfg.Model
+	if mn, ok := p.(provider.ModelNamer); ok && mn.Model() != "" {
+		model = mn.Model()
 	}
-	return &LLM{name: providerName, model: model, p: p}, nil
+	return &LLM{
+		name:      providerName,
+		model:     model,
+		p:         p,
+		cacheMode: cache.ModeReadWrite,
+		retry:     defaultRetry(),
+		strategy:  window.Default,
+	}, nil
 }
 
 // Generate 调用底层 Provider 的生成接口，并打印日志
-func (l *LLM) Generate(ctx context.Context, messages []types.Message) (string, types.Usage, error) {
-	//Memory截断
-	clipped := helper.TruncateMessages(messages, maxCtx)
+func (l *LLM) Generate(ctx context.Context, messages []types.Message, opts types.GenerateOptions) (string, types.Usage, error) {
+	return l.generate(ctx, messages, opts, l.cacheMode)
+}
+
+// generate 依次尝试主 Provider 与 fallback 链
+func (l *LLM) generate(ctx context.Context, messages []types.Message, opts types.GenerateOptions, mode cache.Mode) (string, types.Usage, error) {
+	chain := l.chain()
+	txt, usage, err := chain[0].generateOnce(ctx, messages, opts, mode)
+	served := chain[0]
+	for _, next := range chain[1:] {
+		class, ok := l.shouldFallback(ctx, err)
+		if !ok {
+			break
+		}
+		l.noteFallback(served, next, class, err)
+		served = next
+		txt, usage, err = next.generateOnce(ctx, messages, opts, mode)
+	}
+	if err == nil {
+		usage.ServedBy = markServed(served)
+	}
+	return txt, usage, err
+}
+
+func (l *LLM) generateOnce(ctx context.Context, messages []types.Message, opts types.GenerateOptions, mode cache.Mode) (string, types.Usage, error) {
+	spec := l.Spec()
+	if err := l.validate(spec, opts, catalog.Capabilities{}); err != nil {
+		return "", types.Usage{}, err
+	}
+	//上下文裁剪
+	fit, err := l.fit(ctx, messages, spec, opts)
+	if err != nil {
+		return "", types.Usage{}, err
+	}
+	clipped := fit.Messages
 
 	//尝试命中缓存
-	//cacheKey := cache.KeyFromMessages(l.name, l.model, clipped)
-	//if v, ok := cache.Get(cacheKey); ok {
-	//	monitor.CacheHit.Inc()
-	//	log.Printf("[CACHE HIT] provider=%s model=%s", l.name, l.model)
-	//	return v.Text, v.Usage, nil
-	//}
-	//monitor.CacheMiss.Inc()
+	cacheKey := l.cacheNS + cache.KeyFromRequest(l.name, l.model, clipped, opts)
+	if v, ok := l.cacheGet(cacheKey, mode); ok {
+		v.Usage.TrimmedTokens = fit.Trimmed
+		return v.Text, v.Usage, nil
+	}
 
 	start := time.Now()
 	var (
 		txt   string
 		usage types.Usage
-		err   error
 	)
 
-	err = Retry(ctx, 3, 300*time.Millisecond, func() error {
+	err = l.retry.Do(ctx, l.name, func() error {
+		if e := waitRate(ctx, l.name); e != nil {
+			return &RetryStop{e}
+		}
 		var e error
-		txt, usage, e = l.p.Generate(ctx, clipped)
+		txt, usage, e = l.p.Generate(ctx, clipped, opts)
 		return e
 	})
 	dur := time.Since(start)
 
 	//Prometheus
-	status := "ok"
-	if err != nil {
-		status = "error"
-	}
-	monitor.Latency.WithLabelValues(l.name, "generate", status).Observe(dur.Seconds())
-	monitor.Tokens.WithLabelValues(l.name, "prompt").Add(float64(usage.PromptTokens))
-	monitor.Tokens.WithLabelValues(l.name, "completion").Add(float64(usage.CompletionTokens))
+	monitor.Latency.WithLabelValues(l.name, "generate", callStatus(err)).Observe(dur.Seconds())
+	cost := l.observeUsage(spec, usage)
+	log.Printf("[LLM] provider=%s model=%s prompt=%d completion=%d total=%d trimmed=%d latency=%s cost=$%.4f",
+		l.name, l.model, usage.PromptTokens, usage.CompletionTokens, usage.Total(), fit.Trimmed, dur, cost)
 
-	cost := helper.CalcCost(l.name, l.name, usage.PromptTokens, usage.CompletionTokens)
-	if cost > 0 {
-		monitor.CostUSD.WithLabelValues(l.name, l.name).Add(cost)
+	if err == nil && mode.CanWrite() {
+		cache.Put(cacheKey, cache.Value{Text: txt, Usage: usage})
 	}
-	log.Printf("[LLM] provider=%s prompt=%d completion=%d total=%d latency=%s cost=$%.4f",
-		l.name, usage.PromptTokens, usage.CompletionTokens, usage.Total(), dur, cost)
-
-	//if err == nil {
-	//	cache.Put(cacheKey, cache.Value{Text: txt, Usage: usage})
-	//}
+	usage.TrimmedTokens = fit.Trimmed
 	if c, ok := l.p.(interface{ Close() error }); ok {
 		_ = c.Close()
 	}
 	return txt, usage, err
 }
 
-// Stream 调用底层 Provider 的流式接口（若实现）
-func (l *LLM) Stream(ctx context.Context, messages []types.Message, cb func(types.Chunk)) (types.Usage, error) {
-	//Memory截断
-	clipped := helper.TruncateMessages(messages, maxCtx)
+// Stream 调用底层 Provider 的流式接口（若实现）；
+// 只有在尚未向 cb 发出任何片段时才会切换到 fallback
+func (l *LLM) Stream(ctx context.Context, messages []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	emitted := false
+	tracked := func(ch types.Chunk) {
+		emitted = true
+		cb(ch)
+	}
+
+	chain := l.chain()
+	usage, err := chain[0].streamOnce(ctx, messages, opts, tracked)
+	served := chain[0]
+	for _, next := range chain[1:] {
+		if emitted {
+			break
+		}
+		class, ok := l.shouldFallback(ctx, err)
+		if !ok {
+			break
+		}
+		l.noteFallback(served, next, class, err)
+		served = next
+		usage, err = next.streamOnce(ctx, messages, opts, tracked)
+	}
+	switch {
+	case err == nil:
+		usage.ServedBy = markServed(served)
+	case emitted:
+		usage.ServedBy = served.id() // 中途失败或被取消：已输出的部分仍由它生成，用于计费
+	}
+	return usage, err
+}
+
+func (l *LLM) streamOnce(ctx context.Context, messages []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	spec := l.Spec()
+	if err := l.validate(spec, opts, catalog.Capabilities{}); err != nil {
+		return types.Usage{}, err
+	}
+	//上下文裁剪
+	fit, err := l.fit(ctx, messages, spec, opts)
+	if err != nil {
+		return types.Usage{}, err
+	}
+	clipped := fit.Messages
+
+	// 命中缓存时把文本按词切块回放
+	cacheKey := l.cacheNS + cache.KeyFromRequest(l.name, l.model, clipped, opts)
+	if v, ok := l.cacheGet(cacheKey, l.cacheMode); ok {
+		for _, tok := range strings.SplitAfter(v.Text, " ") {
+			if tok != "" {
+				cb(types.Chunk{Content: tok, Delta: helper.CountTokens(l.model, tok)})
+			}
+		}
+		v.Usage.TrimmedTokens = fit.Trimmed
+		return v.Usage, nil
+	}
+	var buf strings.Builder
+	emit := func(ch types.Chunk) {
+		buf.WriteString(ch.Content)
+		cb(ch)
+	}
+	start := time.Now()
 
 	ps, streamed := l.p.(interface {
-		Stream(context.Context, []types.Message, func(types.Chunk)) (types.Usage, error)
+		Stream(context.Context, []types.Message, types.GenerateOptions, func(types.Chunk)) (types.Usage, error)
 	})
+	// 若 Provider 或目录中的模型不支持流式，降级为一次性调用
+	streamed = streamed && spec.Capabilities.Streaming
 
-	var (
-		usage types.Usage
-		err   error
-	)
-	// 若 Provider 不支持流式，降级为一次性调用
+	var usage types.Usage
 
-	err = Retry(ctx, 3, 300*time.Millisecond, func() error {
+	err = l.retry.Do(ctx, l.name, func() error {
+		if err := waitRate(ctx, l.name); err != nil {
+			return &RetryStop{err}
+		}
 		if streamed {
-			usage, err = ps.Stream(ctx, clipped, cb)
+			usage, err = ps.Stream(ctx, clipped, opts, emit)
+			// 已经输出过片段就不能重来，否则客户端会收到重复内容；立即停止，不再退避等待
+			if err != nil && buf.Len() > 0 {
+				return &RetryStop{err}
+			}
 			return err
 		}
 		var txt string
-		txt, usage, err = l.p.Generate(ctx, clipped)
+		txt, usage, err = l.p.Generate(ctx, clipped, opts)
 		if err == nil {
-			cb(types.Chunk{Content: txt, Delta: usage.CompletionTokens})
+			emit(types.Chunk{Content: txt, Delta: usage.CompletionTokens})
 		}
 		return err
 	})
 
+	if errors.Is(err, context.Canceled) {
+		// 调用方中途断开时 Provider 通常来不及返回用量，按已生成内容估算，便于计费
+		if usage.CompletionTokens == 0 && buf.Len() > 0 {
+			usage.CompletionTokens = helper.CountTokens(l.model, buf.String())
+		}
+		if usage.PromptTokens == 0 && buf.Len() > 0 {
+			usage.PromptTokens = tokenizer.CountMessages(tokenizer.ForModel(l.model), clipped)
+		}
+	}
+	monitor.Latency.WithLabelValues(l.name, "stream", callStatus(err)).Observe(time.Since(start).Seconds())
+	l.observeUsage(spec, usage)
+
+	if err == nil && l.cacheMode.CanWrite() {
+		cache.Put(cacheKey, cache.Value{Text: buf.String(), Usage: usage})
+	}
+	usage.TrimmedTokens = fit.Trimmed
+
 	if c, ok := l.p.(interface{ Close() error }); ok {
 		_ = c.Close()
 	}
 	return usage, err
 }
+
+// callStatus llm_request_latency_seconds 的 status 标签：ok / cancelled（调用方取消）/ error
+func callStatus(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	}
+	return "error"
+}
+
+// fit 按策略把消息裁剪到模型的输入预算内，并记录裁掉的 token
+func (l *LLM) fit(ctx context.Context, messages []types.Message, spec catalog.Model, opts types.GenerateOptions) (window.Result, error) {
+	res, err := l.FitContext(ctx, messages, spec.PromptBudget(opts.MaxTokens))
+	if err != nil {
+		return res, err
+	}
+	if res.Trimmed > 0 {
+		monitor.Tokens.WithLabelValues(l.name, "trimmed").Add(float64(res.Trimmed))
+	}
+	return res, nil
+}
+
+// validate 按模型目录拒绝超出能力的请求；归为 bad_request，不重试也不触发 fallback
+func (l *LLM) validate(spec catalog.Model, opts types.GenerateOptions, need catalog.Capabilities) error {
+	if err := spec.Validate(opts.MaxTokens, need); err != nil {
+		return &provider.Error{Kind: provider.KindBadRequest, Err: err}
+	}
+	return nil
+}
+
+// observeUsage 记录 token 与费用指标，返回本次费用
+func (l *LLM) observeUsage(spec catalog.Model, usage types.Usage) float64 {
+	monitor.Tokens.WithLabelValues(l.name, "prompt").Add(float64(usage.PromptTokens))
+	monitor.Tokens.WithLabelValues(l.name, "completion").Add(float64(usage.CompletionTokens))
+	cost := spec.Cost(usage.PromptTokens, usage.CompletionTokens)
+	if cost > 0 {
+		monitor.CostUSD.WithLabelValues(l.name, l.model).Add(cost)
+	}
+	return cost
+}
+
+// cacheGet 按模式读取缓存并记录命中指标
+func (l *LLM) cacheGet(key string, mode cache.Mode) (cache.Value, bool) {
+	if !mode.CanRead() {
+		return cache.Value{}, false
+	}
+	v, ok := cache.Get(key)
+	if !ok {
+		monitor.CacheMiss.Inc()
+		return v, false
+	}
+	monitor.CacheHit.Inc()
+	log.Printf("[CACHE HIT] provider=%s model=%s", l.name, l.model)
+	return v, true
+}
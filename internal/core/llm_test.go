@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/catalog"
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/provider/mock"
+	"gollm-mini/internal/types"
+)
+
+// flaky 模型名为 "down" 时返回 5xx，用于触发 fallback
+type flaky struct{ model string }
+
+func (p flaky) Generate(context.Context, []types.Message, types.GenerateOptions) (string, types.Usage, error) {
+	if p.model == "down" {
+		return "", types.Usage{}, &provider.Error{Kind: provider.KindServer, Err: errors.New("503")}
+	}
+	return p.model, types.Usage{CompletionTokens: 1}, nil
+}
+
+func (p flaky) Stream(ctx context.Context, msgs []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	txt, u, err := p.Generate(ctx, msgs, opts)
+	if err == nil {
+		cb(types.Chunk{Content: txt, Delta: 1})
+	}
+	return u, err
+}
+
+func init() {
+	provider.Register("flaky", func(cfg provider.Config) (provider.Provider, error) {
+		return flaky{model: cfg.Model}, nil
+	})
+}
+
+// 同一个 LLM（含 fallback 链）被多个 goroutine 共用时，ServedBy 随各自的结果返回；配合 go test -race
+func TestSharedLLMServedBy(t *testing.T) {
+	cases := []struct {
+		primary, want string
+	}{
+		{"up", "flaky:up"},
+		{"down", "flaky:backup"},
+	}
+	for _, tc := range cases {
+		llm, err := New("flaky", tc.primary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := llm.WithFallback("flaky:backup", nil); err != nil {
+			t.Fatal(err)
+		}
+		llm.SetCacheMode(cache.ModeOff)
+		llm.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				msgs := []types.Message{{Role: types.RoleUser, Content: "hi"}}
+				var u types.Usage
+				var err error
+				if i%2 == 0 {
+					_, u, err = llm.Generate(context.Background(), msgs, types.GenerateOptions{})
+				} else {
+					u, err = llm.Stream(context.Background(), msgs, types.GenerateOptions{}, func(types.Chunk) {})
+				}
+				if err != nil {
+					t.Errorf("%s: %v", tc.primary, err)
+					return
+				}
+				if u.ServedBy != tc.want {
+					t.Errorf("%s: served by %q, want %q", tc.primary, u.ServedBy, tc.want)
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
+
+// defaulted 未指定模型时使用 "base"，并通过 provider.ModelNamer 报告
+type defaulted struct{ flaky }
+
+func (p defaulted) Model() string { return p.model }
+
+// 未指定模型时按 Provider 实际使用的模型查目录、记 ServedBy
+func TestDefaultModelResolved(t *testing.T) {
+	provider.Register("defaulted", func(cfg provider.Config) (provider.Provider, error) {
+		if cfg.Model == "" {
+			cfg.Model = "base"
+		}
+		return defaulted{flaky{model: cfg.Model}}, nil
+	})
+	catalog.Add(catalog.Model{Provider: "defaulted", Model: "base", ContextWindow: 1234})
+
+	llm, err := New("defaulted", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm.SetCacheMode(cache.ModeOff)
+	if llm.Model() != "base" || llm.Spec().ContextWindow != 1234 {
+		t.Errorf("model %q, spec %+v", llm.Model(), llm.Spec())
+	}
+	if _, u, err := llm.Generate(context.Background(), []types.Message{{Role: types.RoleUser, Content: "hi"}}, types.GenerateOptions{}); err != nil || u.ServedBy != "defaulted:base" {
+		t.Errorf("served by %q, err %v", u.ServedBy, err)
+	}
+}
+
+// 目录中未声明 streaming 的模型降级为一次性调用，未声明 tools 的模型拒绝工具调用；
+// 结构化输出靠提示词约束，不要求 json 能力
+func TestCatalogCapabilities(t *testing.T) {
+	schema := filepath.Join(t.TempDir(), "person.schema.json")
+	if err := os.WriteFile(schema, []byte(personSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := mock.Register("plain-mock",
+		mock.Response{Chunks: []string{"a", "b"}},
+		mock.Response{Text: `{"name": "ann", "age": 3}`},
+	)
+	catalog.Add(catalog.Model{Provider: "plain-mock", Model: "*", ContextWindow: 4096})
+	llm, err := New("plain-mock", "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm.SetCacheMode(cache.ModeOff)
+	prompt := []types.Message{{Role: types.RoleUser, Content: "hi"}}
+
+	var chunks []string
+	if _, err := llm.Stream(context.Background(), prompt, types.GenerateOptions{}, func(ch types.Chunk) { chunks = append(chunks, ch.Content) }); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(chunks, []string{"ab"}) {
+		t.Errorf("chunks %q, want one chunk from Generate", chunks)
+	}
+
+	var out map[string]any
+	if _, err := llm.StructuredGenerate(context.Background(), prompt, schema, types.GenerateOptions{}, &out); err != nil || out["name"] != "ann" {
+		t.Errorf("structured: %v, err %v", out, err)
+	}
+
+	_, _, err = llm.GenerateWithTools(context.Background(), prompt, []types.Tool{{Name: "now"}}, types.GenerateOptions{})
+	var pe *provider.Error
+	if !errors.As(err, &pe) || pe.Kind != provider.KindBadRequest {
+		t.Errorf("tools: err %v, want bad_request", err)
+	}
+	if n := len(m.Requests()); n != 2 {
+		t.Errorf("provider called %d times, want 2", n)
+	}
+}
+
+// 流式输出中途失败立即返回，不做退避等待，也不重新请求
+func TestStreamMidwayFailureNoBackoff(t *testing.T) {
+	m := mock.Register("midway-mock", mock.Response{Chunks: []string{"a", "b"}, Err: &provider.Error{Kind: provider.KindServer, Err: errors.New("reset")}})
+	llm, err := New("midway-mock", "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm.SetCacheMode(cache.ModeOff)
+	llm.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second})
+
+	var chunks []string
+	start := time.Now()
+	_, err = llm.Stream(context.Background(), []types.Message{{Role: types.RoleUser, Content: "hi"}}, types.GenerateOptions{}, func(ch types.Chunk) { chunks = append(chunks, ch.Content) })
+	if provider.KindOf(err) != provider.KindServer || !slices.Equal(chunks, []string{"a", "b"}) {
+		t.Errorf("err %v, chunks %q", err, chunks)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("returned after %s, want no backoff", d)
+	}
+	if n := len(m.Requests()); n != 1 {
+		t.Errorf("provider called %d times, want 1", n)
+	}
+}
+
+// 重试策略与缓存模式一样同步到 fallback 链，先设后设都生效
+func TestRetryPolicyFollowsFallbacks(t *testing.T) {
+	before := RetryPolicy{MaxAttempts: 1}
+	after := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}
+	llm, err := New("flaky", "down")
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm.SetRetryPolicy(before)
+	if err := llm.WithFallback("flaky:backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := llm.fallbacks[0].retry; got != before {
+		t.Errorf("fallback added later: %+v, want %+v", got, before)
+	}
+	llm.SetRetryPolicy(after)
+	if got := llm.fallbacks[0].retry; got != after {
+		t.Errorf("set after fallback: %+v, want %+v", got, after)
+	}
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit 单个 Provider 的请求速率上限（所有 LLM 实例共享）
+type RateLimit struct {
+	RPM   float64 `json:"rpm" yaml:"rpm"`     // 每分钟请求数，<= 0 不限
+	Burst int     `json:"burst" yaml:"burst"` // 突发请求数，默认 1
+}
+
+type limiterEntry struct {
+	limit RateLimit
+	l     *rate.Limiter
+}
+
+var limiters atomic.Pointer[map[string]limiterEntry]
+
+// SetRateLimits 以 Provider 名称为 key 整体替换限流配置；配置未变的 Provider 沿用原令牌桶。
+// 正在等待的请求继续使用旧令牌桶，新请求立即使用新配置
+func SetRateLimits(limits map[string]RateLimit) {
+	var old map[string]limiterEntry
+	if p := limiters.Load(); p != nil {
+		old = *p
+	}
+	next := make(map[string]limiterEntry, len(limits))
+	for name, lim := range limits {
+		if lim.RPM <= 0 {
+			continue
+		}
+		if lim.Burst <= 0 {
+			lim.Burst = 1
+		}
+		if e, ok := old[name]; ok && e.limit == lim {
+			next[name] = e
+			continue
+		}
+		next[name] = limiterEntry{limit: lim, l: rate.NewLimiter(rate.Limit(lim.RPM/60), lim.Burst)}
+	}
+	limiters.Store(&next)
+}
+
+// waitRate 按 Provider 限流，ctx 结束时返回错误
+func waitRate(ctx context.Context, name string) error {
+	p := limiters.Load()
+	if p == nil {
+		return nil
+	}
+	e, ok := (*p)[name]
+	if !ok {
+		return nil
+	}
+	return e.l.Wait(ctx)
+}
@@ -3,12 +3,55 @@ package core
 import (
 	"context"
 	"errors"
+	"math/rand"
+	"sync/atomic"
 	"time"
+
+	"gollm-mini/internal/monitor"
+	"gollm-mini/internal/provider"
 )
 
-func Retry(ctx context.Context, tries int, base time.Duration, fn func() error) error {
+// RetryPolicy 重试策略：指数退避 + 抖动，遵循 Retry-After，并限制总耗时
+type RetryPolicy struct {
+	MaxAttempts int           `json:"max_attempts" yaml:"max_attempts"` // 含首次调用
+	BaseDelay   time.Duration `json:"base_delay" yaml:"base_delay"`     // 第 n 次等待 BaseDelay * 2^n
+	MaxDelay    time.Duration `json:"max_delay" yaml:"max_delay"`       // 单次退避上限，0 不限
+	MaxElapsed  time.Duration `json:"max_elapsed" yaml:"max_elapsed"`   // 总耗时上限（含等待），0 不限
+	Jitter      float64       `json:"jitter" yaml:"jitter"`             // 0~1，等待时间上下浮动比例
+}
+
+// DefaultRetryPolicy 内置重试策略；新建 LLM 时使用 SetDefaultRetryPolicy 设置的值，未设置时用它
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   300 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	MaxElapsed:  60 * time.Second,
+	Jitter:      0.2,
+}
+
+var retryDefault atomic.Pointer[RetryPolicy]
+
+// SetDefaultRetryPolicy 修改此后新建 LLM 的重试策略；可在运行中调用
+func SetDefaultRetryPolicy(p RetryPolicy) { retryDefault.Store(&p) }
+
+func defaultRetry() RetryPolicy {
+	if p := retryDefault.Load(); p != nil {
+		return *p
+	}
+	return DefaultRetryPolicy
+}
+
+// Do 执行 fn 直到成功、遇到不可重试错误、次数用尽或超出总耗时。
+// label 用于 llm_retries_total 的 provider 标签。
+func (p RetryPolicy) Do(ctx context.Context, label string, fn func() error) error {
+	start := time.Now()
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
 	var err error
-	for i := 0; i < tries; i++ {
+	for i := 0; i < attempts; i++ {
 		if err = fn(); err == nil {
 			return nil
 		}
@@ -17,7 +60,20 @@ func Retry(ctx context.Context, tries int, base time.Duration, fn func() error)
 		if errors.As(err, &re) {
 			return err
 		}
-		sleep := base * (1 << i) // 1x,2x,4x…
+		pe := provider.Classify(err)
+		if !pe.Kind.Retryable() || i == attempts-1 {
+			return err
+		}
+
+		sleep := p.backoff(i)
+		if pe.RetryAfter > sleep {
+			sleep = pe.RetryAfter
+		}
+		if p.MaxElapsed > 0 && time.Since(start)+sleep > p.MaxElapsed {
+			return err // 再等就超出总时长
+		}
+		monitor.Retries.WithLabelValues(label, string(pe.Kind)).Inc()
+
 		select {
 		case <-time.After(sleep):
 		case <-ctx.Done():
@@ -27,6 +83,24 @@ func Retry(ctx context.Context, tries int, base time.Duration, fn func() error)
 	return err
 }
 
+func (p RetryPolicy) backoff(i int) time.Duration {
+	d := p.BaseDelay * (1 << i) // 1x,2x,4x…
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// Retry 固定次数与基准退避的简写，沿用默认策略的其余设置
+func Retry(ctx context.Context, tries int, base time.Duration, fn func() error) error {
+	p := defaultRetry()
+	p.MaxAttempts, p.BaseDelay = tries, base
+	return p.Do(ctx, "", fn)
+}
+
 // RetryStop 用于 Provider 主动标记“别再重试”
 type RetryStop struct{ error }
 
@@ -3,8 +3,8 @@ package core
 import (
 	"context"
 	"encoding/json"
-	"time"
 
+	"gollm-mini/internal/cache"
 	"gollm-mini/internal/helper"
 	"gollm-mini/internal/types"
 )
@@ -16,22 +16,39 @@ func (l *LLM) StructuredGenerate(
 	ctx context.Context,
 	prompt []types.Message,
 	schemaPath string,
+	opts types.GenerateOptions,
 	out interface{},
 ) (types.Usage, error) {
 
 	var usage types.Usage
-	err := Retry(ctx, structuredRetries, 300*time.Millisecond, func() error {
+	mode := l.cacheMode
+	policy := l.retry
+	policy.MaxAttempts = structuredRetries
+	err := policy.Do(ctx, l.name, func() error {
 		// 1. 在系统指令前追加“严格输出 JSON”提示
 		enforced := append(
 			[]types.Message{{Role: types.RoleSystem, Content: "请仅以符合 schema 的 JSON 输出，勿添加解释。"}},
 			prompt...,
 		)
 
-		txt, u, err := l.Generate(ctx, enforced)
-		usage = u
+		// JSON 由提示词约束并在下面校验，不依赖 Provider 的 JSON mode，因此不要求目录中的 json 能力
+		txt, u, err := l.generate(ctx, enforced, opts, mode)
+		// 每次尝试都要计费，用量累加
+		usage.PromptTokens += u.PromptTokens
+		usage.CompletionTokens += u.CompletionTokens
+		usage.TrimmedTokens = max(usage.TrimmedTokens, u.TrimmedTokens)
+		if u.ServedBy != "" {
+			usage.ServedBy = u.ServedBy
+		}
 		if err != nil {
 			return err
 		}
+		// 缓存里的旧答案不合法时，重试必须绕过读取
+		if mode.CanWrite() {
+			mode = cache.ModeRefresh
+		} else {
+			mode = cache.ModeOff
+		}
 
 		if err := helper.ParseJSON(txt, out); err != nil {
 			return err // 触发重试
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/provider/mock"
+	"gollm-mini/internal/types"
+)
+
+const personSchema = `{
+  "type": "object",
+  "required": ["name", "age"],
+  "properties": {"name": {"type": "string"}, "age": {"type": "integer", "minimum": 0}}
+}`
+
+// 非 JSON 与不符合 schema 的回答都会触发重试，直到得到合法输出
+func TestStructuredGenerateRetriesUntilValid(t *testing.T) {
+	schema := filepath.Join(t.TempDir(), "person.schema.json")
+	if err := os.WriteFile(schema, []byte(personSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := mock.Register("structured-mock",
+		mock.Response{Text: "Sure! Here is the person.", Usage: types.Usage{PromptTokens: 10, CompletionTokens: 5}},
+		mock.Response{Text: `{"name": "ann", "age": -1}`, Usage: types.Usage{PromptTokens: 10, CompletionTokens: 6}},
+		mock.Response{Text: `{"name": "ann", "age": 3}`, Usage: types.Usage{PromptTokens: 10, CompletionTokens: 7}},
+	)
+	llm, err := New("structured-mock", "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm.SetCacheMode(cache.ModeOff)
+	llm.SetRetryPolicy(RetryPolicy{}) // 不等待
+
+	var out struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	prompt := []types.Message{{Role: types.RoleUser, Content: "Describe ann"}}
+	usage, err := llm.StructuredGenerate(context.Background(), prompt, schema, types.GenerateOptions{}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "ann" || out.Age != 3 {
+		t.Errorf("out = %+v", out)
+	}
+	if usage.ServedBy != "structured-mock:m" {
+		t.Errorf("served by %q", usage.ServedBy)
+	}
+	if usage.PromptTokens != 30 || usage.CompletionTokens != 18 { // 三次尝试的用量之和
+		t.Errorf("usage %+v, want the sum of all attempts", usage)
+	}
+	reqs := m.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("%d attempts, want 3", len(reqs))
+	}
+	if first := reqs[0][0]; first.Role != types.RoleSystem {
+		t.Errorf("first message %+v, want the JSON-only system prompt", first)
+	}
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/catalog"
+	"gollm-mini/internal/monitor"
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/types"
+)
+
+// maxToolRounds 防止模型无限循环调用工具
+const maxToolRounds = 8
+
+// ToolHandler 执行一次工具调用；args 为模型给出的 JSON 参数，返回值原样回填给模型
+type ToolHandler func(ctx context.Context, args json.RawMessage) (string, error)
+
+type registeredTool struct {
+	def     types.Tool
+	handler ToolHandler
+}
+
+var (
+	toolMu sync.RWMutex
+	tools  = map[string]registeredTool{}
+)
+
+// RegisterTool 注册一个可被模型调用的 Go 函数；同名覆盖
+func RegisterTool(def types.Tool, h ToolHandler) {
+	toolMu.Lock()
+	defer toolMu.Unlock()
+	tools[def.Name] = registeredTool{def: def, handler: h}
+}
+
+// ToolNames 返回已注册的工具名（升序）
+func ToolNames() []string {
+	toolMu.RLock()
+	defer toolMu.RUnlock()
+	names := make([]string, 0, len(tools))
+	for n := range tools {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupTools(names []string) ([]registeredTool, error) {
+	toolMu.RLock()
+	defer toolMu.RUnlock()
+	out := make([]registeredTool, 0, len(names))
+	for _, n := range names {
+		t, ok := tools[n]
+		if !ok {
+			return nil, fmt.Errorf("tool %s not registered", n)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// RunTools 带工具的对话循环：模型请求调用时执行本地 handler 并回填结果，
+// 直到模型给出不含 ToolCalls 的最终回答。steps 为循环中新增的消息（调用 + 结果 + 最终回答）。
+func (l *LLM) RunTools(
+	ctx context.Context,
+	messages []types.Message,
+	toolNames []string,
+	opts types.GenerateOptions,
+) (text string, steps []types.Message, usage types.Usage, err error) {
+
+	enabled, err := lookupTools(toolNames)
+	if err != nil {
+		return "", nil, usage, err
+	}
+	defs := make([]types.Tool, len(enabled))
+	handlers := make(map[string]ToolHandler, len(enabled))
+	for i, t := range enabled {
+		defs[i] = t.def
+		handlers[t.def.Name] = t.handler
+	}
+
+	msgs := append([]types.Message{}, messages...)
+	for round := 0; round < maxToolRounds; round++ {
+		reply, u, e := l.GenerateWithTools(ctx, msgs, defs, opts)
+		usage.PromptTokens += u.PromptTokens
+		usage.CompletionTokens += u.CompletionTokens
+		usage.TrimmedTokens = max(usage.TrimmedTokens, u.TrimmedTokens)
+		if u.ServedBy != "" {
+			usage.ServedBy = u.ServedBy
+		}
+		if e != nil {
+			return "", steps, usage, e
+		}
+
+		steps = append(steps, reply)
+		msgs = append(msgs, reply)
+		if len(reply.ToolCalls) == 0 {
+			return reply.Content, steps, usage, nil
+		}
+
+		for _, call := range reply.ToolCalls {
+			result := runTool(ctx, handlers, call)
+			log.Printf("[TOOL] provider=%s tool=%s args=%s", l.name, call.Name, call.Arguments)
+			res := types.Message{
+				Role:       types.RoleTool,
+				Content:    result,
+				ToolCallID: call.ID,
+				Name:       call.Name,
+			}
+			steps = append(steps, res)
+			msgs = append(msgs, res)
+		}
+	}
+	return "", steps, usage, fmt.Errorf("tool loop exceeded %d rounds", maxToolRounds)
+}
+
+// GenerateWithTools 单轮函数调用：只把工具定义交给模型，不执行 handler
+func (l *LLM) GenerateWithTools(ctx context.Context, messages []types.Message, defs []types.Tool, opts types.GenerateOptions) (types.Message, types.Usage, error) {
+	chain := l.chain()
+	reply, usage, err := chain[0].generateWithToolsOnce(ctx, messages, defs, opts)
+	served := chain[0]
+	for _, next := range chain[1:] {
+		class, ok := l.shouldFallback(ctx, err)
+		if !ok {
+			break
+		}
+		l.noteFallback(served, next, class, err)
+		served = next
+		reply, usage, err = next.generateWithToolsOnce(ctx, messages, defs, opts)
+	}
+	if err == nil {
+		usage.ServedBy = markServed(served)
+	}
+	return reply, usage, err
+}
+
+func (l *LLM) generateWithToolsOnce(ctx context.Context, messages []types.Message, defs []types.Tool, opts types.GenerateOptions) (types.Message, types.Usage, error) {
+	tc, ok := l.p.(provider.ToolCaller)
+	if !ok {
+		return types.Message{}, types.Usage{}, fmt.Errorf("provider %s does not support tools", l.name)
+	}
+	spec := l.Spec()
+	if err := l.validate(spec, opts, catalog.Capabilities{Tools: true}); err != nil {
+		return types.Message{}, types.Usage{}, err
+	}
+	fit, err := l.fit(ctx, messages, spec, opts)
+	if err != nil {
+		return types.Message{}, types.Usage{}, err
+	}
+	messages = fit.Messages
+
+	var (
+		reply types.Message
+		usage types.Usage
+	)
+	start := time.Now()
+	err = l.retry.Do(ctx, l.name, func() error {
+		if e := waitRate(ctx, l.name); e != nil {
+			return &RetryStop{e}
+		}
+		var e error
+		reply, usage, e = tc.GenerateWithTools(ctx, messages, defs, opts)
+		return e
+	})
+	monitor.Latency.WithLabelValues(l.name, "tools", callStatus(err)).Observe(time.Since(start).Seconds())
+	l.observeUsage(spec, usage)
+	usage.TrimmedTokens = fit.Trimmed
+	return reply, usage, err
+}
+
+// runTool 执行单个调用；错误以文本形式回填，让模型自行纠正参数
+func runTool(ctx context.Context, handlers map[string]ToolHandler, call types.ToolCall) string {
+	h, ok := handlers[call.Name]
+	if !ok {
+		return fmt.Sprintf("error: tool %s is not enabled", call.Name)
+	}
+	args := json.RawMessage(call.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	out, err := h(ctx, args)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return out
+}
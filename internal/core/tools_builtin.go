@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"time"
+
+	"gollm-mini/internal/types"
+)
+
+// 内置工具：current_time / calculator
+
+func init() {
+	RegisterTool(types.Tool{
+		Name:        "current_time",
+		Description: "Get the current date and time, optionally in an IANA time zone such as Asia/Shanghai.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"timezone":{"type":"string","description":"IANA time zone name"}}}`),
+	}, currentTime)
+
+	RegisterTool(types.Tool{
+		Name:        "calculator",
+		Description: "Evaluate an arithmetic expression with + - * / and parentheses.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string","description":"e.g. (3+4)*2.5"}},"required":["expression"]}`),
+	}, calculator)
+}
+
+func currentTime(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Timezone string `json:"timezone"`
+	}
+	_ = json.Unmarshal(args, &in)
+	loc := time.Local
+	if in.Timezone != "" {
+		l, err := time.LoadLocation(in.Timezone)
+		if err != nil {
+			return "", err
+		}
+		loc = l
+	}
+	return time.Now().In(loc).Format(time.RFC3339), nil
+}
+
+func calculator(_ context.Context, args json.RawMessage) (string, error) {
+	var in struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	expr, err := parser.ParseExpr(in.Expression)
+	if err != nil {
+		return "", fmt.Errorf("invalid expression: %w", err)
+	}
+	v, err := evalExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64), nil
+}
+
+// evalExpr 只允许数字、四则运算与括号，按 float64 计算
+func evalExpr(e ast.Expr) (float64, error) {
+	switch n := e.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return 0, fmt.Errorf("unsupported literal %s", n.Value)
+		}
+		return strconv.ParseFloat(n.Value, 64)
+	case *ast.ParenExpr:
+		return evalExpr(n.X)
+	case *ast.UnaryExpr:
+		x, err := evalExpr(n.X)
+		if err != nil {
+			return 0, err
+		}
+		switch n.Op {
+		case token.SUB:
+			return -x, nil
+		case token.ADD:
+			return x, nil
+		}
+	case *ast.BinaryExpr:
+		x, err := evalExpr(n.X)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalExpr(n.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch n.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return x / y, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported expression")
+}
@@ -0,0 +1,13 @@
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// NewID 生成带前缀的随机 ID，如 chatcmpl-3f2a…
+func NewID(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -1,19 +1,12 @@
 package helper
 
-// 单位：USD / 1K tokens
-var priceTable = map[string]struct {
-	Prompt, Completion float64
-}{
-	"openai:gpt-4o-mini":   {0.005, 0.015},
-	"openai:gpt-3.5-turbo": {0.0005, 0.0015},
-	// 本地 Ollama 视为 0
-}
+import "gollm-mini/internal/catalog"
 
+// CalcCost 按模型目录中的单价计算 USD；未登记的模型视为 0
 func CalcCost(provider, model string, promptTok, compTok int) float64 {
-	key := provider + ":" + model
-	p, ok := priceTable[key]
+	m, ok := catalog.Lookup(provider, model)
 	if !ok {
 		return 0
 	}
-	return (float64(promptTok)*p.Prompt + float64(compTok)*p.Completion) / 1000
+	return m.Cost(promptTok, compTok)
 }
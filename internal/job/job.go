@@ -0,0 +1,325 @@
+// Package job 异步任务：请求先落库再由后台 worker 执行，进程重启后未完成的任务重新排队。
+// 任务结束后可把结果 POST 到 webhook。具体怎么执行由调用方通过 Runner 提供（见 server）
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/types"
+)
+
+// 任务类型
+const (
+	KindChat       = "chat"       // payload 同 POST /chat（不流式）
+	KindStructured = "structured" // 同 /chat，必须带 schema
+	KindOptimizer  = "optimizer"  // payload 同 POST /optimizer
+	KindBatch      = "batch"      // 逐行批量生成，结果写入 JSONL（见 batch）
+)
+
+// Kinds 全部任务类型
+var Kinds = []string{KindChat, KindStructured, KindOptimizer, KindBatch}
+
+// 任务状态；succeeded / failed / cancelled 为终态
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+)
+
+// Progress 已完成 / 总步数；chat 为 1 步，optimizer 每个 variant 一步，batch 每行一步
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Delivery webhook 投递结果
+type Delivery struct {
+	Status   string    `json:"status"` // delivered / failed
+	Attempts int       `json:"attempts"`
+	Code     int       `json:"code,omitempty"` // 最后一次的 HTTP 状态码
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Job 一个异步任务
+type Job struct {
+	ID       string          `json:"id"`
+	Kind     string          `json:"type"`
+	Tenant   string          `json:"tenant,omitempty"`
+	KeyID    string          `json:"key_id,omitempty"` // 提交任务的 API Key，执行时计费
+	Status   string          `json:"status"`
+	Progress Progress        `json:"progress"`
+	Payload  json.RawMessage `json:"payload"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Usage    types.Usage     `json:"usage"`
+	Error    string          `json:"error,omitempty"`
+	Runs     int             `json:"runs"` // 执行次数；重启后重新执行会递增
+
+	Webhook  string    `json:"webhook,omitempty"`
+	Delivery *Delivery `json:"delivery,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished 是否已到终态
+func (j Job) Finished() bool {
+	switch j.Status {
+	case StatusSucceeded, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+const dbName = "jobs"
+
+var bucketJobs = []byte("jobs") // id → Job
+
+var (
+	db    storage.DB
+	dbErr error
+	once  sync.Once
+)
+
+func open() (storage.DB, error) {
+	once.Do(func() {
+		if db, dbErr = storage.Open(dbName); dbErr != nil {
+			return
+		}
+		dbErr = db.Update(func(tx storage.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bucketJobs)
+			return err
+		})
+	})
+	return db, dbErr
+}
+
+// Open 打开任务库，启动时调用以尽早暴露错误
+func Open() error {
+	_, err := open()
+	return err
+}
+
+func view(fn func(tx storage.Tx) error) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.View(fn)
+}
+
+func update(fn func(tx storage.Tx) error) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.Update(fn)
+}
+
+func getJob(tx storage.Tx, id string) (Job, error) {
+	var j Job
+	data := tx.Bucket(bucketJobs).Get([]byte(id))
+	if data == nil {
+		return j, ErrNotFound
+	}
+	return j, json.Unmarshal(data, &j)
+}
+
+func putJob(tx storage.Tx, j Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketJobs).Put([]byte(j.ID), data)
+}
+
+// modify 在一个事务内读取、修改并写回任务
+func modify(id string, fn func(j *Job) error) (Job, error) {
+	var out Job
+	err := update(func(tx storage.Tx) error {
+		j, err := getJob(tx, id)
+		if err != nil {
+			return err
+		}
+		out = j
+		if err := fn(&j); err != nil {
+			return err // out 为修改前的任务
+		}
+		out = j
+		return putJob(tx, j)
+	})
+	return out, err
+}
+
+// Validate 检查任务类型与 webhook 地址
+func Validate(j Job) error {
+	known := false
+	for _, k := range Kinds {
+		known = known || j.Kind == k
+	}
+	if !known {
+		return fmt.Errorf("unknown job type %q (chat / structured / optimizer / batch)", j.Kind)
+	}
+	if len(j.Payload) == 0 {
+		return errors.New("payload is required")
+	}
+	if j.Webhook != "" {
+		u, err := url.Parse(j.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook url %q", j.Webhook)
+		}
+		return checkWebhookHost(u.Hostname())
+	}
+	return nil
+}
+
+// Submit 保存新任务并排队
+func Submit(j Job) (Job, error) {
+	if err := Validate(j); err != nil {
+		return Job{}, err
+	}
+	j.ID = helper.NewID("job-")
+	j.Status = StatusQueued
+	j.CreatedAt = time.Now()
+	j.Result, j.Error, j.Delivery, j.StartedAt, j.FinishedAt = nil, "", nil, nil, nil
+	if err := update(func(tx storage.Tx) error { return putJob(tx, j) }); err != nil {
+		return Job{}, err
+	}
+	enqueue(j.ID)
+	return j, nil
+}
+
+// Get 按 ID 读取任务
+func Get(id string) (Job, error) {
+	var j Job
+	err := view(func(tx storage.Tx) error {
+		var err error
+		j, err = getJob(tx, id)
+		return err
+	})
+	return j, err
+}
+
+// List 租户的任务，按创建时间从新到旧；limit <= 0 不限
+func List(t string, limit int) ([]Job, error) {
+	var out []Job
+	err := view(func(tx storage.Tx) error {
+		return tx.Bucket(bucketJobs).ForEach(func(_, v []byte) error {
+			var j Job
+			if err := json.Unmarshal(v, &j); err != nil {
+				return err
+			}
+			if j.Tenant == t {
+				out = append(out, j)
+			}
+			return nil
+		})
+	})
+	sort.Slice(out, func(a, b int) bool { return out[a].CreatedAt.After(out[b].CreatedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, err
+}
+
+// Tenants 各租户的任务数
+func Tenants() (map[string]int, error) {
+	list, err := all()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int{}
+	for _, j := range list {
+		out[j.Tenant]++
+	}
+	return out, nil
+}
+
+// all 全部任务，按创建时间从旧到新
+func all() ([]Job, error) {
+	var out []Job
+	err := view(func(tx storage.Tx) error {
+		return tx.Bucket(bucketJobs).ForEach(func(_, v []byte) error {
+			var j Job
+			if err := json.Unmarshal(v, &j); err != nil {
+				return err
+			}
+			out = append(out, j)
+			return nil
+		})
+	})
+	sort.Slice(out, func(a, b int) bool { return out[a].CreatedAt.Before(out[b].CreatedAt) })
+	return out, err
+}
+
+// Cancel 取消任务：排队中的直接结束，执行中的中止执行；已结束返回 ErrFinished
+func Cancel(id string) (Job, error) {
+	j, err := modify(id, func(j *Job) error {
+		switch {
+		case j.Finished():
+			return ErrFinished
+		case j.Status == StatusQueued:
+			now := time.Now()
+			j.Status, j.FinishedAt = StatusCancelled, &now
+		}
+		return nil
+	})
+	if err != nil {
+		return j, err
+	}
+	if j.Status == StatusCancelled {
+		go deliver(j.ID)
+		return j, nil
+	}
+	abort(id)
+	return j, nil
+}
+
+// DeleteTenant 删除租户的全部任务，执行中的任务会被中止
+func DeleteTenant(t string) (int, error) {
+	var ids []string
+	err := update(func(tx storage.Tx) error {
+		b := tx.Bucket(bucketJobs)
+		if err := b.ForEach(func(k, v []byte) error {
+			var j Job
+			if err := json.Unmarshal(v, &j); err != nil {
+				return err
+			}
+			if j.Tenant == t {
+				ids = append(ids, string(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		abort(id)
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,93 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := storage.Configure(storage.Config{Backend: storage.Memory}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// 刚转为 running 就取消，任务也一定会被中止
+func TestCancelAsSoonAsRunning(t *testing.T) {
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	block := func(ctx context.Context, _ Job, _ func(int, int)) (any, types.Usage, error) {
+		<-ctx.Done()
+		return nil, types.Usage{}, ctx.Err()
+	}
+	if err := Start(ctx, 2, block); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		j, err := Submit(Job{Kind: KindChat, Payload: json.RawMessage(`{}`)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			cur, _ := Get(j.ID)
+			if cur.Status == StatusRunning {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job %s never started: %s", j.ID, cur.Status)
+			}
+		}
+		if _, err := Cancel(j.ID); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			cur, _ := Get(j.ID)
+			if cur.Status == StatusCancelled {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job %s not cancelled: %s", j.ID, cur.Status)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// 本机、内网与链路本地地址的 webhook 在提交与连接时都被拒绝，AllowWebhookNets 可放行
+func TestWebhookAddress(t *testing.T) {
+	for _, u := range []string{"http://127.0.0.1:9/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://localhost/hook"} {
+		err := Validate(Job{Kind: KindChat, Payload: json.RawMessage(`{}`), Webhook: u})
+		if !errors.Is(err, ErrWebhookAddr) {
+			t.Errorf("%s: err %v, want ErrWebhookAddr", u, err)
+		}
+	}
+	if err := Validate(Job{Kind: KindChat, Payload: json.RawMessage(`{}`), Webhook: "https://93.184.216.34/hook"}); err != nil {
+		t.Errorf("public address: %v", err)
+	}
+
+	got := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got++ }))
+	defer srv.Close()
+	if _, err := post(srv.URL, "job-x", []byte(`{}`)); !errors.Is(err, ErrWebhookAddr) || got != 0 {
+		t.Errorf("dial loopback: err %v, %d requests", err, got)
+	}
+
+	if err := AllowWebhookNets([]string{"127.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	defer AllowWebhookNets(nil)
+	if _, err := post(srv.URL, "job-x", []byte(`{}`)); err != nil || got != 1 {
+		t.Errorf("allowlisted: err %v, %d requests", err, got)
+	}
+}
@@ -0,0 +1,183 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/types"
+)
+
+// Runner 执行一个任务，返回可 JSON 编码的结果与累计用量；progress 报告进度
+type Runner func(ctx context.Context, j Job, progress func(done, total int)) (result any, usage types.Usage, err error)
+
+var (
+	qmu     sync.Mutex
+	queue   []string                          // 待执行的任务 ID
+	running = map[string]context.CancelFunc{} // 执行中的任务
+	wake    = make(chan struct{}, 1)
+)
+
+func enqueue(id string) {
+	qmu.Lock()
+	queue = append(queue, id)
+	qmu.Unlock()
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func dequeue() (string, bool) {
+	qmu.Lock()
+	defer qmu.Unlock()
+	if len(queue) == 0 {
+		return "", false
+	}
+	id := queue[0]
+	queue = queue[1:]
+	return id, true
+}
+
+func abort(id string) {
+	qmu.Lock()
+	defer qmu.Unlock()
+	if cancel, ok := running[id]; ok {
+		cancel()
+	}
+}
+
+// Start 恢复上次未完成的任务并启动 workers 个 worker，ctx 结束时停止。
+// 执行中被停止的任务回到 queued，下次启动时重新执行；未投递的 webhook 也会补投
+func Start(ctx context.Context, workers int, run Runner) error {
+	list, err := all()
+	if err != nil {
+		return err
+	}
+	for _, j := range list {
+		switch {
+		case j.Status == StatusRunning:
+			if _, err := modify(j.ID, func(j *Job) error {
+				j.Status, j.StartedAt = StatusQueued, nil
+				return nil
+			}); err != nil {
+				return err
+			}
+			enqueue(j.ID)
+		case j.Status == StatusQueued:
+			enqueue(j.ID)
+		case j.Finished() && j.Webhook != "" && j.Delivery == nil:
+			go deliver(j.ID)
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go work(ctx, run)
+	}
+	return nil
+}
+
+func work(ctx context.Context, run Runner) {
+	for {
+		id, ok := dequeue()
+		if !ok {
+			select {
+			case <-wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		execute(ctx, id, run)
+		select { // 队列里可能还有任务，唤醒其他 worker
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func execute(base context.Context, id string, run Runner) {
+	// 先登记 cancel 再转为 running：Cancel 看到 running 时 abort 一定能找到它
+	ctx, cancel := context.WithCancel(base)
+	defer cancel()
+	qmu.Lock()
+	running[id] = cancel
+	qmu.Unlock()
+	defer func() {
+		qmu.Lock()
+		delete(running, id)
+		qmu.Unlock()
+	}()
+
+	j, err := modify(id, func(j *Job) error {
+		if j.Status != StatusQueued {
+			return ErrFinished // 排队期间被取消
+		}
+		now := time.Now()
+		j.Status, j.StartedAt = StatusRunning, &now
+		j.Runs++
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrFinished) {
+			log.Printf("[JOB] %s: %v", id, err)
+		}
+		return
+	}
+
+	progress := func(done, total int) {
+		if _, err := modify(id, func(j *Job) error {
+			j.Progress = Progress{Done: done, Total: total}
+			return nil
+		}); err != nil {
+			log.Printf("[JOB] %s progress: %v", id, err)
+		}
+	}
+	result, usage, err := run(ctx, j, progress)
+
+	if base.Err() != nil {
+		// 进程退出：保留为 queued，重启后重新执行
+		if _, e := modify(id, func(j *Job) error {
+			j.Status, j.StartedAt, j.Usage = StatusQueued, nil, usage
+			return nil
+		}); e != nil {
+			log.Printf("[JOB] %s requeue: %v", id, e)
+		}
+		return
+	}
+
+	var data json.RawMessage
+	if err == nil && result != nil {
+		if data, err = json.Marshal(result); err != nil {
+			data = nil
+		}
+	}
+	j, e := modify(id, func(j *Job) error {
+		now := time.Now()
+		j.FinishedAt, j.Usage = &now, usage
+		switch {
+		case err == nil:
+			j.Status, j.Result = StatusSucceeded, data
+			j.Progress.Done = j.Progress.Total
+		case errors.Is(err, context.Canceled):
+			j.Status = StatusCancelled
+		default:
+			j.Status, j.Error = StatusFailed, err.Error()
+		}
+		return nil
+	})
+	if e != nil {
+		log.Printf("[JOB] %s: %v", id, e)
+		return
+	}
+	log.Printf("[JOB] %s type=%s status=%s prompt=%d completion=%d", j.ID, j.Kind, j.Status, usage.PromptTokens, usage.CompletionTokens)
+	deliver(id)
+}
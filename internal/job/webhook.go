@@ -0,0 +1,161 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// webhook 投递：最多 webhookAttempts 次，间隔 1s / 2s / 4s …
+const (
+	webhookAttempts = 4
+	webhookTimeout  = 10 * time.Second
+)
+
+// ErrWebhookAddr webhook 指向本机、内网或链路本地地址（未经 AllowWebhookNets 放行）
+var ErrWebhookAddr = errors.New("webhook address not allowed")
+
+// webhookClient 在建立连接时检查实际连接的 IP，DNS 重绑定与重定向也绕不过去；不走代理
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: webhookTimeout, Control: checkWebhookDial}).DialContext,
+	},
+}
+
+var (
+	allowMu   sync.RWMutex
+	allowNets []*net.IPNet
+)
+
+// AllowWebhookNets 放行 cidrs 中的地址（如内网的回调服务）；默认只允许公网地址，nil 恢复默认
+func AllowWebhookNets(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("webhook allowlist: %w", err)
+		}
+		nets = append(nets, n)
+	}
+	allowMu.Lock()
+	allowNets = nets
+	allowMu.Unlock()
+	return nil
+}
+
+func webhookIPAllowed(ip net.IP) bool {
+	allowMu.RLock()
+	defer allowMu.RUnlock()
+	for _, n := range allowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
+
+// checkWebhookHost 提交时解析 host，任一地址不允许即拒绝
+func checkWebhookHost(host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !webhookIPAllowed(ip) {
+			return fmt.Errorf("%w: %s", ErrWebhookAddr, host)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("webhook host %s: %w", host, err)
+	}
+	for _, a := range addrs {
+		if !webhookIPAllowed(a.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrWebhookAddr, host, a.IP)
+		}
+	}
+	return nil
+}
+
+// checkWebhookDial net.Dialer.Control：address 为解析后的 ip:port
+func checkWebhookDial(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !webhookIPAllowed(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddr, host)
+	}
+	return nil
+}
+
+// deliver 把已结束的任务 POST 到 webhook（不含 payload），结果记在 Delivery 中
+func deliver(id string) {
+	j, err := Get(id)
+	if err != nil || j.Webhook == "" || !j.Finished() || j.Delivery != nil {
+		return
+	}
+	j.Payload = nil
+	body, err := json.Marshal(j)
+	if err != nil {
+		log.Printf("[JOB] %s webhook: %v", id, err)
+		return
+	}
+
+	d := Delivery{Status: "failed"}
+	wait := time.Second
+	for d.Attempts < webhookAttempts {
+		if d.Attempts > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		d.Attempts++
+		code, err := post(j.Webhook, id, body)
+		d.Code, d.Error = code, ""
+		if err == nil {
+			d.Status = "delivered"
+			break
+		}
+		d.Error = err.Error()
+		if (code >= 400 && code < 500 && code != http.StatusTooManyRequests) || errors.Is(err, ErrWebhookAddr) {
+			break // 对方拒收或地址不允许，不再重试
+		}
+	}
+	d.At = time.Now()
+	if d.Status != "delivered" {
+		log.Printf("[JOB] %s webhook %s: %s", id, j.Webhook, d.Error)
+	}
+	if _, err := modify(id, func(j *Job) error {
+		j.Delivery = &d
+		return nil
+	}); err != nil {
+		log.Printf("[JOB] %s webhook: %v", id, err)
+	}
+}
+
+func post(url, id string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Job-ID", id)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tokenizer"
+	"gollm-mini/internal/types"
+	"gollm-mini/internal/window"
+)
+
+const archivePrefix = "archive_"
+
+// CompactPolicy 压缩策略：会话超过 Threshold 个 token 时，
+// 除开头的 system 与最近 KeepRecent 条消息外，其余替换为一条摘要
+type CompactPolicy struct {
+	Threshold  int           `json:"threshold" yaml:"threshold"`
+	KeepRecent int           `json:"keep_recent" yaml:"keep_recent"`
+	Every      time.Duration `json:"every" yaml:"every"` // 自动任务的扫描间隔，0 关闭
+}
+
+var DefaultCompactPolicy = CompactPolicy{Threshold: 4000, KeepRecent: 6, Every: 10 * time.Minute}
+
+// CompactResult 一次压缩的结果
+type CompactResult struct {
+	SessionID    string `json:"session_id"`
+	Compacted    bool   `json:"compacted"`
+	TokensBefore int    `json:"tokens_before"`
+	TokensAfter  int    `json:"tokens_after"`
+	Archived     int    `json:"archived"` // 移入归档的消息数
+}
+
+// ArchiveEntry 归档桶中的一条记录
+type ArchiveEntry struct {
+	CompactedAt time.Time       `json:"compacted_at"`
+	Messages    []types.Message `json:"messages"`
+}
+
+// ErrNotFound 会话不存在
+var ErrNotFound = errors.New("session not found")
+
+// ErrSessionChanged 摘要期间会话切换了分支（重新生成、编辑、checkout 等），本次压缩放弃
+var ErrSessionChanged = errors.New("session changed during compaction")
+
+func archiveName(id string) []byte { return nsName(id, archivePrefix) }
+
+// Compact 压缩会话的当前分支；force 为 true 时忽略 Threshold。
+// 摘要节点接在开头的 system 之后，保留的尾部改挂到摘要下；被摘要的节点仍留在树中，
+// 从它们分出的其他分支不受影响。摘要调用在事务外进行，期间在分支末尾追加的消息会原样保留，
+// Head 离开原分支时返回 ErrSessionChanged
+func Compact(ctx context.Context, id string, p CompactPolicy, summarize window.Summarizer, force bool) (CompactResult, error) {
+	res := CompactResult{SessionID: id}
+	if p.KeepRecent <= 0 {
+		p.KeepRecent = DefaultCompactPolicy.KeepRecent
+	}
+
+	t, err := GetTree(id)
+	if err != nil {
+		return res, err
+	}
+	path, hist := t.Path(), t.Messages()
+	tk := tokenizer.ForModel("")
+	res.TokensBefore = tokenizer.CountMessages(tk, hist)
+	res.TokensAfter = res.TokensBefore
+	if !force && res.TokensBefore <= p.Threshold {
+		return res, nil
+	}
+
+	// 开头的 system（不含旧摘要）保留；旧摘要作为滚动摘要的起点
+	head, prev := 0, ""
+	for head < len(hist) && hist[head].Role == types.RoleSystem {
+		if s, ok := strings.CutPrefix(hist[head].Content, window.SummaryPrefix); ok {
+			prev = s
+			break
+		}
+		head++
+	}
+	from := head
+	if prev != "" {
+		from++
+	}
+	// 保留的尾部从 user 消息开始，避免工具结果或回答失去上文
+	cut := len(hist) - p.KeepRecent
+	for cut > from && hist[cut].Role != types.RoleUser {
+		cut--
+	}
+	if cut <= from {
+		return res, nil // 没有可压缩的轮次
+	}
+	old := hist[from:cut]
+
+	summary, err := summarize(ctx, prev, old)
+	if err != nil {
+		return res, err
+	}
+
+	var compacted []types.Message
+	err = update(func(tx storage.Tx) error {
+		b := tx.Bucket(bucketName(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		cur, err := loadTree(b)
+		if err != nil {
+			return err
+		}
+		// 只接受在原分支末尾追加：原路径必须仍是当前路径的前缀
+		now := cur.Path()
+		if len(now) < len(path) || !slices.Equal(now[:len(path)], path) {
+			return ErrSessionChanged
+		}
+		parent := -1
+		if head > 0 {
+			parent = path[head-1]
+		}
+		sum := len(cur.Nodes)
+		cur.Nodes = append(cur.Nodes, Node{
+			ID: sum, Parent: parent, CreatedAt: time.Now(),
+			Message: types.Message{Role: types.RoleSystem, Content: window.SummaryPrefix + summary},
+		})
+		cur.Nodes[path[cut]].Parent = sum
+		if err := saveTree(b, cur); err != nil {
+			return err
+		}
+		compacted = cur.Messages()
+
+		ab, err := tx.CreateBucketIfNotExists(archiveName(id))
+		if err != nil {
+			return err
+		}
+		seq, _ := ab.NextSequence()
+		entry, err := json.Marshal(ArchiveEntry{CompactedAt: time.Now(), Messages: old})
+		if err != nil {
+			return err
+		}
+		return ab.Put(seqKey(seq), entry)
+	})
+	if err != nil {
+		return res, err
+	}
+
+	res.Compacted = true
+	res.Archived = len(old)
+	res.TokensAfter = tokenizer.CountMessages(tk, compacted)
+	return res, nil
+}
+
+// Archive 返回会话被压缩掉的原始消息，按压缩先后排列
+func Archive(id string) ([]ArchiveEntry, error) {
+	var out []ArchiveEntry
+	err := view(func(tx storage.Tx) error {
+		b := tx.Bucket(archiveName(id))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var e ArchiveEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			out = append(out, e)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// RunCompactor 每隔 p.Every 扫描所有会话并压缩超过阈值的，直到 ctx 结束
+func RunCompactor(ctx context.Context, p CompactPolicy, summarize window.Summarizer) {
+	if p.Every <= 0 {
+		return
+	}
+	t := time.NewTicker(p.Every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		ids, err := Sessions()
+		if err != nil {
+			log.Printf("[COMPACT] list sessions: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			res, err := Compact(ctx, id, p, summarize, false)
+			if err != nil {
+				log.Printf("[COMPACT] session=%s error=%v", id, err)
+				continue
+			}
+			if res.Compacted {
+				log.Printf("[COMPACT] session=%s tokens=%d->%d archived=%d", id, res.TokensBefore, res.TokensAfter, res.Archived)
+			}
+		}
+	}
+}
+
+func seqKey(n uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, n)
+	return k
+}
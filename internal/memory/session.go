@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+// SessionInfo 会话概要
+type SessionInfo struct {
+	ID        string    `json:"session_id"`
+	Messages  int       `json:"messages"`
+	UpdatedAt time.Time `json:"updated_at"` // 旧数据没有记录时为零值
+}
+
+// Session 导出 / 导入的完整会话，JSONL 每行一个
+type Session struct {
+	ID        string          `json:"session_id"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Messages  []types.Message `json:"messages"`
+	Archive   []ArchiveEntry  `json:"archive,omitempty"`
+}
+
+// ImportResult 导入统计
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"` // 已存在且未要求覆盖
+}
+
+// Sessions 返回全部租户的会话 ID，租户会话带 "@<tenant>/" 前缀
+func Sessions() ([]string, error) {
+	var ids []string
+	err := view(func(tx storage.Tx) error {
+		return tx.ForEachBucket(func(name []byte) error {
+			t, rest := tenant.Split(string(name))
+			if id, ok := strings.CutPrefix(rest, bucketPrefix); ok {
+				ids = append(ids, tenant.Prefix(t)+id)
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// sessionsOf 租户 t 的会话 ID（带前缀）
+func sessionsOf(t string) ([]string, error) {
+	all, err := Sessions()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, id := range all {
+		if owner, _ := tenant.Split(id); owner == t {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Tenants 各租户（含默认租户）的会话数
+func Tenants() (map[string]int, error) {
+	ids, err := Sessions()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int{}
+	for _, id := range ids {
+		t, _ := tenant.Split(id)
+		out[t]++
+	}
+	return out, nil
+}
+
+// DeleteTenant 删除租户 t 的全部会话与归档，返回删除的会话数
+func DeleteTenant(t string) (int, error) {
+	ids, err := sessionsOf(t)
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := Delete(id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// List 按最近更新排序分页返回租户 t 的会话概要，total 为会话总数；ID 不含租户前缀
+func List(t string, offset, limit int) (list []SessionInfo, total int, err error) {
+	ids, err := sessionsOf(t)
+	if err != nil {
+		return nil, 0, err
+	}
+	// 先迁移旧格式，保证计数准确
+	for _, id := range ids {
+		if _, _, err := readHistory(id); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	err = view(func(tx storage.Tx) error {
+		for _, id := range ids {
+			b := tx.Bucket(bucketName(id))
+			if b == nil {
+				continue
+			}
+			_, local := tenant.Split(id)
+			info := SessionInfo{ID: local}
+			var hist []json.RawMessage
+			if err := json.Unmarshal(b.Get(keyHistory), &hist); err == nil {
+				info.Messages = len(hist)
+			}
+			_ = info.UpdatedAt.UnmarshalText(b.Get(keyUpdated))
+			list = append(list, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].UpdatedAt.Equal(list[j].UpdatedAt) {
+			return list[i].UpdatedAt.After(list[j].UpdatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	total = len(list)
+	if offset >= total {
+		return []SessionInfo{}, total, nil
+	}
+	list = list[offset:]
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	return list, total, nil
+}
+
+// Get 返回会话完整历史（不截断）；Session.ID 不含租户前缀
+func Get(id string) (Session, error) {
+	msgs, ok, err := readHistory(id)
+	if err != nil {
+		return Session{}, err
+	}
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	_, local := tenant.Split(id)
+	s := Session{ID: local, Messages: msgs}
+	err = view(func(tx storage.Tx) error {
+		if b := tx.Bucket(bucketName(id)); b != nil {
+			_ = s.UpdatedAt.UnmarshalText(b.Get(keyUpdated))
+		}
+		return nil
+	})
+	return s, err
+}
+
+// Export 把租户 t 的会话（含归档）写成 JSONL；ids 为不含前缀的会话 ID，为空时导出全部。
+// 导出内容不含租户前缀，可导入到任意租户
+func Export(w io.Writer, t string, ids ...string) error {
+	if len(ids) == 0 {
+		var err error
+		if ids, err = sessionsOf(t); err != nil {
+			return err
+		}
+	} else {
+		for i, id := range ids {
+			qid, err := tenant.Qualify(t, id)
+			if err != nil {
+				return fmt.Errorf("export %s: %w", id, err)
+			}
+			ids[i] = qid
+		}
+	}
+	enc := json.NewEncoder(w)
+	for _, id := range ids {
+		s, err := Get(id)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", id, err)
+		}
+		if s.Archive, err = Archive(id); err != nil {
+			return fmt.Errorf("export %s: %w", id, err)
+		}
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import 把 Export 产生的 JSONL 导入租户 t；已存在的会话仅在 overwrite 时替换
+func Import(r io.Reader, t string, overwrite bool) (ImportResult, error) {
+	var res ImportResult
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var s Session
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+		if s.ID == "" {
+			return res, fmt.Errorf("line %d: session_id is required", line)
+		}
+		qid, err := tenant.Qualify(t, s.ID)
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+		imported, err := importSession(qid, s, overwrite)
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+		if imported {
+			res.Imported++
+		} else {
+			res.Skipped++
+		}
+	}
+	return res, sc.Err()
+}
+
+func importSession(id string, s Session, overwrite bool) (bool, error) {
+	imported := false
+	err := update(func(tx storage.Tx) error {
+		if tx.Bucket(bucketName(id)) != nil {
+			if !overwrite {
+				return nil
+			}
+			if err := tx.DeleteBucket(bucketName(id)); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(archiveName(id)) != nil {
+			if err := tx.DeleteBucket(archiveName(id)); err != nil {
+				return err
+			}
+		}
+
+		b, err := tx.CreateBucket(bucketName(id))
+		if err != nil {
+			return err
+		}
+		if err := writeHistory(b, s.Messages); err != nil {
+			return err
+		}
+		if !s.UpdatedAt.IsZero() { // 保留原始更新时间
+			ts, _ := s.UpdatedAt.UTC().MarshalText()
+			if err := b.Put(keyUpdated, ts); err != nil {
+				return err
+			}
+		}
+
+		if len(s.Archive) > 0 {
+			ab, err := tx.CreateBucket(archiveName(id))
+			if err != nil {
+				return err
+			}
+			for _, e := range s.Archive {
+				data, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+				seq, _ := ab.NextSequence()
+				if err := ab.Put(seqKey(seq), data); err != nil {
+					return err
+				}
+			}
+		}
+		imported = true
+		return nil
+	})
+	return imported, err
+}
@@ -1,80 +1,206 @@
 package memory
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	bolt "go.etcd.io/bbolt"
-	"gollm-mini/internal/helper"
+	"errors"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/tokenizer"
 	"gollm-mini/internal/types"
+	"gollm-mini/internal/window"
 	"sync"
+	"time"
 )
 
 const (
-	dbPath       = "memory.db"
+	dbName       = "memory"
 	maxCtxTok    = 3000
 	bucketPrefix = "session_"
 )
 
+// 会话桶内的键；其余键都是旧格式的逐条消息
 var (
-	db   *bolt.DB
-	once sync.Once
+	keyHistory = []byte("history")
+	keyUpdated = []byte("updated_at")
 )
 
-func open() *bolt.DB {
+var (
+	db    storage.DB
+	dbErr error
+	once  sync.Once
+)
+
+// Strategy Load 超出 maxCtxTok 时的裁剪策略，默认保留 system 与最近一轮
+var Strategy window.Strategy = window.Default
+
+func open() (storage.DB, error) {
 	once.Do(func() {
-		db, _ = bolt.Open(dbPath, 0600, nil)
+		db, dbErr = storage.Open(dbName)
 	})
-	return db
+	return db, dbErr
+}
+
+// Open 打开会话库，启动时调用以尽早暴露错误
+func Open() error {
+	_, err := open()
+	return err
 }
 
-func bucketName(id string) []byte { return []byte(bucketPrefix + id) }
+func view(fn func(tx storage.Tx) error) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.View(fn)
+}
+
+func update(fn func(tx storage.Tx) error) error {
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	return db.Update(fn)
+}
+
+// bucketName 会话桶名；租户会话的 id 形如 "@acme/sess-1"（见 tenant.Qualify），桶名为 "@acme/session_sess-1"
+func bucketName(id string) []byte { return nsName(id, bucketPrefix) }
+
+func nsName(id, prefix string) []byte {
+	t, local := tenant.Split(id)
+	return []byte(tenant.Prefix(t) + prefix + local)
+}
 
 // Load returns history truncated to maxCtxTok tokens (oldest first)
 func Load(id string) ([]types.Message, error) {
-	var msgs []types.Message
-	db := open()
-	err := db.View(func(tx *bolt.Tx) error {
+	msgs, _, err := readHistory(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 截断
+	res, err := Strategy.Apply(context.Background(), msgs, maxCtxTok, tokenizer.ForModel(""))
+	return res.Messages, err
+}
+
+// readHistory 读取完整历史；ok 表示会话存在。遇到旧格式时顺带迁移到 history 键
+func readHistory(id string) (msgs []types.Message, ok bool, err error) {
+	legacy := false
+	err = view(func(tx storage.Tx) error {
 		b := tx.Bucket(bucketName(id))
 		if b == nil {
 			return nil
 		}
-
-		// 新格式：整个对话历史保存在 history
-		if data := b.Get([]byte("history")); data != nil {
-			return json.Unmarshal(data, &msgs)
+		ok = true
+		legacy = b.Get(keyHistory) == nil
+		msgs, err = decodeHistory(b)
+		return err
+	})
+	if err != nil || !legacy {
+		return msgs, ok, err
+	}
+	err = update(func(tx storage.Tx) error {
+		b := tx.Bucket(bucketName(id))
+		if b == nil || b.Get(keyHistory) != nil {
+			return nil // 已被并发迁移或删除
+		}
+		if msgs, err = decodeHistory(b); err != nil {
+			return err
 		}
+		return writeHistory(b, msgs)
+	})
+	return msgs, ok, err
+}
 
-		// 兼容旧格式：逐条存
-		return b.ForEach(func(_, v []byte) error {
-			var m types.Message
-			if err := json.Unmarshal(v, &m); err != nil {
-				return err
-			}
-			msgs = append(msgs, m)
+func decodeHistory(b storage.Bucket) ([]types.Message, error) {
+	var msgs []types.Message
+
+	// 新格式：整个对话历史保存在 history
+	if data := b.Get(keyHistory); data != nil {
+		return msgs, json.Unmarshal(data, &msgs)
+	}
+
+	// 兼容旧格式：逐条存
+	err := b.ForEach(func(k, v []byte) error {
+		if isMetaKey(k) {
 			return nil
-		})
+		}
+		var m types.Message
+		if err := json.Unmarshal(v, &m); err != nil {
+			return err
+		}
+		msgs = append(msgs, m)
+		return nil
 	})
+	return msgs, err
+}
 
-	// 截断
-	return helper.TruncateMessages(msgs, maxCtxTok), err
+func isMetaKey(k []byte) bool {
+	return bytes.Equal(k, keyHistory) || bytes.Equal(k, keyUpdated) || bytes.Equal(k, keyTree)
+}
+
+// writeHistory 覆盖 history、刷新 updated_at，并清掉旧格式的逐条键
+func writeHistory(b storage.Bucket, msgs []types.Message) error {
+	var legacy [][]byte
+	_ = b.ForEach(func(k, _ []byte) error {
+		if !isMetaKey(k) {
+			legacy = append(legacy, append([]byte{}, k...))
+		}
+		return nil
+	})
+	for _, k := range legacy {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(keyHistory, data); err != nil {
+		return err
+	}
+	ts, _ := time.Now().UTC().MarshalText()
+	return b.Put(keyUpdated, ts)
 }
 
 // Append writes user & assistant message pair
 func Append(sessionID string, msgs []types.Message) error {
-	return open().Update(func(tx *bolt.Tx) error {
-		b, _ := tx.CreateBucketIfNotExists([]byte(bucketPrefix + sessionID))
+	return update(func(tx storage.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName(sessionID))
+		if err != nil {
+			return err
+		}
 
-		// 读取旧历史
-		var hist []types.Message
-		_ = json.Unmarshal(b.Get([]byte("history")), &hist)
+		// 有分支的会话接在 Head 之后
+		if b.Get(keyTree) != nil {
+			t, err := loadTree(b)
+			if err != nil {
+				return err
+			}
+			for _, m := range msgs {
+				t.add(t.Head, m)
+			}
+			return saveTree(b, t)
+		}
 
-		hist = append(hist, msgs...)
-		data, _ := json.Marshal(hist)
-		return b.Put([]byte("history"), data)
+		// 读取旧历史（含旧格式）
+		hist, err := decodeHistory(b)
+		if err != nil {
+			return err
+		}
+		return writeHistory(b, append(hist, msgs...))
 	})
 }
 
+// Delete 删除会话及其归档
 func Delete(sessionID string) error {
-	return open().Update(func(tx *bolt.Tx) error {
+	return update(func(tx storage.Tx) error {
+		if err := tx.DeleteBucket(archiveName(sessionID)); err != nil && !errors.Is(err, storage.ErrBucketNotFound) {
+			return err
+		}
 		return tx.DeleteBucket(bucketName(sessionID))
 	})
 }
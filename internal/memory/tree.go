@@ -0,0 +1,286 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/types"
+)
+
+// 会话以消息树保存：每次重新生成 / 编辑都会长出新分支，Head 指向当前分支的末尾。
+// history 键始终是根到 Head 的路径，Load / List / Export 读到的都是当前分支。
+var keyTree = []byte("tree")
+
+// Node 树中的一条消息；Parent 为 -1 表示根
+type Node struct {
+	ID        int           `json:"id"`
+	Parent    int           `json:"parent"`
+	Message   types.Message `json:"message"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Tree 会话的全部分支；Nodes[i].ID == i，Head 为 -1 表示空会话
+type Tree struct {
+	Nodes []Node `json:"nodes"`
+	Head  int    `json:"head"`
+}
+
+var ErrNoUserTurn = errors.New("no user message on the active branch")
+
+// Path 根到 Head 的节点 ID
+func (t *Tree) Path() []int {
+	var ids []int
+	for id := t.Head; id >= 0; id = t.Nodes[id].Parent {
+		ids = append(ids, id)
+	}
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids
+}
+
+// Messages 当前分支的消息
+func (t *Tree) Messages() []types.Message {
+	path := t.Path()
+	out := make([]types.Message, len(path))
+	for i, id := range path {
+		out[i] = t.Nodes[id].Message
+	}
+	return out
+}
+
+// Children 某节点的直接子节点 ID
+func (t *Tree) Children(id int) []int {
+	var out []int
+	for _, n := range t.Nodes {
+		if n.Parent == id {
+			out = append(out, n.ID)
+		}
+	}
+	return out
+}
+
+func (t *Tree) add(parent int, m types.Message) int {
+	id := len(t.Nodes)
+	t.Nodes = append(t.Nodes, Node{ID: id, Parent: parent, Message: m, CreatedAt: time.Now()})
+	t.Head = id
+	return id
+}
+
+// lastUser 当前分支上最后一条 user 消息在路径中的下标
+func (t *Tree) lastUser(path []int) (int, error) {
+	for i := len(path) - 1; i >= 0; i-- {
+		if t.Nodes[path[i]].Message.Role == types.RoleUser {
+			return i, nil
+		}
+	}
+	return 0, ErrNoUserTurn
+}
+
+func linearTree(msgs []types.Message) Tree {
+	t := Tree{Head: -1}
+	for _, m := range msgs {
+		t.add(t.Head, m)
+	}
+	return t
+}
+
+// loadTree 没有 tree 键的会话按 history 视为一条直线
+func loadTree(b storage.Bucket) (Tree, error) {
+	if data := b.Get(keyTree); data != nil {
+		var t Tree
+		return t, json.Unmarshal(data, &t)
+	}
+	hist, err := decodeHistory(b)
+	if err != nil {
+		return Tree{}, err
+	}
+	return linearTree(hist), nil
+}
+
+func saveTree(b storage.Bucket, t Tree) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(keyTree, data); err != nil {
+		return err
+	}
+	return writeHistory(b, t.Messages())
+}
+
+// GetTree 返回会话的完整消息树
+func GetTree(id string) (Tree, error) {
+	var t Tree
+	err := view(func(tx storage.Tx) error {
+		b := tx.Bucket(bucketName(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		var err error
+		t, err = loadTree(b)
+		return err
+	})
+	return t, err
+}
+
+// updateTree 在事务中修改消息树并返回新的当前分支
+func updateTree(id string, fn func(t *Tree) error) ([]types.Message, error) {
+	var msgs []types.Message
+	err := update(func(tx storage.Tx) error {
+		b := tx.Bucket(bucketName(id))
+		if b == nil {
+			return ErrNotFound
+		}
+		t, err := loadTree(b)
+		if err != nil {
+			return err
+		}
+		if err := fn(&t); err != nil {
+			return err
+		}
+		msgs = t.Messages()
+		return saveTree(b, t)
+	})
+	return msgs, err
+}
+
+// Turn 分支操作准备好的一轮：Messages 为发给模型的上文，以 user 消息结尾。
+// 会话在 Save 之前保持不变，生成失败或被取消时不会留下改动
+type Turn struct {
+	Messages []types.Message
+	session  string
+	parent   int             // 新消息挂在该节点之下
+	pending  []types.Message // Save 时先于回答写入（编辑后的 user 消息）
+}
+
+// Save 把回答（连同 pending）挂到 parent 下，并把 Head 移到回答
+func (tn Turn) Save(reply string) error {
+	msgs := append(append([]types.Message{}, tn.pending...), types.Message{Role: types.RoleAssistant, Content: reply})
+	_, err := updateTree(tn.session, func(t *Tree) error {
+		if tn.parent >= len(t.Nodes) {
+			return fmt.Errorf("node %d does not exist", tn.parent)
+		}
+		parent := tn.parent
+		for _, m := range msgs {
+			parent = t.add(parent, m)
+		}
+		return nil
+	})
+	return err
+}
+
+// Regenerate 返回以当前分支最后一条 user 消息结尾的上文，不修改会话；
+// Save 的回答成为原回答的兄弟分支
+func Regenerate(id string) (Turn, error) {
+	t, err := GetTree(id)
+	if err != nil {
+		return Turn{}, err
+	}
+	path := t.Path()
+	i, err := t.lastUser(path)
+	if err != nil {
+		return Turn{}, err
+	}
+	return Turn{Messages: t.Messages()[:i+1], session: id, parent: path[i]}, nil
+}
+
+// Edit 以新内容替换当前分支第 index 条消息（从 0 计），原消息及其后续保留在旧分支。
+// 编辑 user 消息时不修改会话，返回以编辑后消息结尾的 Turn，回答 Save 时一并写入；
+// 其他消息立即写入新分支，返回的 Turn 仅含新分支
+func Edit(id string, index int, content string) (Turn, error) {
+	t, err := GetTree(id)
+	if err != nil {
+		return Turn{}, err
+	}
+	path := t.Path()
+	if index < 0 || index >= len(path) {
+		return Turn{}, fmt.Errorf("message index %d out of range [0,%d)", index, len(path))
+	}
+	old := t.Nodes[path[index]]
+	m := old.Message
+	m.Content = content
+	if m.Role == types.RoleUser {
+		msgs := append(t.Messages()[:index:index], m)
+		return Turn{Messages: msgs, session: id, parent: old.Parent, pending: []types.Message{m}}, nil
+	}
+	msgs, err := updateTree(id, func(t *Tree) error {
+		if old.ID >= len(t.Nodes) {
+			return fmt.Errorf("node %d does not exist", old.ID)
+		}
+		t.add(t.Nodes[old.ID].Parent, m)
+		return nil
+	})
+	return Turn{Messages: msgs, session: id}, err
+}
+
+// Undo 撤销当前分支最后一轮（最后一条 user 及其后的回答），节点仍保留可 Checkout 回去
+func Undo(id string) ([]types.Message, error) {
+	return updateTree(id, func(t *Tree) error {
+		path := t.Path()
+		i, err := t.lastUser(path)
+		if err != nil {
+			return err
+		}
+		t.Head = t.Nodes[path[i]].Parent
+		return nil
+	})
+}
+
+// Checkout 切换到以 node 结尾的分支
+func Checkout(id string, node int) ([]types.Message, error) {
+	return updateTree(id, func(t *Tree) error {
+		if node < -1 || node >= len(t.Nodes) {
+			return fmt.Errorf("node %d does not exist", node)
+		}
+		t.Head = node
+		return nil
+	})
+}
+
+// Fork 把会话（含全部分支与归档）复制到 newID
+func Fork(id, newID string) error {
+	if id == newID {
+		return errors.New("fork target must differ from source")
+	}
+	return update(func(tx storage.Tx) error {
+		src := tx.Bucket(bucketName(id))
+		if src == nil {
+			return ErrNotFound
+		}
+		if tx.Bucket(bucketName(newID)) != nil {
+			return fmt.Errorf("session %s already exists", newID)
+		}
+		if err := copyBucket(src, tx, bucketName(newID)); err != nil {
+			return err
+		}
+		dst := tx.Bucket(bucketName(newID))
+		ts, _ := time.Now().UTC().MarshalText()
+		if err := dst.Put(keyUpdated, ts); err != nil {
+			return err
+		}
+		if ab := tx.Bucket(archiveName(id)); ab != nil {
+			if err := tx.DeleteBucket(archiveName(newID)); err != nil && !errors.Is(err, storage.ErrBucketNotFound) {
+				return err
+			}
+			return copyBucket(ab, tx, archiveName(newID))
+		}
+		return nil
+	})
+}
+
+func copyBucket(src storage.Bucket, tx storage.Tx, name []byte) error {
+	dst, err := tx.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		return dst.Put(append([]byte{}, k...), append([]byte{}, v...))
+	})
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/types"
+	"gollm-mini/internal/window"
+)
+
+func TestMain(m *testing.M) {
+	if err := storage.Configure(storage.Config{Backend: storage.Memory}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func user(s string) types.Message      { return types.Message{Role: types.RoleUser, Content: s} }
+func assistant(s string) types.Message { return types.Message{Role: types.RoleAssistant, Content: s} }
+
+func contents(msgs []types.Message) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Content
+	}
+	return out
+}
+
+func seed(t *testing.T, id string, msgs ...types.Message) {
+	t.Helper()
+	if err := Append(id, msgs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func history(t *testing.T, id string) []string {
+	t.Helper()
+	s, err := Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents(s.Messages)
+}
+
+// 重新生成与编辑在回答保存之前不改动会话
+func TestTurnSavedOnlyWithReply(t *testing.T) {
+	seed(t, "turn", user("q1"), assistant("a1"), user("q2"), assistant("a2"))
+	before := history(t, "turn")
+
+	regen, err := Regenerate("turn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(regen.Messages); !slices.Equal(got, []string{"q1", "a1", "q2"}) {
+		t.Errorf("regenerate prefix %q", got)
+	}
+	edit, err := Edit("turn", 0, "q1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(edit.Messages); !slices.Equal(got, []string{"q1'"}) {
+		t.Errorf("edit prefix %q", got)
+	}
+	if got := history(t, "turn"); !slices.Equal(got, before) {
+		t.Fatalf("session changed before save: %q", got)
+	}
+
+	if err := regen.Save("a2'"); err != nil {
+		t.Fatal(err)
+	}
+	if got := history(t, "turn"); !slices.Equal(got, []string{"q1", "a1", "q2", "a2'"}) {
+		t.Errorf("after regenerate %q", got)
+	}
+	if err := edit.Save("a1'"); err != nil {
+		t.Fatal(err)
+	}
+	if got := history(t, "turn"); !slices.Equal(got, []string{"q1'", "a1'"}) {
+		t.Errorf("after edit %q", got)
+	}
+	tree, _ := GetTree("turn")
+	if len(tree.Nodes) != 7 {
+		t.Errorf("%d nodes, want 7 (old branches kept)", len(tree.Nodes))
+	}
+}
+
+func summarizeAs(s string) window.Summarizer {
+	return func(context.Context, string, []types.Message) (string, error) { return s, nil }
+}
+
+// 压缩只改写当前分支：其他分支的节点与上文原样保留
+func TestCompactKeepsBranches(t *testing.T) {
+	seed(t, "branchy", user("q1"), assistant("a1"), user("q2"), assistant("a2"), user("q3"), assistant("a3"))
+	regen, err := Regenerate("branchy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := regen.Save("a3'"); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := GetTree("branchy")
+	sibling := old.Path()[len(old.Path())-1] - 1 // 原回答 a3
+
+	res, err := Compact(context.Background(), "branchy", CompactPolicy{KeepRecent: 2}, summarizeAs("gist"), true)
+	if err != nil || !res.Compacted || res.Archived != 4 {
+		t.Fatalf("compact = %+v, %v", res, err)
+	}
+	if got := history(t, "branchy"); !slices.Equal(got, []string{window.SummaryPrefix + "gist", "q3", "a3'"}) {
+		t.Errorf("active branch %q", got)
+	}
+
+	msgs, err := Checkout("branchy", sibling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(msgs); !slices.Equal(got, []string{window.SummaryPrefix + "gist", "q3", "a3"}) {
+		t.Errorf("sibling branch %q", got)
+	}
+	// 被摘要的原始节点仍在树中
+	tree, _ := GetTree("branchy")
+	if msgs, _ := Checkout("branchy", 1); !slices.Equal(contents(msgs), []string{"q1", "a1"}) || len(tree.Nodes) != len(old.Nodes)+1 {
+		t.Errorf("original nodes: %q, %d nodes", contents(msgs), len(tree.Nodes))
+	}
+}
+
+// 摘要期间追加的消息保留；切换分支则放弃压缩
+func TestCompactConcurrentChanges(t *testing.T) {
+	seed(t, "busy", user("q1"), assistant("a1"), user("q2"), assistant("a2"))
+	appending := func(ctx context.Context, prev string, dropped []types.Message) (string, error) {
+		seed(t, "busy", user("q3"), assistant("a3"))
+		return "gist", nil
+	}
+	if _, err := Compact(context.Background(), "busy", CompactPolicy{KeepRecent: 2}, appending, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := history(t, "busy"); !slices.Equal(got, []string{window.SummaryPrefix + "gist", "q2", "a2", "q3", "a3"}) {
+		t.Errorf("after compact %q", got)
+	}
+
+	undoing := func(ctx context.Context, prev string, dropped []types.Message) (string, error) {
+		if _, err := Undo("busy"); err != nil {
+			t.Error(err)
+		}
+		return "gist2", nil
+	}
+	before := history(t, "busy")
+	_, err := Compact(context.Background(), "busy", CompactPolicy{KeepRecent: 2}, undoing, true)
+	if !errors.Is(err, ErrSessionChanged) {
+		t.Fatalf("err %v, want ErrSessionChanged", err)
+	}
+	if got := history(t, "busy"); !slices.Equal(got, before[:len(before)-2]) {
+		t.Errorf("after aborted compact %q", got)
+	}
+}
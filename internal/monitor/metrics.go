@@ -44,6 +44,30 @@ var (
 		Name: "prompt_cache_miss_total", Help: "LLM prompt cache miss",
 	})
 
+	Served = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_served_total",
+			Help: "Successful requests by the provider / model that actually served them",
+		},
+		[]string{"provider", "model"},
+	)
+
+	Fallback = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_fallback_total",
+			Help: "Fallbacks from one provider to the next, by error class",
+		},
+		[]string{"from", "to", "reason"},
+	)
+
+	Retries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "llm_retries_total",
+			Help: "Retries by provider and error kind",
+		},
+		[]string{"provider", "reason"},
+	)
+
 	CompareLatency = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "llm_compare_latency_seconds",
@@ -52,8 +76,32 @@ var (
 		},
 		[]string{"provider"},
 	)
+
+	// 按 API Key（ID，非明文）统计；status: ok / cancelled / unauthorized / forbidden / rate_limited / quota_exceeded
+	KeyRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gollm_apikey_requests_total",
+			Help: "Server requests by API key and outcome",
+		},
+		[]string{"key", "status"},
+	)
+	KeyTokens = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gollm_apikey_tokens_total",
+			Help: "Prompt / completion tokens by API key",
+		},
+		[]string{"key", "type"},
+	)
+	KeyCostUSD = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gollm_apikey_cost_usd_total",
+			Help: "Accumulated cost (USD) by API key",
+		},
+		[]string{"key"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(Latency, Tokens, CostUSD, OptScore, CacheHit, CacheMiss, CompareLatency)
+	prometheus.MustRegister(Latency, Tokens, CostUSD, OptScore, CacheHit, CacheMiss, Served, Fallback, Retries, CompareLatency,
+		KeyRequests, KeyTokens, KeyCostUSD)
 }
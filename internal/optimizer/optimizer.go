@@ -3,15 +3,35 @@ package optimizer
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"gollm-mini/internal/cache"
 	"gollm-mini/internal/core"
 	"gollm-mini/internal/helper"
 	"gollm-mini/internal/monitor"
 	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
 	"gollm-mini/internal/types"
 )
 
+// DefaultJudge 评分模型 "provider:model"，可由 SetJudge 覆盖
+const DefaultJudge = "ollama:llama3"
+
+var judge atomic.Value // string
+
+// SetJudge 修改评分模型，空串恢复默认；可在运行中调用
+func SetJudge(target string) { judge.Store(target) }
+
+// Judge 当前评分模型
+func Judge() string {
+	if s, _ := judge.Load().(string); s != "" {
+		return s
+	}
+	return DefaultJudge
+}
+
 type Variant struct {
 	Provider string `json:"provider"`          // ollama / openai …
 	Model    string `json:"model"`             // llama3 / gpt-4o …
@@ -23,6 +43,32 @@ func (v Variant) Key() string {
 	return fmt.Sprintf("%s|%s|%s:%d", v.Provider, v.Model, v.TplName, v.Version)
 }
 
+type usageKey struct{}
+
+// WithUsage 让 RunVariants 把每次模型调用（含评分）的用量回调给 fn，servedBy 为 "provider:model"
+func WithUsage(ctx context.Context, fn func(servedBy string, u types.Usage)) context.Context {
+	return context.WithValue(ctx, usageKey{}, fn)
+}
+
+func reportUsage(ctx context.Context, u types.Usage) {
+	if fn, ok := ctx.Value(usageKey{}).(func(string, types.Usage)); ok {
+		fn(u.ServedBy, u)
+	}
+}
+
+type progressKey struct{}
+
+// WithProgress 让 RunVariants 每评完一个 variant 回调 fn(已完成, 总数)
+func WithProgress(ctx context.Context, fn func(done, total int)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func reportProgress(ctx context.Context, done, total int) {
+	if fn, ok := ctx.Value(progressKey{}).(func(int, int)); ok {
+		fn(done, total)
+	}
+}
+
 // RunVariants —— 跨 Provider / Model / Prompt 的统一对比入口
 func RunVariants(
 	ctx context.Context,
@@ -41,20 +87,25 @@ func RunVariants(
 	只返回最终综合分数，其他文字省略。
 	`
 
-	recDB, _ := Open("optimize.db") // 评分落库
+	recDB, err := Open("optimize") // 评分落库，按 ctx 中的租户隔离
+	if err != nil {
+		return
+	}
+	recDB = recDB.In(tenant.From(ctx))
 	scores = map[string]float64{}
 	answers = map[string]string{}
 	latencies = map[string]float64{}
 
 	question := vars["input"]
 	judgePrompt := []types.Message{{Role: types.RoleSystem, Content: judgeSys}}
-	judgeLLM, e := core.New("ollama", "llama3")
+	judgeProvider, judgeModel, _ := strings.Cut(Judge(), ":")
+	judgeLLM, e := core.New(judgeProvider, judgeModel)
 	if e != nil {
 		err = e
 		return
 	}
 
-	for _, v := range variants {
+	for i, v := range variants {
 		key := v.Key()
 
 		// 1. 组装 Message
@@ -75,9 +126,11 @@ func RunVariants(
 			err = e
 			return
 		}
+		llm.SetCacheMode(cache.ModeOff) // 对比延迟，不能走缓存
 
 		start := time.Now()
-		answer, _, e := llm.Generate(ctx, msgs)
+		answer, usage, e := llm.Generate(ctx, msgs, tpl.Options)
+		reportUsage(ctx, usage)
 		if e != nil {
 			err = e
 			return
@@ -90,9 +143,10 @@ func RunVariants(
 
 		// 3. 评分
 		scorePrompt := fmt.Sprintf("Question:%s\nAnswer:%s\nScore:", question, answer)
-		scoreTxt, _, e := judgeLLM.Generate(ctx, append(judgePrompt, types.Message{
+		scoreTxt, usage, e := judgeLLM.Generate(ctx, append(judgePrompt, types.Message{
 			Role: types.RoleUser, Content: scorePrompt,
-		}))
+		}), types.GenerateOptions{})
+		reportUsage(ctx, usage)
 
 		if e != nil {
 			err = e
@@ -112,6 +166,7 @@ func RunVariants(
 			Model:      v.Model,
 			At:         time.Now(),
 		})
+		reportProgress(ctx, i+1, len(variants))
 	}
 
 	// 5. 选最优
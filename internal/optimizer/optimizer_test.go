@@ -0,0 +1,107 @@
+package optimizer
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+
+	"gollm-mini/internal/provider/mock"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+func TestMain(m *testing.M) {
+	if err := storage.Configure(storage.Config{Backend: storage.Memory}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// 两个 variant 由 mock 回答、mock 评分：分高者胜出，评分落库，用量与进度逐次回调
+func TestRunVariantsOffline(t *testing.T) {
+	mock.Register("opt-a", mock.Response{Text: "answer A", Usage: types.Usage{PromptTokens: 5, CompletionTokens: 2}})
+	mock.Register("opt-b", mock.Response{Text: "answer B", Usage: types.Usage{PromptTokens: 5, CompletionTokens: 3}})
+	judge := mock.Register("opt-judge",
+		mock.Response{Text: "6", Usage: types.Usage{PromptTokens: 20, CompletionTokens: 1}},
+		mock.Response{Text: "Score: 8.5", Usage: types.Usage{PromptTokens: 20, CompletionTokens: 1}},
+	)
+	SetJudge("opt-judge:j")
+	defer SetJudge("")
+
+	tpls, err := template.Open("templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tpls.Save(template.Template{Name: "qa", Version: 1, Content: "Q: {{.input}}", Vars: []string{"input"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	variants := []Variant{
+		{Provider: "opt-a", Model: "a1", TplName: "qa", Version: 1},
+		{Provider: "opt-b", Model: "b1", TplName: "qa", Version: 1},
+	}
+	var (
+		servedBy []string
+		tokens   int
+		progress [][2]int
+	)
+	ctx := WithUsage(tenant.With(context.Background(), "team-a"), func(s string, u types.Usage) {
+		servedBy = append(servedBy, s)
+		tokens += u.Total()
+	})
+	ctx = WithProgress(ctx, func(done, total int) { progress = append(progress, [2]int{done, total}) })
+
+	best, scores, answers, latencies, err := RunVariants(ctx, variants, map[string]string{"input": "why?"}, tpls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best != variants[1] {
+		t.Errorf("best = %+v, want %+v", best, variants[1])
+	}
+	a, b := variants[0].Key(), variants[1].Key()
+	if scores[a] != 6 || scores[b] != 8.5 {
+		t.Errorf("scores = %v", scores)
+	}
+	if answers[a] != "answer A" || answers[b] != "answer B" || len(latencies) != 2 {
+		t.Errorf("answers = %v, latencies = %v", answers, latencies)
+	}
+
+	// 评分提示包含问题与回答
+	if reqs := judge.Requests(); len(reqs) != 2 || reqs[0][len(reqs[0])-1].Content != "Question:why?\nAnswer:answer A\nScore:" {
+		t.Errorf("judge requests = %+v", reqs)
+	}
+	if want := []string{"opt-a:a1", "opt-judge:j", "opt-b:b1", "opt-judge:j"}; !slices.Equal(servedBy, want) {
+		t.Errorf("usage reported for %v, want %v", servedBy, want)
+	}
+	if tokens != 7+21+8+21 {
+		t.Errorf("tokens = %d", tokens)
+	}
+	if len(progress) != 2 || progress[1] != [2]int{2, 2} {
+		t.Errorf("progress = %v", progress)
+	}
+
+	// 评分记录写入 ctx 中租户的命名空间
+	recs, err := Open("optimize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := recs.In("team-a").All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, r := range list {
+		keys = append(keys, r.VariantKey)
+	}
+	sort.Strings(keys)
+	if want := []string{a, b}; !slices.Equal(keys, want) {
+		t.Errorf("records = %v, want %v", keys, want)
+	}
+	if other, _ := recs.In("team-b").All(); len(other) != 0 {
+		t.Errorf("team-b sees %d records", len(other))
+	}
+}
@@ -1,12 +1,12 @@
 package optimizer
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
 
-	bolt "go.etcd.io/bbolt"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tenant"
 )
 
 const recordBucket = "opt_records"
@@ -22,18 +22,83 @@ type Record struct {
 	At         time.Time `json:"at"`
 }
 
+// Store 评分记录库；In 返回某个租户的视图
 type Store struct {
-	db *bolt.DB
+	db     storage.DB
+	bucket []byte
 }
 
-func Open(path string) (*Store, error) {
-	db, err := bolt.Open(path, 0600, nil)
-	return &Store{db: db}, err
+// Open 打开名为 name 的评分记录库（见 storage.Open）
+func Open(name string) (*Store, error) {
+	db, err := storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(db), nil
+}
+
+// NewStore 使用指定的存储，测试时可传 storage.NewMemory()
+func NewStore(db storage.DB) *Store { return &Store{db: db, bucket: []byte(recordBucket)} }
+
+// In 租户 t 的评分记录，桶名为 "@<t>/opt_records"；默认租户即原桶
+func (s *Store) In(t string) *Store {
+	return &Store{db: s.db, bucket: []byte(tenant.Prefix(t) + recordBucket)}
+}
+
+// Tenants 有评分记录的非默认租户
+func (s *Store) Tenants() ([]string, error) {
+	var out []string
+	err := s.db.View(func(tx storage.Tx) error {
+		return tx.ForEachBucket(func(name []byte) error {
+			if t, rest := tenant.Split(string(name)); t != tenant.Default && rest == recordBucket {
+				out = append(out, t)
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// All 本租户全部评分记录
+func (s *Store) All() ([]Record, error) {
+	var list []Record
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			list = append(list, r)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// Drop 删除本租户的全部评分记录，返回删除数量
+func (s *Store) Drop() (int, error) {
+	n := 0
+	err := s.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return nil
+		}
+		n = b.KeyN()
+		return tx.DeleteBucket(s.bucket)
+	})
+	return n, err
 }
 
 func (s *Store) Save(rec Record) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		b, _ := tx.CreateBucketIfNotExists([]byte(recordBucket))
+	return s.db.Update(func(tx storage.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return err
+		}
 		key := fmt.Sprintf("%s/%d", rec.Template, time.Now().UnixNano())
 		data, _ := json.Marshal(rec)
 		return b.Put([]byte(key), data)
@@ -42,19 +107,17 @@ func (s *Store) Save(rec Record) error {
 
 func (s *Store) List(template string) ([]Record, error) {
 	var list []Record
-	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(recordBucket))
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
 		if b == nil {
 			return nil
 		}
-		c := b.Cursor()
-		prefix := []byte(template + "/")
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		return b.Scan([]byte(template+"/"), func(_, v []byte) error {
 			var r Record
 			_ = json.Unmarshal(v, &r)
 			list = append(list, r)
-		}
-		return nil
+			return nil
+		})
 	})
 	return list, err
 }
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorKind Provider 失败的类别，决定 core 层是否重试 / fallback
+type ErrorKind string
+
+const (
+	KindAuth          ErrorKind = "auth"           // 401 / 403
+	KindRateLimit     ErrorKind = "rate_limit"     // 429，可带 Retry-After
+	KindOverloaded    ErrorKind = "overloaded"     // 503 / 529 / 模型加载中
+	KindBadRequest    ErrorKind = "bad_request"    // 其他 4xx
+	KindContextLength ErrorKind = "context_length" // 输入超出上下文窗口
+	KindTimeout       ErrorKind = "timeout"
+	KindServer        ErrorKind = "server"     // 其他 5xx
+	KindConnection    ErrorKind = "connection" // 连接被拒 / 重置 / DNS
+	KindCanceled      ErrorKind = "canceled"   // 调用方取消
+	KindUnknown       ErrorKind = "unknown"
+)
+
+// Retryable 鉴权、参数错误、超长与取消重试也不会成功
+func (k ErrorKind) Retryable() bool {
+	switch k {
+	case KindAuth, KindBadRequest, KindContextLength, KindCanceled:
+		return false
+	}
+	return true
+}
+
+// Error Provider 返回的类型化错误
+type Error struct {
+	Kind       ErrorKind
+	Status     int           // HTTP 状态码，无则为 0
+	RetryAfter time.Duration // 服务端建议的等待时间，无则为 0
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Status > 0 {
+		return fmt.Sprintf("%s (%d): %v", e.Kind, e.Status, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// FromStatus 按 HTTP 状态码与错误信息归类；header 可为 nil
+func FromStatus(status int, msg string, header http.Header) *Error {
+	e := &Error{Kind: KindUnknown, Status: status, Err: errors.New(msg)}
+	switch {
+	case isContextLength(msg):
+		e.Kind = KindContextLength
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Kind = KindAuth
+	case status == http.StatusTooManyRequests:
+		e.Kind = KindRateLimit
+	case status == http.StatusServiceUnavailable || status == 529:
+		e.Kind = KindOverloaded
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		e.Kind = KindTimeout
+	case status >= 500:
+		e.Kind = KindServer
+	case status >= 400:
+		e.Kind = KindBadRequest
+	}
+	if header != nil {
+		e.RetryAfter = ParseRetryAfter(header.Get("Retry-After"))
+	}
+	return e
+}
+
+// Classify 把任意错误归类；已是 *Error 的原样返回，nil 返回 nil
+func Classify(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe
+	}
+	kind := KindUnknown
+	var (
+		ne  net.Error
+		dns *net.DNSError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		kind = KindCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		kind = KindTimeout
+	case errors.As(err, &ne) && ne.Timeout():
+		kind = KindTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.As(err, &dns):
+		kind = KindConnection
+	case isContextLength(err.Error()):
+		kind = KindContextLength
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf 等价于 Classify(err).Kind；nil 返回空串
+func KindOf(err error) ErrorKind {
+	if e := Classify(err); e != nil {
+		return e.Kind
+	}
+	return ""
+}
+
+// ParseRetryAfter 支持秒数与 HTTP-date 两种格式
+func ParseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func isContextLength(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, s := range []string{"context length", "context_length_exceeded", "maximum context", "context window", "too many tokens"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,9 +7,17 @@ import torch
 
 app = FastAPI()
 
+class Params(BaseModel):
+    temperature: float | None = None
+    top_p: float | None = None
+    max_new_tokens: int | None = None
+    stop: list[str] | None = None
+    seed: int | None = None
+
 class ChatReq(BaseModel):
     input: str
     model: str | None = None   # 允许前端指定模型；留空则用默认
+    parameters: Params | None = None
 
 @lru_cache                         # 多次请求同一个模型时复用
 def load(model_id: str):
@@ -22,13 +30,22 @@ def generate(req: ChatReq):
     model_id = req.model or "TinyLlama/TinyLlama-1.1B-Chat-v1.0"
     tokenizer, model = load(model_id)
 
+    p = req.parameters or Params()
+    if p.seed is not None:
+        torch.manual_seed(p.seed)
+
     inputs = tokenizer(req.input, return_tensors="pt")
     eos = tokenizer.convert_tokens_to_ids("</s>")
-    outputs = model.generate(
-        **inputs,
-        max_new_tokens=1024,
-        eos_token_id=eos, 
-        do_sample=False
+    gen_kwargs = dict(
+        max_new_tokens=p.max_new_tokens or 1024,
+        eos_token_id=eos,
+        do_sample=bool(p.temperature),
     )
+    if p.temperature:
+        gen_kwargs["temperature"] = p.temperature
+    if p.top_p is not None:
+        gen_kwargs["top_p"] = p.top_p
+    outputs = model.generate(**inputs, **gen_kwargs)
     text = tokenizer.decode(outputs[0], skip_special_tokens=False)
+    # stop 序列由 Go 侧截断
     return {"text": text}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"gollm-mini/internal/provider"
+	"gollm-mini/internal/tokenizer"
 	"gollm-mini/internal/types"
 )
 
@@ -27,31 +28,44 @@ type HF struct {
 // 构造 & 配置
 // ---------------------------------------------------------------------
 
-func New(model string) *HF {
-	key := os.Getenv("HF_API_KEY")   // 远端调用时需要
-	base := os.Getenv("HF_BASE_URL") // 允许覆盖
+const defaultModel = "TinyLlama/TinyLlama-1.1B-Chat-v1.0"
+
+// New 按 Config 构造；APIKey / BaseURL 为空时分别读 HF_API_KEY / HF_BASE_URL
+func New(cfg provider.Config) (*HF, error) {
+	if cfg.Model == "" {
+		cfg.Model = defaultModel
+	}
+	key := cfg.APIKey
+	if key == "" {
+		key = os.Getenv("HF_API_KEY") // 远端调用时需要
+	}
+	base := cfg.BaseURL
+	if base == "" {
+		base = os.Getenv("HF_BASE_URL") // 允许覆盖
+	}
 	if base == "" {
 		base = "https://api-inference.huggingface.co/models"
 	}
 	return &HF{
 		client:  &http.Client{Timeout: 60 * time.Second},
 		apiKey:  key,
-		modelID: model,
+		modelID: cfg.Model,
 		baseURL: strings.TrimRight(base, "/"),
-	}
+	}, nil
 }
 
-func (h *HF) SetModel(m string) { h.modelID = m }
+// Model 实际使用的模型（provider.ModelNamer）
+func (h *HF) Model() string { return h.modelID }
 
 // ---------------------------------------------------------------------
 // 核心：Generate
 // ---------------------------------------------------------------------
 
-func (h *HF) Generate(ctx context.Context, msgs []types.Message) (string, types.Usage, error) {
+func (h *HF) Generate(ctx context.Context, msgs []types.Message, opts types.GenerateOptions) (string, types.Usage, error) {
 	// -------------------- 1) 参数检查 --------------------
 	isRemote := strings.Contains(h.baseURL, "api-inference.huggingface.co")
 	if isRemote && h.apiKey == "" {
-		return "", types.Usage{}, errors.New("HF_API_KEY not set (remote HF API)")
+		return "", types.Usage{}, &provider.Error{Kind: provider.KindAuth, Err: errors.New("HF_API_KEY not set (remote HF API)")}
 	}
 
 	// -------------------- 2) 拼 prompt --------------------
@@ -70,15 +84,18 @@ func (h *HF) Generate(ctx context.Context, msgs []types.Message) (string, types.
 	}
 
 	// -------------------- 4) 构造请求体 --------------------
-	var payload any
+	var payload map[string]any
 	if isRemote {
-		payload = map[string]string{"inputs": prompt}
+		payload = map[string]any{"inputs": prompt}
 	} else {
-		payload = map[string]string{
+		payload = map[string]any{
 			"input": prompt,
 			"model": h.modelID, // 便于 FastAPI 端动态加载
 		}
 	}
+	if params := buildParameters(opts); len(params) > 0 {
+		payload["parameters"] = params
+	}
 	body, _ := json.Marshal(payload)
 
 	req, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
@@ -91,22 +108,18 @@ func (h *HF) Generate(ctx context.Context, msgs []types.Message) (string, types.
 
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return "", types.Usage{}, err
+		return "", types.Usage{}, provider.Classify(err)
 	}
 	defer resp.Body.Close()
 
-	// 常见重试场景：503 正在加载权重
-	if resp.StatusCode == 503 {
-		return "", types.Usage{}, errors.New("model loading on HF, retry later")
-	}
 	if resp.StatusCode != 200 {
-		return "", types.Usage{}, fmt.Errorf("HF API %s", resp.Status)
+		return "", types.Usage{}, statusError(resp)
 	}
 
 	// -------------------- 6) 解析响应 --------------------
 	respBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", types.Usage{}, err
+		return "", types.Usage{}, provider.Classify(err)
 	}
 
 	// 6-a 远端格式：[{ "generated_text": "..." }]
@@ -114,10 +127,10 @@ func (h *HF) Generate(ctx context.Context, msgs []types.Message) (string, types.
 		GeneratedText string `json:"generated_text"`
 	}
 	if json.Unmarshal(respBytes, &arr) == nil && len(arr) > 0 {
-		txt := strings.TrimSpace(arr[0].GeneratedText)
+		txt := cutStop(strings.TrimSpace(arr[0].GeneratedText), opts.Stop)
 		usage := types.Usage{
-			PromptTokens:     approxTokens(prompt),
-			CompletionTokens: approxTokens(txt),
+			PromptTokens:     h.countTokens(prompt),
+			CompletionTokens: h.countTokens(txt),
 		}
 		return txt, usage, nil
 	}
@@ -129,10 +142,10 @@ func (h *HF) Generate(ctx context.Context, msgs []types.Message) (string, types.
 	if err := json.Unmarshal(respBytes, &obj); err != nil {
 		return "", types.Usage{}, fmt.Errorf("decode HF response: %w", err)
 	}
-	txt := postProcess(obj.Text)
+	txt := cutStop(postProcess(obj.Text), opts.Stop)
 	usage := types.Usage{
-		PromptTokens:     approxTokens(prompt),
-		CompletionTokens: approxTokens(txt),
+		PromptTokens:     h.countTokens(prompt),
+		CompletionTokens: h.countTokens(txt),
 	}
 	return txt, usage, nil
 }
@@ -141,19 +154,23 @@ func (h *HF) Generate(ctx context.Context, msgs []types.Message) (string, types.
 // Stream：沿用你原来的“空格伪流”实现
 // ---------------------------------------------------------------------
 
-func (h *HF) Stream(ctx context.Context, msgs []types.Message, cb func(types.Chunk)) (types.Usage, error) {
-	txt, usage, err := h.Generate(ctx, msgs)
+func (h *HF) Stream(ctx context.Context, msgs []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	txt, usage, err := h.Generate(ctx, msgs, opts)
 	if err != nil {
 		return usage, err
 	}
-	for _, tok := range strings.Split(txt, " ") {
-		select {
-		case <-ctx.Done():
-			return usage, ctx.Err()
-		default:
-			cb(types.Chunk{Content: tok + " ", Delta: 1})
-			time.Sleep(60 * time.Millisecond)
+	tick := time.NewTicker(60 * time.Millisecond)
+	defer tick.Stop()
+	for i, tok := range strings.Split(txt, " ") {
+		if i > 0 {
+			// 等待期间客户端断开也要立即返回，不再继续回放
+			select {
+			case <-ctx.Done():
+				return usage, ctx.Err()
+			case <-tick.C:
+			}
 		}
+		cb(types.Chunk{Content: tok + " ", Delta: h.countTokens(tok + " ")})
 	}
 	return usage, nil
 }
@@ -208,13 +225,68 @@ func postProcess(txt string) string {
 	return strings.TrimSpace(txt)
 }
 
-// 粗略 token 估算：按空格数
-func approxTokens(s string) int { return len(strings.Split(s, " ")) }
+// statusError 非 200 响应归类；503 正在加载权重时 HF 会在 body 给出 estimated_time
+func statusError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body struct {
+		Error         string  `json:"error"`
+		EstimatedTime float64 `json:"estimated_time"`
+	}
+	_ = json.Unmarshal(b, &body)
+	msg := body.Error
+	if msg == "" {
+		msg = strings.TrimSpace(string(b))
+	}
+	pe := provider.FromStatus(resp.StatusCode, fmt.Sprintf("HF API %s: %s", resp.Status, msg), resp.Header)
+	if pe.RetryAfter == 0 && body.EstimatedTime > 0 {
+		pe.RetryAfter = time.Duration(body.EstimatedTime * float64(time.Second))
+	}
+	return pe
+}
+
+// buildParameters 映射到 HF text-generation 的 parameters（本地 api.py 同名）
+func buildParameters(opts types.GenerateOptions) map[string]any {
+	p := map[string]any{}
+	if opts.Temperature != nil {
+		p["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		p["max_new_tokens"] = opts.MaxTokens
+	}
+	if opts.TopP != nil {
+		p["top_p"] = *opts.TopP
+	}
+	if len(opts.Stop) > 0 {
+		p["stop"] = opts.Stop
+	}
+	if opts.Seed != nil {
+		p["seed"] = *opts.Seed
+	}
+	return p
+}
+
+// cutStop 在第一个 stop 序列处截断（本地服务不识别 stop 时兜底）
+func cutStop(txt string, stop []string) string {
+	for _, s := range stop {
+		if s == "" {
+			continue
+		}
+		if i := strings.Index(txt, s); i != -1 {
+			txt = txt[:i]
+		}
+	}
+	return strings.TrimSpace(txt)
+}
+
+// countTokens HF 接口不返回 usage，用本地分词器估算
+func (h *HF) countTokens(s string) int { return tokenizer.Count(h.modelID, s) }
 
 // ---------------------------------------------------------------------
 // 注册到 provider 工厂
 // ---------------------------------------------------------------------
 
 func init() {
-	provider.Register("hf", New("TinyLlama/TinyLlama-1.1B-Chat-v1.0"))
+	provider.Register("hf", func(cfg provider.Config) (provider.Provider, error) {
+		return New(cfg)
+	})
 }
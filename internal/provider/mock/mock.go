@@ -0,0 +1,164 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/types"
+)
+
+// Response 一次脚本化回复
+type Response struct {
+	Text      string
+	Chunks    []string // 流式时逐块发出；为空则把 Text 作为一整块
+	ToolCalls []types.ToolCall
+	Usage     types.Usage
+	Err       error
+	Latency   time.Duration // 返回前等待，可被 ctx 取消
+	ChunkGap  time.Duration // 流式时相邻 chunk 的间隔，可被 ctx 取消
+}
+
+// Mock 按顺序返回脚本中的回复，用尽后重复最后一条；并记录收到的请求。
+// 没有脚本时回显最后一条 user 消息。
+type Mock struct {
+	mu       sync.Mutex
+	script   []Response
+	next     int
+	requests [][]types.Message
+}
+
+func New(script ...Response) *Mock { return &Mock{script: script} }
+
+// Register 以 name 注册一个共享脚本的 Mock：同名的每个实例都消费同一份脚本，
+// 便于 server / core 按请求新建 Provider 时仍能断言调用顺序
+func Register(name string, script ...Response) *Mock {
+	m := New(script...)
+	provider.Register(name, func(provider.Config) (provider.Provider, error) { return m, nil })
+	return m
+}
+
+// Requests 返回已收到的请求（按调用顺序）
+func (m *Mock) Requests() [][]types.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]types.Message(nil), m.requests...)
+}
+
+func (m *Mock) take(msgs []types.Message) Response {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, msgs)
+	if len(m.script) == 0 {
+		return echo(msgs)
+	}
+	r := m.script[m.next]
+	if m.next < len(m.script)-1 {
+		m.next++
+	}
+	return r
+}
+
+func (m *Mock) Generate(ctx context.Context, msgs []types.Message, _ types.GenerateOptions) (string, types.Usage, error) {
+	r := m.take(msgs)
+	if err := wait(ctx, r.Latency); err != nil {
+		return "", types.Usage{}, err
+	}
+	if r.Err != nil {
+		return "", r.Usage, r.Err
+	}
+	return r.text(), r.Usage, nil
+}
+
+func (m *Mock) Stream(ctx context.Context, msgs []types.Message, _ types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	r := m.take(msgs)
+	if err := wait(ctx, r.Latency); err != nil {
+		return types.Usage{}, err
+	}
+	chunks := r.Chunks
+	if len(chunks) == 0 && r.Text != "" {
+		chunks = []string{r.Text}
+	}
+	for i, c := range chunks {
+		if i > 0 {
+			if err := wait(ctx, r.ChunkGap); err != nil {
+				return r.Usage, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return r.Usage, err
+		}
+		cb(types.Chunk{Content: c, Delta: 1})
+	}
+	return r.Usage, r.Err // Err 在已发出的 chunk 之后返回，可模拟中途断流
+}
+
+func (m *Mock) GenerateWithTools(ctx context.Context, msgs []types.Message, _ []types.Tool, _ types.GenerateOptions) (types.Message, types.Usage, error) {
+	r := m.take(msgs)
+	if err := wait(ctx, r.Latency); err != nil {
+		return types.Message{}, types.Usage{}, err
+	}
+	if r.Err != nil {
+		return types.Message{}, r.Usage, r.Err
+	}
+	return types.Message{Role: types.RoleAssistant, Content: r.text(), ToolCalls: r.ToolCalls}, r.Usage, nil
+}
+
+func (r Response) text() string {
+	if r.Text == "" && len(r.Chunks) > 0 {
+		return strings.Join(r.Chunks, "")
+	}
+	return r.Text
+}
+
+func echo(msgs []types.Message) Response {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == types.RoleUser {
+			return Response{Text: "mock: " + msgs[i].Content}
+		}
+	}
+	return Response{Text: "mock"}
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 默认注册一个回显 Provider，便于离线跑 CLI / server；
+// Options["reply"] 可指定固定回复，Options["chunk_gap"]（如 200ms）让固定回复按词慢速流出，
+// Options["latency"] 为固定回复返回前的等待
+func init() {
+	provider.Register("mock", func(cfg provider.Config) (provider.Provider, error) {
+		reply := cfg.Options["reply"]
+		if reply == "" {
+			return New(), nil
+		}
+		r := Response{Text: reply}
+		if v := cfg.Options["chunk_gap"]; v != "" {
+			gap, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("mock: chunk_gap: %w", err)
+			}
+			r.ChunkGap, r.Chunks = gap, strings.SplitAfter(reply, " ")
+		}
+		if v := cfg.Options["latency"]; v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("mock: latency: %w", err)
+			}
+			r.Latency = d
+		}
+		return New(r), nil
+	})
+}
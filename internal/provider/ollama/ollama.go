@@ -2,36 +2,58 @@ package ollama
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
 	"github.com/ollama/ollama/api" // 官方 SDK
 	"gollm-mini/internal/provider" // 注册表
+	"gollm-mini/internal/tokenizer"
 	"gollm-mini/internal/types"
 )
 
+const defaultModel = "llama3"
+
 // Ollama 实现 gollm-mini-mini 的 Provider 接口
 type Ollama struct {
 	client *api.Client
 	model  string
 }
 
-func (o *Ollama) SetModel(m string) { o.model = m }
-
-// New 返回一个 Ollama Provider；如果你想连到远端，把 baseURL 写进去
-func New(model string) *Ollama {
-	cli, _ := api.ClientFromEnvironment() // 读 OLLAMA_HOST，不设就用本地
-	return &Ollama{client: cli, model: model}
+// New 返回一个 Ollama Provider；如果你想连到远端，把 BaseURL 写进去
+func New(cfg provider.Config) (*Ollama, error) {
+	if cfg.Model == "" {
+		cfg.Model = defaultModel
+	}
+	if cfg.BaseURL == "" {
+		cli, err := api.ClientFromEnvironment() // 读 OLLAMA_HOST，不设就用本地
+		if err != nil {
+			return nil, err
+		}
+		return &Ollama{client: cli, model: cfg.Model}, nil
+	}
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Ollama{client: api.NewClient(u, http.DefaultClient), model: cfg.Model}, nil
 }
 
+// Model 实际使用的模型（provider.ModelNamer）
+func (o *Ollama) Model() string { return o.model }
+
 // Generate 把历史对话打给 /api/chat，取最后一条回复
-func (o *Ollama) Generate(ctx context.Context, msgs []types.Message) (string, types.Usage, error) {
-	om := make([]api.Message, len(msgs))
-	for i, m := range msgs {
-		om[i] = api.Message{Role: string(m.Role), Content: m.Content}
-	}
+func (o *Ollama) Generate(ctx context.Context, msgs []types.Message, opts types.GenerateOptions) (string, types.Usage, error) {
+	om := toAPIMessages(msgs)
 	stream := false
 	req := &api.ChatRequest{
 		Model:    o.model,
 		Messages: om,
 		Stream:   &stream,
+		Options:  buildOptions(opts),
 	}
 	var (
 		full  string
@@ -46,37 +68,184 @@ func (o *Ollama) Generate(ctx context.Context, msgs []types.Message) (string, ty
 		}
 		return nil
 	}); err != nil {
-		return "", usage, err
+		return "", usage, wrapErr(err)
 	}
 
-	return full, usage, nil
+	return full, o.fillUsage(usage, msgs, full), nil
 }
 
-func (o *Ollama) Stream(ctx context.Context, msgs []types.Message, cb func(types.Chunk)) (types.Usage, error) {
-	om := make([]api.Message, len(msgs))
-	for i, m := range msgs {
-		om[i] = api.Message{Role: string(m.Role), Content: m.Content}
+// GenerateWithTools 通过 /api/chat 的 tools 字段进行函数调用
+func (o *Ollama) GenerateWithTools(ctx context.Context, msgs []types.Message, tools []types.Tool, opts types.GenerateOptions) (types.Message, types.Usage, error) {
+	at, err := toAPITools(tools)
+	if err != nil {
+		return types.Message{}, types.Usage{}, err
 	}
+	stream := false
+	req := &api.ChatRequest{
+		Model:    o.model,
+		Messages: toAPIMessages(msgs),
+		Stream:   &stream,
+		Tools:    at,
+		Options:  buildOptions(opts),
+	}
+
+	var (
+		out   = types.Message{Role: types.RoleAssistant}
+		usage types.Usage
+	)
+	if err := o.client.Chat(ctx, req, func(cr api.ChatResponse) error {
+		out.Content = cr.Message.Content
+		for i, tc := range cr.Message.ToolCalls {
+			args, _ := json.Marshal(tc.Function.Arguments)
+			out.ToolCalls = append(out.ToolCalls, types.ToolCall{
+				ID:        fmt.Sprintf("call_%d", i), // Ollama 不返回调用 ID
+				Name:      tc.Function.Name,
+				Arguments: string(args),
+			})
+		}
+		usage = types.Usage{
+			PromptTokens:     cr.Metrics.PromptEvalCount,
+			CompletionTokens: cr.Metrics.EvalCount,
+		}
+		return nil
+	}); err != nil {
+		return types.Message{}, usage, wrapErr(err)
+	}
+	return out, o.fillUsage(usage, msgs, out.Content), nil
+}
+
+func (o *Ollama) Stream(ctx context.Context, msgs []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	om := toAPIMessages(msgs)
 	stream := true
-	req := &api.ChatRequest{Model: o.model, Messages: om, Stream: &stream}
+	req := &api.ChatRequest{Model: o.model, Messages: om, Stream: &stream, Options: buildOptions(opts)}
 
-	var usage types.Usage
+	var (
+		usage types.Usage
+		text  strings.Builder
+		tk    = tokenizer.ForModel(o.model)
+	)
 	if err := o.client.Chat(ctx, req, func(cr api.ChatResponse) error {
+		// 最后一块 Done=true，带本次的 prompt / eval 计数
+		if cr.Done {
+			usage = types.Usage{
+				PromptTokens:     cr.Metrics.PromptEvalCount,
+				CompletionTokens: cr.Metrics.EvalCount,
+			}
+		}
 		token := cr.Message.Content
 		if token == "" {
 			return nil
 		}
-		cb(types.Chunk{Content: token, Delta: 1}) // Ollama 无法精确分词，这里假设 1
-		usage.CompletionTokens += 1
-		usage.PromptTokens = cr.Metrics.PromptEvalCount
+		text.WriteString(token)
+		cb(types.Chunk{Content: token, Delta: tk.Count(token)})
 		return nil
 	}); err != nil {
-		return usage, err
+		return usage, wrapErr(err)
+	}
+	return o.fillUsage(usage, msgs, text.String()), nil
+}
+
+// fillUsage 服务端未给出的计数用本地分词器补齐；
+// 命中 Ollama 的 prompt 缓存时 prompt_eval_count 可能为 0
+func (o *Ollama) fillUsage(u types.Usage, msgs []types.Message, completion string) types.Usage {
+	tk := tokenizer.ForModel(o.model)
+	if u.PromptTokens == 0 {
+		u.PromptTokens = tokenizer.CountMessages(tk, msgs)
+	}
+	if u.CompletionTokens == 0 {
+		u.CompletionTokens = tk.Count(completion)
+	}
+	return u
+}
+
+// ListModels 读取本地已拉取的模型（/api/tags）
+func (o *Ollama) ListModels(ctx context.Context) ([]string, error) {
+	resp, err := o.client.List(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	names := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// wrapErr 把 SDK 错误转换为 provider.Error
+func wrapErr(err error) error {
+	var se api.StatusError
+	if errors.As(err, &se) {
+		pe := provider.FromStatus(se.StatusCode, se.Error(), nil)
+		pe.Err = err
+		return pe
+	}
+	return provider.Classify(err)
+}
+
+func toAPIMessages(msgs []types.Message) []api.Message {
+	om := make([]api.Message, len(msgs))
+	for i, m := range msgs {
+		om[i] = api.Message{Role: string(m.Role), Content: m.Content}
+		for _, tc := range m.ToolCalls {
+			var args api.ToolCallFunctionArguments
+			_ = json.Unmarshal([]byte(tc.Arguments), &args)
+			om[i].ToolCalls = append(om[i].ToolCalls, api.ToolCall{
+				Function: api.ToolCallFunction{Name: tc.Name, Arguments: args},
+			})
+		}
+	}
+	return om
+}
+
+// toAPITools api.Tool 的参数是具体结构体，借 JSON 往返把 Schema 填进去
+func toAPITools(tools []types.Tool) (api.Tools, error) {
+	out := make(api.Tools, 0, len(tools))
+	for _, t := range tools {
+		params := t.Parameters
+		if len(params) == 0 {
+			params = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		raw, _ := json.Marshal(map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  params,
+			},
+		})
+		var at api.Tool
+		if err := json.Unmarshal(raw, &at); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+		out = append(out, at)
+	}
+	return out, nil
+}
+
+// buildOptions 映射到 Ollama 的 options（字段名见 api.Options）
+func buildOptions(opts types.GenerateOptions) map[string]any {
+	m := map[string]any{}
+	if opts.Temperature != nil {
+		m["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		m["num_predict"] = opts.MaxTokens
+	}
+	if opts.TopP != nil {
+		m["top_p"] = *opts.TopP
+	}
+	if len(opts.Stop) > 0 {
+		m["stop"] = opts.Stop
+	}
+	if opts.Seed != nil {
+		m["seed"] = *opts.Seed
 	}
-	return usage, nil
+	return m
 }
 
 // 在 init 中注册到全局表，实现“热插拔”
 func init() {
-	provider.Register("ollama", New("llama3"))
+	provider.Register("ollama", func(cfg provider.Config) (provider.Provider, error) {
+		return New(cfg)
+	})
 }
@@ -2,43 +2,146 @@ package openai
 
 import (
 	"context"
+	"errors"
 	"io"
+	"math"
+	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 	"gollm-mini/internal/provider"
+	"gollm-mini/internal/tokenizer"
 	"gollm-mini/internal/types"
 )
 
 type OpenAI struct {
-	client *openai.Client
-	model  string
+	client       *openai.Client
+	model        string
+	includeUsage bool // 流式请求附带 stream_options.include_usage
 }
 
-func (o *OpenAI) SetModel(m string) { o.model = m }
+const defaultModel = "gpt-3.5-turbo"
 
-func New(model string) *OpenAI {
+// New 按 Config 构造；APIKey 为空时读 OPENAI_API_KEY
+func New(cfg provider.Config) (*OpenAI, error) {
+	if cfg.Model == "" {
+		cfg.Model = defaultModel
+	}
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	return newClient(cfg), nil
+}
+
+// NewCompatible 连接 vLLM / llama.cpp server / LM Studio 等 OpenAI 兼容后端；
+// BaseURL 与 Model 必填，APIKey 可为空（本地服务通常不校验）
+func NewCompatible(cfg provider.Config) (*OpenAI, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("openai-compatible: base_url is required")
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("openai-compatible: model is required")
+	}
+	return newClient(cfg), nil
+}
+
+func newClient(cfg provider.Config) *OpenAI {
+	oc := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		oc.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	}
+	oc.HTTPClient = &http.Client{Transport: retryAfterTransport{base: http.DefaultTransport}}
 	return &OpenAI{
-		client: openai.NewClient(os.Getenv("OPENAI_API_KEY")),
-		model:  model,
+		client: openai.NewClientWithConfig(oc),
+		model:  cfg.Model,
+		// 个别兼容后端不认 stream_options，可用 options.include_usage=false 关闭
+		includeUsage: cfg.Options["include_usage"] != "false",
 	}
 }
 
 // ----------- 非流式 --------------------------------------------------------
 
-func (o *OpenAI) Generate(ctx context.Context, msgs []types.Message) (string, types.Usage, error) {
-	req := o.buildRequest(msgs, false)
+// Model 实际使用的模型（provider.ModelNamer）
+func (o *OpenAI) Model() string { return o.model }
+
+func (o *OpenAI) Generate(ctx context.Context, msgs []types.Message, opts types.GenerateOptions) (string, types.Usage, error) {
+	req := o.buildRequest(msgs, opts, false)
 
+	ctx, ra := withRetryAfter(ctx)
 	resp, err := o.client.CreateChatCompletion(ctx, *req)
 	if err != nil {
-		return "", types.Usage{}, err
+		return "", types.Usage{}, wrapErr(err, ra)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", types.Usage{}, errors.New("openai: empty choices")
+	}
+	txt := resp.Choices[0].Message.Content
+	u := types.Usage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}
+	if u.Total() == 0 { // 部分兼容后端不返回 usage
+		u = o.estimateUsage(msgs, txt)
+	}
+	return txt, u, nil
+}
+
+// estimateUsage 用本地分词器估算 usage
+func (o *OpenAI) estimateUsage(msgs []types.Message, completion string) types.Usage {
+	tk := tokenizer.ForModel(o.model)
+	return types.Usage{
+		PromptTokens:     tokenizer.CountMessages(tk, msgs),
+		CompletionTokens: tk.Count(completion),
+	}
+}
+
+// ----------- 函数调用 --------------------------------------------------------
+
+func (o *OpenAI) GenerateWithTools(
+	ctx context.Context,
+	msgs []types.Message,
+	tools []types.Tool,
+	opts types.GenerateOptions,
+) (types.Message, types.Usage, error) {
+	req := o.buildRequest(msgs, opts, false)
+	for _, t := range tools {
+		req.Tools = append(req.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
 	}
 
+	ctx, ra := withRetryAfter(ctx)
+	resp, err := o.client.CreateChatCompletion(ctx, *req)
+	if err != nil {
+		return types.Message{}, types.Usage{}, wrapErr(err, ra)
+	}
 	u := types.Usage{
 		PromptTokens:     resp.Usage.PromptTokens,
 		CompletionTokens: resp.Usage.CompletionTokens,
 	}
-	return resp.Choices[0].Message.Content, u, nil
+	if len(resp.Choices) == 0 {
+		return types.Message{}, u, errors.New("openai: empty choices")
+	}
+
+	rm := resp.Choices[0].Message
+	out := types.Message{Role: types.RoleAssistant, Content: rm.Content}
+	for _, tc := range rm.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, types.ToolCall{
+			ID:        tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	return out, u, nil
 }
 
 // ----------- 流式 ----------------------------------------------------------
@@ -46,28 +149,42 @@ func (o *OpenAI) Generate(ctx context.Context, msgs []types.Message) (string, ty
 func (o *OpenAI) Stream(
 	ctx context.Context,
 	msgs []types.Message,
+	opts types.GenerateOptions,
 	cb func(types.Chunk),
 ) (types.Usage, error) {
 
-	req := o.buildRequest(msgs, true)
+	req := o.buildRequest(msgs, opts, true)
 
+	ctx, ra := withRetryAfter(ctx)
 	stream, err := o.client.CreateChatCompletionStream(ctx, *req)
 	if err != nil {
-		return types.Usage{}, err
+		return types.Usage{}, wrapErr(err, ra)
 	}
 	defer stream.Close()
 
-	var usage types.Usage
-
+	var (
+		usage    types.Usage
+		reported bool
+		text     strings.Builder
+		tk       = tokenizer.ForModel(o.model)
+	)
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
 			if err == io.EOF { // 流结束
 				break
 			}
-			return usage, err
+			return usage, wrapErr(err, ra)
 		}
 
+		// include_usage 时最后一块 choices 为空，只带 usage
+		if resp.Usage != nil {
+			usage = types.Usage{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+			}
+			reported = true
+		}
 		if len(resp.Choices) == 0 {
 			continue
 		}
@@ -76,33 +193,137 @@ func (o *OpenAI) Stream(
 		if delta == "" {
 			continue
 		}
-
-		cb(types.Chunk{Content: delta, Delta: 1}) // 每块按 1 token 计
-		usage.CompletionTokens++
+		text.WriteString(delta)
+		cb(types.Chunk{Content: delta, Delta: tk.Count(delta)})
 	}
 
-	// PromptTokens 暂无法从 SDK 拿到，可在此处自行调用 tiktoken 计算
-	usage.PromptTokens = 0
+	// 后端未返回 usage 时用本地分词器估算
+	if !reported {
+		usage = o.estimateUsage(msgs, text.String())
+	}
 	return usage, nil
 }
 
+// ListModels 调用 /v1/models
+func (o *OpenAI) ListModels(ctx context.Context) ([]string, error) {
+	ctx, ra := withRetryAfter(ctx)
+	list, err := o.client.ListModels(ctx)
+	if err != nil {
+		return nil, wrapErr(err, ra)
+	}
+	names := make([]string, 0, len(list.Models))
+	for _, m := range list.Models {
+		names = append(names, m.ID)
+	}
+	return names, nil
+}
+
+// ----------- 错误归类 --------------------------------------------------------
+
+// wrapErr 把 SDK 错误转换为 provider.Error；ra 为本次调用最后一次响应的 Retry-After
+func wrapErr(err error, ra *atomic.Int64) error {
+	var (
+		apiErr *openai.APIError
+		reqErr *openai.RequestError
+		pe     *provider.Error
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		pe = provider.FromStatus(apiErr.HTTPStatusCode, apiErr.Message, nil)
+		if code, _ := apiErr.Code.(string); code == "context_length_exceeded" {
+			pe.Kind = provider.KindContextLength
+		}
+	case errors.As(err, &reqErr):
+		pe = provider.FromStatus(reqErr.HTTPStatusCode, reqErr.Error(), nil)
+	default:
+		return provider.Classify(err)
+	}
+	pe.Err = err
+	if pe.Kind == provider.KindRateLimit || pe.Kind == provider.KindOverloaded {
+		pe.RetryAfter = time.Duration(ra.Load())
+	}
+	return pe
+}
+
+type retryAfterKey struct{}
+
+// withRetryAfter 给一次调用挂上独立的 Retry-After 记录（纳秒），并发调用互不覆盖
+func withRetryAfter(ctx context.Context) (context.Context, *atomic.Int64) {
+	ra := new(atomic.Int64)
+	return context.WithValue(ctx, retryAfterKey{}, ra), ra
+}
+
+// retryAfterTransport 把 429 / 503 响应的 Retry-After 写入请求 ctx 中的记录（SDK 错误里不带响应头）；
+// 每次往返先清零，其他响应或不带该头时为 0
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ra, _ := req.Context().Value(retryAfterKey{}).(*atomic.Int64)
+	if ra != nil {
+		ra.Store(0)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if ra != nil && err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		ra.Store(int64(provider.ParseRetryAfter(resp.Header.Get("Retry-After"))))
+	}
+	return resp, err
+}
+
 // ----------- 工具 & 注册 ----------------------------------------------------
 
-func (o *OpenAI) buildRequest(msgs []types.Message, stream bool) *openai.ChatCompletionRequest {
+func (o *OpenAI) buildRequest(msgs []types.Message, opts types.GenerateOptions, stream bool) *openai.ChatCompletionRequest {
 	cm := make([]openai.ChatCompletionMessage, len(msgs))
 	for i, m := range msgs {
 		cm[i] = openai.ChatCompletionMessage{
-			Role:    string(m.Role),
-			Content: m.Content,
+			Role:       string(m.Role),
+			Content:    m.Content,
+			ToolCallID: m.ToolCallID,
+		}
+		for _, tc := range m.ToolCalls {
+			cm[i].ToolCalls = append(cm[i].ToolCalls, openai.ToolCall{
+				ID:       tc.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+			})
 		}
 	}
-	return &openai.ChatCompletionRequest{
-		Model:    o.model,
-		Messages: cm,
-		Stream:   stream,
+	req := &openai.ChatCompletionRequest{
+		Model:     o.model,
+		Messages:  cm,
+		Stream:    stream,
+		MaxTokens: opts.MaxTokens,
+		Stop:      opts.Stop,
+		Seed:      opts.Seed,
+	}
+	if stream && o.includeUsage {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	if opts.Temperature != nil {
+		req.Temperature = explicit(*opts.Temperature)
+	}
+	if opts.TopP != nil {
+		req.TopP = explicit(*opts.TopP)
+	}
+	return req
+}
+
+// explicit SDK 的 temperature / top_p 带 omitempty，显式的 0 会被丢掉而回落到服务端默认值 1；
+// 按 go-openai 的建议改发 math.SmallestNonzeroFloat32
+func explicit(v float64) float32 {
+	if v == 0 {
+		return math.SmallestNonzeroFloat32
 	}
+	return float32(v)
 }
 
 func init() {
-	provider.Register("openai", New("gpt-3.5-turbo"))
+	provider.Register("openai", func(cfg provider.Config) (provider.Provider, error) {
+		return New(cfg)
+	})
+	// 具名实例通过 provider.RegisterSpec 以此为 type 注册
+	provider.Register("openai-compatible", func(cfg provider.Config) (provider.Provider, error) {
+		return NewCompatible(cfg)
+	})
 }
@@ -0,0 +1,195 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/types"
+)
+
+// seen 后端收到的一次请求
+type seen struct {
+	Path, Auth, Model string
+}
+
+// fakeBackend OpenAI 兼容后端：记录请求，回复 "<path> <model>"
+func fakeBackend(t *testing.T) (*httptest.Server, func() []seen) {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		log []seen
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		log = append(log, seen{Path: r.URL.Path, Auth: r.Header.Get("Authorization"), Model: req.Model})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			r.URL.Path+" "+req.Model)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []seen {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]seen(nil), log...)
+	}
+}
+
+func generate(t *testing.T, p provider.Provider) (string, types.Usage) {
+	t.Helper()
+	txt, u, err := p.Generate(context.Background(), []types.Message{{Role: types.RoleUser, Content: "hi"}}, types.GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txt, u
+}
+
+func TestNewCompatibleRequiresBaseURLAndModel(t *testing.T) {
+	if _, err := NewCompatible(provider.Config{Model: "m"}); err == nil {
+		t.Error("missing base_url: want error")
+	}
+	if _, err := NewCompatible(provider.Config{BaseURL: "http://localhost:1/v1"}); err == nil {
+		t.Error("missing model: want error")
+	}
+}
+
+func TestNewCompatibleWiring(t *testing.T) {
+	srv, requests := fakeBackend(t)
+	p, err := NewCompatible(provider.Config{BaseURL: srv.URL + "/v1/", Model: "qwen2.5-7b", APIKey: "sk-local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt, u := generate(t, p)
+	if txt != "/v1/chat/completions qwen2.5-7b" {
+		t.Errorf("reply %q", txt)
+	}
+	if u.PromptTokens != 3 || u.CompletionTokens != 2 {
+		t.Errorf("usage %+v", u)
+	}
+	want := seen{Path: "/v1/chat/completions", Auth: "Bearer sk-local", Model: "qwen2.5-7b"}
+	if got := requests(); len(got) != 1 || got[0] != want {
+		t.Errorf("requests %+v, want [%+v]", got, want)
+	}
+}
+
+// 两个具名实例指向同一后端的不同路径，各自的 base_url / model / api_key 互不影响；请求中的 model 优先。
+// 未配置 api_key 的实例不发送 Authorization
+func TestSpecFileNamedInstances(t *testing.T) {
+	srv, requests := fakeBackend(t)
+	specs := []provider.Spec{
+		{Name: "vllm-a", Type: "openai-compatible", Config: provider.Config{BaseURL: srv.URL + "/a/v1", Model: "qwen", APIKey: "key-a"}},
+		{Name: "vllm-b", Type: "openai-compatible", Config: provider.Config{BaseURL: srv.URL + "/b/v1", Model: "llama"}},
+	}
+	data, _ := json.Marshal(specs)
+	path := filepath.Join(t.TempDir(), "providers.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.LoadSpecs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		cfg   provider.Config
+		reply string
+		seen  seen
+	}{
+		{"vllm-a", provider.Config{}, "/a/v1/chat/completions qwen", seen{"/a/v1/chat/completions", "Bearer key-a", "qwen"}},
+		{"vllm-b", provider.Config{}, "/b/v1/chat/completions llama", seen{"/b/v1/chat/completions", "", "llama"}},
+		{"vllm-b", provider.Config{Model: "llama-70b"}, "/b/v1/chat/completions llama-70b", seen{"/b/v1/chat/completions", "", "llama-70b"}},
+	}
+	for i, tc := range cases {
+		p, err := provider.New(tc.name, tc.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txt, _ := generate(t, p); txt != tc.reply {
+			t.Errorf("%s: reply %q, want %q", tc.name, txt, tc.reply)
+		}
+		got := requests()
+		if len(got) != i+1 {
+			t.Fatalf("%s: %d requests", tc.name, len(got))
+		}
+		if last := got[i]; last != tc.seen {
+			t.Errorf("%s: request %+v, want %+v", tc.name, last, tc.seen)
+		}
+	}
+}
+
+// Retry-After 只属于带它的那次响应：之后不带该头的 429 不会沿用旧值
+func TestRetryAfterPerRequest(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"slow down","type":"rate_limit"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	p, err := NewCompatible(provider.Config{BaseURL: srv.URL + "/v1", Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []time.Duration{7 * time.Second, 0} {
+		_, _, err := p.Generate(context.Background(), []types.Message{{Role: types.RoleUser, Content: "hi"}}, types.GenerateOptions{})
+		var pe *provider.Error
+		if !errors.As(err, &pe) || pe.Kind != provider.KindRateLimit {
+			t.Fatalf("call %d: err %v, want rate_limit", i, err)
+		}
+		if pe.RetryAfter != want {
+			t.Errorf("call %d: retry after %v, want %v", i, pe.RetryAfter, want)
+		}
+	}
+}
+
+// 显式的 temperature / top_p = 0 必须出现在请求体中，否则服务端回落到默认值 1
+func TestExplicitZeroSampling(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	p, err := NewCompatible(provider.Config{BaseURL: srv.URL + "/v1", Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := 0.0
+	opts := types.GenerateOptions{Temperature: &zero, TopP: &zero}
+	if _, _, err := p.Generate(context.Background(), []types.Message{{Role: types.RoleUser, Content: "hi"}}, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"temperature", "top_p"} {
+		v, ok := body[k].(float64)
+		if !ok || v < 0 || v > 1e-6 {
+			t.Errorf("%s = %v (present %v), want an explicit ~0", k, body[k], ok)
+		}
+	}
+
+	body = nil
+	if _, _, err := p.Generate(context.Background(), []types.Message{{Role: types.RoleUser, Content: "hi"}}, types.GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["temperature"]; ok {
+		t.Errorf("unset temperature sent: %v", body["temperature"])
+	}
+}
@@ -8,12 +8,59 @@ import (
 
 type Provider interface {
 	//Generate 核心能力：把若干消息发给模型，返回一段文本
-	Generate(ctx context.Context, messages []types.Message) (text string, usage types.Usage, err error)
+	Generate(ctx context.Context, messages []types.Message, opts types.GenerateOptions) (text string, usage types.Usage, err error)
 
 	// Stream 可选实现；未实现时由 core 层降级到 Generate
-	Stream(ctx context.Context, messages []types.Message, cb func(types.Chunk)) (usage types.Usage, err error)
+	Stream(ctx context.Context, messages []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (usage types.Usage, err error)
 }
 
-type ModelSetter interface {
-	SetModel(string)
+// Config 构造 Provider 实例所需的参数；空字段由各 Provider 使用自身默认值
+type Config struct {
+	Model   string            `json:"model,omitempty" yaml:"model,omitempty"`
+	BaseURL string            `json:"base_url,omitempty" yaml:"base_url,omitempty"`
+	APIKey  string            `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	Options map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// Factory 每次调用都返回一个全新的、互不共享状态的 Provider
+type Factory func(cfg Config) (Provider, error)
+
+// ToolCaller 可选实现：支持原生函数调用的 Provider。
+// 返回的 assistant 消息要么带 ToolCalls，要么是最终回答。
+type ToolCaller interface {
+	GenerateWithTools(ctx context.Context, messages []types.Message, tools []types.Tool, opts types.GenerateOptions) (types.Message, types.Usage, error)
+}
+
+// ModelNamer 可选实现：返回实例实际使用的模型名（Config.Model 为空时的默认模型、spec 合并后的模型）
+type ModelNamer interface {
+	Model() string
+}
+
+// ModelLister 可选实现：列出后端当前可用的模型
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// Merge 以 c 为准，空字段回落到 def；Options 按 key 合并
+func (c Config) Merge(def Config) Config {
+	if c.Model == "" {
+		c.Model = def.Model
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = def.BaseURL
+	}
+	if c.APIKey == "" {
+		c.APIKey = def.APIKey
+	}
+	if len(def.Options) > 0 {
+		opts := make(map[string]string, len(def.Options)+len(c.Options))
+		for k, v := range def.Options {
+			opts[k] = v
+		}
+		for k, v := range c.Options {
+			opts[k] = v
+		}
+		c.Options = opts
+	}
+	return c
 }
@@ -1,17 +1,60 @@
 package provider
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
 
-var registry = map[string]Provider{}
+// registry 为代码注册的工厂；specs 为配置声明的具名实例，同名时优先
+var (
+	mu       sync.RWMutex
+	registry = map[string]Factory{}
+	specs    = map[string]Factory{}
+)
 
-func Register(name string, p Provider) {
-	registry[name] = p
+// Register 注册 Provider 工厂；同名覆盖
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[name] = f
 }
 
-func Get(name string) (Provider, error) {
-	p, ok := registry[name]
+// New 按名称构造一个独立的 Provider 实例
+func New(name string, cfg Config) (Provider, error) {
+	mu.RLock()
+	f, ok := lookup(name)
+	mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("provider %s not registered", name)
 	}
-	return p, nil
+	return f(cfg)
+}
+
+// lookup 需持有 mu
+func lookup(name string) (Factory, bool) {
+	if f, ok := specs[name]; ok {
+		return f, true
+	}
+	f, ok := registry[name]
+	return f, ok
+}
+
+// Names 返回已注册的 Provider 名称（升序）
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	set := make(map[string]bool, len(registry)+len(specs))
+	for n := range registry {
+		set[n] = true
+	}
+	for n := range specs {
+		set[n] = true
+	}
+	names := make([]string, 0, len(set))
+	for n := range set {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
 }
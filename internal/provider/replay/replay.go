@@ -0,0 +1,308 @@
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/types"
+)
+
+// Mode 录制 / 回放方式
+type Mode string
+
+const (
+	ModeRecord Mode = "record" // 总是调用真实 Provider 并写入 cassette
+	ModeReplay Mode = "replay" // 只从 cassette 回放，未命中即报错（CI 用）
+	ModeAuto   Mode = "auto"   // 命中回放，未命中录制
+)
+
+// ErrNoInteraction 回放模式下找不到匹配的请求
+var ErrNoInteraction = errors.New("replay: no recorded interaction for request")
+
+// Interaction 一次请求 / 响应对
+type Interaction struct {
+	Key     string          `json:"key"`
+	Kind    string          `json:"kind"` // generate / stream / tools
+	Request json.RawMessage `json:"request"`
+
+	Text    string         `json:"text,omitempty"`
+	Chunks  []string       `json:"chunks,omitempty"`
+	Deltas  []int          `json:"deltas,omitempty"` // 与 Chunks 一一对应的 token 数
+	Message *types.Message `json:"message,omitempty"`
+	Usage   types.Usage    `json:"usage"`
+	Err     string         `json:"error,omitempty"`
+
+	// 录制到 *provider.Error 时保留分类，回放后重试 / fallback 的判断与线上一致
+	ErrKind    provider.ErrorKind `json:"error_kind,omitempty"`
+	ErrStatus  int                `json:"error_status,omitempty"`
+	RetryAfter time.Duration      `json:"retry_after,omitempty"`
+}
+
+// cassette 同一文件在进程内共享，按请求新建的 Recorder 不会互相覆盖
+type cassette struct {
+	mu           sync.Mutex
+	path         string
+	Interactions []Interaction  `json:"interactions"`
+	used         map[string]int // key → 已回放次数，相同请求按录制顺序依次回放
+}
+
+var (
+	cassetteMu sync.Mutex
+	cassettes  = map[string]*cassette{}
+)
+
+func load(path string) (*cassette, error) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if c, ok := cassettes[path]; ok {
+		return c, nil
+	}
+	c := &cassette{path: path, used: map[string]int{}}
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("replay: parse %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	cassettes[path] = c
+	return c, nil
+}
+
+func (c *cassette) find(key string) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := 0
+	for _, it := range c.Interactions {
+		if it.Key != key {
+			continue
+		}
+		if seen == c.used[key] {
+			c.used[key]++
+			return it, true
+		}
+		seen++
+	}
+	return Interaction{}, false
+}
+
+func (c *cassette) add(it Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, it)
+	c.used[it.Key]++
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(c, "", "  ")
+	return os.WriteFile(c.path, b, 0o644)
+}
+
+// Recorder 包装真实 Provider，把请求 / 响应写入 cassette 文件并逐字节回放
+type Recorder struct {
+	inner provider.Provider
+	c     *cassette
+	mode  Mode
+	model string // 配置的模型，inner 不提供时用于 Model()
+}
+
+// New inner 在 ModeReplay 下可为 nil
+func New(inner provider.Provider, path string, mode Mode) (*Recorder, error) {
+	switch mode {
+	case ModeRecord, ModeReplay, ModeAuto:
+	default:
+		return nil, fmt.Errorf("replay: unknown mode %q", mode)
+	}
+	if inner == nil && mode != ModeReplay {
+		return nil, errors.New("replay: inner provider required for " + string(mode))
+	}
+	c, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{inner: inner, c: c, mode: mode}, nil
+}
+
+func requestKey(kind string, req any) (string, json.RawMessage) {
+	raw, _ := json.Marshal(req)
+	sum := sha256.Sum256(append([]byte(kind+"|"), raw...))
+	return fmt.Sprintf("%x", sum), raw
+}
+
+// Model 优先取 inner 实际使用的模型，回放时（无 inner）取配置值
+func (r *Recorder) Model() string {
+	if mn, ok := r.inner.(provider.ModelNamer); ok && mn.Model() != "" {
+		return mn.Model()
+	}
+	return r.model
+}
+
+// lookup 回放命中返回 true；ModeReplay 未命中返回 ErrNoInteraction
+func (r *Recorder) lookup(key string) (Interaction, bool, error) {
+	if r.mode == ModeRecord {
+		return Interaction{}, false, nil
+	}
+	if it, ok := r.c.find(key); ok {
+		return it, true, nil
+	}
+	if r.mode == ModeReplay {
+		return Interaction{}, false, ErrNoInteraction
+	}
+	return Interaction{}, false, nil
+}
+
+// errOf 还原录制的错误；带分类的重建为 *provider.Error
+func errOf(it Interaction) error {
+	if it.Err == "" {
+		return nil
+	}
+	if it.ErrKind == "" {
+		return errors.New(it.Err)
+	}
+	return &provider.Error{Kind: it.ErrKind, Status: it.ErrStatus, RetryAfter: it.RetryAfter, Err: errors.New(it.Err)}
+}
+
+// withErr 把 err 记入 it；*provider.Error 只存内层信息，回放时再包一层不会重复前缀
+func withErr(it Interaction, err error) Interaction {
+	if err == nil {
+		return it
+	}
+	it.Err = err.Error()
+	var pe *provider.Error
+	if errors.As(err, &pe) {
+		it.ErrKind, it.ErrStatus, it.RetryAfter = pe.Kind, pe.Status, pe.RetryAfter
+		if pe.Err != nil {
+			it.Err = pe.Err.Error()
+		}
+	}
+	return it
+}
+
+func (r *Recorder) Generate(ctx context.Context, msgs []types.Message, opts types.GenerateOptions) (string, types.Usage, error) {
+	key, raw := requestKey("generate", struct {
+		Messages []types.Message       `json:"messages"`
+		Options  types.GenerateOptions `json:"options"`
+	}{msgs, opts})
+	it, ok, err := r.lookup(key)
+	if err != nil {
+		return "", types.Usage{}, err
+	}
+	if ok {
+		return it.Text, it.Usage, errOf(it)
+	}
+
+	txt, usage, err := r.inner.Generate(ctx, msgs, opts)
+	if werr := r.c.add(withErr(Interaction{Key: key, Kind: "generate", Request: raw, Text: txt, Usage: usage}, err)); werr != nil {
+		return txt, usage, werr
+	}
+	return txt, usage, err
+}
+
+func (r *Recorder) Stream(ctx context.Context, msgs []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	key, raw := requestKey("stream", struct {
+		Messages []types.Message       `json:"messages"`
+		Options  types.GenerateOptions `json:"options"`
+	}{msgs, opts})
+	it, ok, err := r.lookup(key)
+	if err != nil {
+		return types.Usage{}, err
+	}
+	if ok {
+		for i, c := range it.Chunks {
+			delta := 1 // 没有 deltas 的旧 cassette
+			if i < len(it.Deltas) {
+				delta = it.Deltas[i]
+			}
+			cb(types.Chunk{Content: c, Delta: delta})
+		}
+		return it.Usage, errOf(it)
+	}
+
+	var (
+		chunks []string
+		deltas []int
+	)
+	usage, err := r.inner.Stream(ctx, msgs, opts, func(ch types.Chunk) {
+		chunks = append(chunks, ch.Content)
+		deltas = append(deltas, ch.Delta)
+		cb(ch)
+	})
+	if werr := r.c.add(withErr(Interaction{Key: key, Kind: "stream", Request: raw, Chunks: chunks, Deltas: deltas, Usage: usage}, err)); werr != nil {
+		return usage, werr
+	}
+	return usage, err
+}
+
+func (r *Recorder) GenerateWithTools(ctx context.Context, msgs []types.Message, tools []types.Tool, opts types.GenerateOptions) (types.Message, types.Usage, error) {
+	key, raw := requestKey("tools", struct {
+		Messages []types.Message       `json:"messages"`
+		Tools    []types.Tool          `json:"tools"`
+		Options  types.GenerateOptions `json:"options"`
+	}{msgs, tools, opts})
+	it, ok, err := r.lookup(key)
+	if err != nil {
+		return types.Message{}, types.Usage{}, err
+	}
+	if ok {
+		var m types.Message
+		if it.Message != nil {
+			m = *it.Message
+		}
+		return m, it.Usage, errOf(it)
+	}
+
+	tc, ok := r.inner.(provider.ToolCaller)
+	if !ok {
+		return types.Message{}, types.Usage{}, errors.New("replay: inner provider does not support tools")
+	}
+	m, usage, err := tc.GenerateWithTools(ctx, msgs, tools, opts)
+	if werr := r.c.add(withErr(Interaction{Key: key, Kind: "tools", Request: raw, Message: &m, Usage: usage}, err)); werr != nil {
+		return m, usage, werr
+	}
+	return m, usage, err
+}
+
+// 通过 Spec 使用，例如
+//
+//	{"name": "ollama-rec", "type": "replay", "model": "llama3",
+//	 "options": {"inner": "ollama", "cassette": "testdata/chat.json", "mode": "auto"}}
+//
+// model / base_url / api_key 透传给 inner。
+func init() {
+	provider.Register("replay", func(cfg provider.Config) (provider.Provider, error) {
+		path := cfg.Options["cassette"]
+		if path == "" {
+			return nil, errors.New("replay: options.cassette is required")
+		}
+		mode := Mode(cfg.Options["mode"])
+		if mode == "" {
+			mode = ModeReplay
+		}
+		var inner provider.Provider
+		if name := cfg.Options["inner"]; name != "" && mode != ModeReplay {
+			innerCfg := cfg
+			innerCfg.Options = nil
+			p, err := provider.New(name, innerCfg)
+			if err != nil {
+				return nil, err
+			}
+			inner = p
+		}
+		r, err := New(inner, path, mode)
+		if err != nil {
+			return nil, err
+		}
+		r.model = cfg.Model
+		return r, nil
+	})
+}
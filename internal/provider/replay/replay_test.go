@@ -0,0 +1,136 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/types"
+)
+
+// counting 流式片段的 Delta 为字节数，便于确认回放的是录制值而不是常数
+type counting struct{ calls int }
+
+func (c *counting) Generate(_ context.Context, msgs []types.Message, _ types.GenerateOptions) (string, types.Usage, error) {
+	c.calls++
+	return "re: " + msgs[len(msgs)-1].Content, types.Usage{PromptTokens: 4, CompletionTokens: 2}, nil
+}
+
+func (c *counting) Stream(_ context.Context, _ []types.Message, _ types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	c.calls++
+	for _, s := range []string{"Hel", "lo, ", "world"} {
+		cb(types.Chunk{Content: s, Delta: len(s)})
+	}
+	return types.Usage{PromptTokens: 4, CompletionTokens: 12}, nil
+}
+
+// forget 丢弃进程内缓存的 cassette，模拟新进程重新读取文件
+func forget(path string) {
+	cassetteMu.Lock()
+	delete(cassettes, path)
+	cassetteMu.Unlock()
+}
+
+var msgs = []types.Message{{Role: types.RoleUser, Content: "hi"}}
+
+func TestReplayGenerate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generate.json")
+	inner := &counting{}
+	rec, err := New(inner, path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantUsage, err := rec.Generate(context.Background(), msgs, types.GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forget(path)
+	rep, err := New(nil, path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, usage, err := rep.Generate(context.Background(), msgs, types.GenerateOptions{})
+	if err != nil || got != want || usage != wantUsage {
+		t.Errorf("replay = %q %+v %v, want %q %+v", got, usage, err, want, wantUsage)
+	}
+	if _, _, err := rep.Generate(context.Background(), []types.Message{{Role: types.RoleUser, Content: "other"}}, types.GenerateOptions{}); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("unrecorded request: err %v, want ErrNoInteraction", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("inner called %d times, want 1", inner.calls)
+	}
+}
+
+func TestReplayStreamDeltas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.json")
+	collect := func(p *Recorder) ([]types.Chunk, types.Usage) {
+		t.Helper()
+		var chunks []types.Chunk
+		u, err := p.Stream(context.Background(), msgs, types.GenerateOptions{}, func(ch types.Chunk) { chunks = append(chunks, ch) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunks, u
+	}
+
+	rec, err := New(&counting{}, path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantUsage := collect(rec)
+
+	forget(path)
+	rep, err := New(nil, path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, usage := collect(rep)
+	if !reflect.DeepEqual(got, want) || usage != wantUsage {
+		t.Errorf("replay = %+v %+v, want %+v %+v", got, usage, want, wantUsage)
+	}
+}
+
+// failing 总是返回带 Retry-After 的限流错误
+type failing struct{}
+
+func (failing) Generate(context.Context, []types.Message, types.GenerateOptions) (string, types.Usage, error) {
+	return "", types.Usage{}, &provider.Error{Kind: provider.KindRateLimit, Status: 429, RetryAfter: 3 * time.Second, Err: errors.New("slow down")}
+}
+
+func (failing) Stream(context.Context, []types.Message, types.GenerateOptions, func(types.Chunk)) (types.Usage, error) {
+	return types.Usage{}, errors.New("plain")
+}
+
+// 回放的错误保留分类、状态码与 Retry-After
+func TestReplayErrorKind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "errors.json")
+	rec, err := New(failing{}, path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, want := rec.Generate(context.Background(), msgs, types.GenerateOptions{})
+	_, wantPlain := rec.Stream(context.Background(), msgs, types.GenerateOptions{}, func(types.Chunk) {})
+
+	forget(path)
+	rep, err := New(nil, path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, got := rep.Generate(context.Background(), msgs, types.GenerateOptions{})
+	var pe *provider.Error
+	if !errors.As(got, &pe) || pe.Kind != provider.KindRateLimit || pe.Status != 429 || pe.RetryAfter != 3*time.Second {
+		t.Fatalf("replayed %#v, want rate_limit 429 retry after 3s", got)
+	}
+	if got.Error() != want.Error() {
+		t.Errorf("message %q, want %q", got, want)
+	}
+	_, plain := rep.Stream(context.Background(), msgs, types.GenerateOptions{}, func(types.Chunk) {})
+	if plain == nil || plain.Error() != wantPlain.Error() || errors.As(plain, &pe) {
+		t.Errorf("plain error replayed as %#v", plain)
+	}
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Spec 描述一个具名 Provider 实例，例如
+//
+//	{"name": "vllm-a", "type": "openai-compatible", "base_url": "http://gpu-a:8000/v1", "model": "qwen2.5-7b"}
+//
+// Type 为已注册的工厂名，其余字段作为该实例的默认 Config。
+type Spec struct {
+	Name   string `json:"name" yaml:"name"`
+	Type   string `json:"type" yaml:"type"`
+	Config `yaml:",inline"`
+}
+
+// RegisterSpec 以 spec.Type 的工厂为基础注册 spec.Name；请求未指定的字段回落到 spec
+func RegisterSpec(s Spec) error {
+	mu.Lock()
+	defer mu.Unlock()
+	f, err := specFactory(s, lookup)
+	if err != nil {
+		return err
+	}
+	specs[s.Name] = f
+	return nil
+}
+
+// ReplaceSpecs 用 list 整体替换已注册的 spec（热加载）。
+// 全部校验通过才生效；已创建的 Provider 实例不受影响。
+// Type 可以是代码注册的工厂，也可以是 list 中排在前面的 spec
+func ReplaceSpecs(list []Spec) error {
+	mu.Lock()
+	defer mu.Unlock()
+	next := make(map[string]Factory, len(list))
+	find := func(name string) (Factory, bool) {
+		if f, ok := next[name]; ok {
+			return f, true
+		}
+		f, ok := registry[name]
+		return f, ok
+	}
+	for _, s := range list {
+		f, err := specFactory(s, find)
+		if err != nil {
+			return err
+		}
+		next[s.Name] = f
+	}
+	specs = next
+	return nil
+}
+
+func specFactory(s Spec, find func(string) (Factory, bool)) (Factory, error) {
+	if s.Name == "" || s.Type == "" {
+		return nil, fmt.Errorf("provider spec requires name and type")
+	}
+	base, ok := find(s.Type)
+	if !ok {
+		return nil, fmt.Errorf("provider spec %s: type %s not registered", s.Name, s.Type)
+	}
+	def := s.Config
+	return func(cfg Config) (Provider, error) {
+		return base(cfg.Merge(def))
+	}, nil
+}
+
+// ReadSpecs 读取 JSON 数组格式的 Spec 文件
+func ReadSpecs(path string) ([]Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Spec
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// LoadSpecs 读取 Spec 文件并逐个注册
+func LoadSpecs(path string) error {
+	list, err := ReadSpecs(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		if err := RegisterSpec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
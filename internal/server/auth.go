@@ -0,0 +1,216 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/apikey"
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/monitor"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+const (
+	ctxAPIKey = "apikey"
+	ctxTenant = "tenant"
+	ctxStatus = "status" // 覆盖 Key 请求指标的 status，默认 ok
+)
+
+const statusCancelled = "cancelled"
+
+// staticKey 配置文件 server.auth.api_keys 中的 Key：全部权限，不限额
+var staticKey = apikey.Key{ID: "static", Name: "config", Scopes: []string{apikey.ScopeAdmin}}
+
+// apiKeyAuth 校验 Authorization: Bearer <key> 或 X-API-Key（WebSocket 握手也可用 ?api_key=），先比对配置文件中的静态 Key，再查 Key 库。
+// 两者都为空时不鉴权；/health 与 /metrics 供探活与采集，不校验；静态 Key 随配置热加载
+func apiKeyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.URL.Path {
+		case "/health", "/metrics":
+			c.Next()
+			return
+		}
+		static := loadSettings().keys
+		n, err := apikey.Count()
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if len(static) == 0 && n == 0 {
+			c.Next()
+			return
+		}
+
+		secret := requestKey(c)
+		k, err := authenticate(secret, static)
+		switch {
+		case errors.Is(err, apikey.ErrNotFound):
+			monitor.KeyRequests.WithLabelValues("unknown", "unauthorized").Inc()
+			c.AbortWithStatusJSON(401, gin.H{"error": "invalid or missing api key"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		if err := apikey.Allow(k); err != nil {
+			monitor.KeyRequests.WithLabelValues(k.ID, "rate_limited").Inc()
+			c.AbortWithStatusJSON(429, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(ctxAPIKey, k)
+		c.Next()
+		if !c.IsAborted() {
+			status := "ok"
+			if v := c.GetString(ctxStatus); v != "" {
+				status = v
+			}
+			monitor.KeyRequests.WithLabelValues(k.ID, status).Inc()
+		}
+	}
+}
+
+func authenticate(secret string, static [][]byte) (apikey.Key, error) {
+	if secret == "" {
+		return apikey.Key{}, apikey.ErrNotFound
+	}
+	for _, s := range static {
+		if subtle.ConstantTimeCompare([]byte(secret), s) == 1 {
+			return staticKey, nil
+		}
+	}
+	return apikey.Lookup(secret)
+}
+
+// currentKey 本次请求使用的 Key；未启用鉴权时 ok 为 false
+func currentKey(c *gin.Context) (apikey.Key, bool) {
+	v, ok := c.Get(ctxAPIKey)
+	if !ok {
+		return apikey.Key{}, false
+	}
+	k, ok := v.(apikey.Key)
+	return k, ok
+}
+
+// require 要求 Key 具备 scope 权限
+func require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if k, ok := currentKey(c); ok && !k.Allows(scope) {
+			monitor.KeyRequests.WithLabelValues(k.ID, "forbidden").Inc()
+			c.AbortWithStatusJSON(403, gin.H{"error": "api key lacks scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// metered 用于调用模型的接口：调用前检查每日配额，用量由 handler 通过 noteUsage 上报
+func metered() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if k, ok := currentKey(c); ok && k.ID != staticKey.ID {
+			if err := apikey.CheckQuota(k); err != nil {
+				status := 500
+				if errors.Is(err, apikey.ErrQuotaExceeded) {
+					status = 429
+					monitor.KeyRequests.WithLabelValues(k.ID, "quota_exceeded").Inc()
+				}
+				c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// noteUsage 把一次调用的用量计入当前 Key；servedBy 为实际完成请求的 "provider:model"，用于计费
+func noteUsage(c *gin.Context, servedBy string, u types.Usage) {
+	if k, ok := currentKey(c); ok {
+		chargeKey(k, servedBy, u)
+	}
+}
+
+// chargeKey 记录 Key 的 token 与费用指标并累计每日用量（静态 Key 不累计）
+func chargeKey(k apikey.Key, servedBy string, u types.Usage) {
+	name, model, _ := strings.Cut(servedBy, ":")
+	cost := helper.CalcCost(name, model, u.PromptTokens, u.CompletionTokens)
+	monitor.KeyTokens.WithLabelValues(k.ID, "prompt").Add(float64(u.PromptTokens))
+	monitor.KeyTokens.WithLabelValues(k.ID, "completion").Add(float64(u.CompletionTokens))
+	if cost > 0 {
+		monitor.KeyCostUSD.WithLabelValues(k.ID).Add(cost)
+	}
+	if k.ID == staticKey.ID {
+		return
+	}
+	if _, err := apikey.Record(k.ID, u, cost); err != nil {
+		log.Printf("[AUTH] record usage for %s: %v", k.ID, err)
+	}
+}
+
+// tenantScope 确定请求所属租户：静态 Key、未绑定租户的 admin Key 与授予 apikey.AnyTenant 的 Key
+// 可用 X-Tenant 请求头（WebSocket 也可用 ?tenant=）选择，未指定为默认租户；
+// 其余 Key 固定为绑定的租户（未绑定即默认租户），未启用鉴权时固定为默认租户
+func tenantScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t := c.GetHeader("X-Tenant")
+		if t == "" && c.IsWebsocket() {
+			t = c.Query("tenant")
+		}
+		k, authed := currentKey(c)
+		bound, fixed := tenant.Default, true
+		if authed {
+			bound, fixed = k.BoundTenant()
+		}
+		if fixed {
+			if t != "" && t != bound {
+				if !authed {
+					c.AbortWithStatusJSON(403, gin.H{"error": "selecting a tenant requires an admin api key"})
+					return
+				}
+				monitor.KeyRequests.WithLabelValues(k.ID, "forbidden").Inc()
+				c.AbortWithStatusJSON(403, gin.H{"error": "api key is bound to tenant " + tenant.Name(bound)})
+				return
+			}
+			t = bound
+		}
+		if err := tenant.Validate(t); err != nil {
+			c.AbortWithStatusJSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(ctxTenant, t)
+		c.Next()
+	}
+}
+
+// tenantOf 本次请求所属租户
+func tenantOf(c *gin.Context) string { return c.GetString(ctxTenant) }
+
+// sessionID 把路径参数 sid 放入请求租户的命名空间；出错时已写 400
+func sessionID(c *gin.Context) (string, bool) {
+	return qualify(c, c.Param("sid"))
+}
+
+func qualify(c *gin.Context, id string) (string, bool) {
+	qid, err := tenant.Qualify(tenantOf(c), id)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return qid, true
+}
+
+func requestKey(c *gin.Context) string {
+	if k := c.GetHeader("X-API-Key"); k != "" {
+		return k
+	}
+	if k, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(k)
+	}
+	if c.IsWebsocket() {
+		return c.Query("api_key")
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/apikey"
+)
+
+// 只有未绑定租户的 admin Key 与授予 AnyTenant 的 Key 能用 X-Tenant 切换租户
+func TestTenantScope(t *testing.T) {
+	r := gin.New()
+	r.Use(apiKeyAuth(), tenantScope())
+	r.GET("/whoami", func(c *gin.Context) { c.String(200, "["+tenantOf(c)+"]") })
+	do := func(secret, tenant string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	// 未启用鉴权：只能使用默认租户
+	if code, body := do("", ""); code != 200 || body != "[]" {
+		t.Errorf("no auth: %d %s", code, body)
+	}
+	if code, _ := do("", "team-a"); code != 403 {
+		t.Errorf("no auth + X-Tenant: %d, want 403", code)
+	}
+
+	create := func(k apikey.Key) string {
+		t.Helper()
+		secret, info, err := apikey.Create(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = apikey.Delete(info.ID) })
+		return secret
+	}
+	chat := create(apikey.Key{Name: "chat"})
+	bound := create(apikey.Key{Name: "bound", Tenant: "team-a"})
+	admin := create(apikey.Key{Name: "admin", Scopes: []string{apikey.ScopeAdmin}})
+	boundAdmin := create(apikey.Key{Name: "bound-admin", Scopes: []string{apikey.ScopeAdmin}, Tenant: "team-a"})
+	wildcard := create(apikey.Key{Name: "any", Tenant: apikey.AnyTenant})
+
+	cases := []struct {
+		name, secret, header string
+		code                 int
+		tenant               string
+	}{
+		{"chat key", chat, "", 200, ""},
+		{"chat key selects tenant", chat, "team-b", 403, ""},
+		{"bound key", bound, "", 200, "team-a"},
+		{"bound key, own tenant", bound, "team-a", 200, "team-a"},
+		{"bound key, other tenant", bound, "team-b", 403, ""},
+		{"admin key", admin, "team-b", 200, "team-b"},
+		{"bound admin key", boundAdmin, "team-b", 403, ""},
+		{"any-tenant key", wildcard, "team-b", 200, "team-b"},
+		{"any-tenant key, default", wildcard, "", 200, ""},
+	}
+	for _, tc := range cases {
+		code, body := do(tc.secret, tc.header)
+		if code != tc.code || (code == 200 && body != "["+tc.tenant+"]") {
+			t.Errorf("%s: %d %s, want %d [%s]", tc.name, code, body, tc.code, tc.tenant)
+		}
+	}
+}
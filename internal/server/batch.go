@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/batch"
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/job"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/types"
+)
+
+/* ---------- batch jobs ---------- */
+
+const maxBatchConcurrency = 16
+
+// BatchRequest batch 任务的 payload：rows 每项为一行输入（模板变量或 messages，见 batch.Row），
+// 其余字段同 POST /chat，对每一行生效
+type BatchRequest struct {
+	types.ChatRequest
+	Rows        []json.RawMessage `json:"rows"`
+	Concurrency int               `json:"concurrency"` // 默认 4，最大 16
+}
+
+// BatchResult batch 任务的结果；逐行结果见 GET /jobs/:id/output
+type BatchResult struct {
+	batch.Summary
+	Output string `json:"output"`
+}
+
+func parseBatch(payload json.RawMessage) (BatchRequest, error) {
+	var req BatchRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return req, fmt.Errorf("invalid payload: %w", err)
+	}
+	switch {
+	case len(req.Rows) == 0:
+		return req, errors.New("rows are required")
+	case len(req.Messages) > 0:
+		return req, errors.New("put messages in rows for batch jobs")
+	case req.SessionID != "":
+		return req, errors.New("session_id is not supported in batch jobs")
+	case len(req.Tools) > 0:
+		return req, errors.New("tools are not supported in batch jobs")
+	case req.Concurrency < 0 || req.Concurrency > maxBatchConcurrency:
+		return req, fmt.Errorf("concurrency must be between 1 and %d", maxBatchConcurrency)
+	}
+	req.Stream = false
+	return req, nil
+}
+
+// checkBatch 提交时校验 payload 与 LLM 参数；行内错误在执行时逐行记录
+func checkBatch(payload json.RawMessage, t string) error {
+	req, err := parseBatch(payload)
+	if err != nil {
+		return err
+	}
+	_, err = newChatLLM(&req.ChatRequest, t)
+	return err
+}
+
+// runBatch 执行 batch 任务。输出文件按任务 ID 固定，进程重启后任务重新执行时跳过已成功的行
+func runBatch(ctx context.Context, j job.Job, store *template.Store, check func() error,
+	charge func(string, types.Usage), progress func(done, total int)) (any, error) {
+	req, err := parseBatch(j.Payload)
+	if err != nil {
+		return nil, err
+	}
+	var tpl *template.Template
+	if req.Tpl != "" {
+		t, err := store.Latest(req.Tpl)
+		if err != nil {
+			return nil, err
+		}
+		tpl = &t
+	}
+	var in bytes.Buffer
+	for _, row := range req.Rows {
+		if err := json.Compact(&in, row); err != nil { // 一行一条
+			return nil, fmt.Errorf("invalid row: %w", err)
+		}
+		in.WriteByte('\n')
+	}
+	path := batchOutput(j.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	sum, err := batch.Run(ctx, batch.Config{
+		Template:    tpl,
+		System:      req.System,
+		Schema:      req.Schema,
+		Options:     req.GenerateOptions,
+		Concurrency: req.Concurrency,
+		NewLLM: func() (*core.LLM, error) {
+			if err := check(); err != nil { // 每行前检查配额，超额的行记为失败
+				return nil, err
+			}
+			r := req.ChatRequest
+			return newChatLLM(&r, j.Tenant)
+		},
+		Progress: progress,
+		Usage:    charge,
+	}, &in, path)
+	if err != nil {
+		return nil, err
+	}
+	return BatchResult{Summary: sum, Output: "/jobs/" + j.ID + "/output"}, nil
+}
+
+// batchOutput batch 任务的输出文件：<data-dir>/batch/<job-id>.jsonl
+func batchOutput(id string) string {
+	return filepath.Join(storage.Current().Dir, "batch", id+".jsonl")
+}
+
+// removeBatchOutputs 删除租户 batch 任务的输出文件，在删除任务记录前调用
+func removeBatchOutputs(t string) error {
+	list, err := job.List(t, 0)
+	if err != nil {
+		return err
+	}
+	for _, j := range list {
+		if j.Kind != job.KindBatch {
+			continue
+		}
+		if err := os.Remove(batchOutput(j.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleJobOutput GET /jobs/:id/output 下载 batch 任务的逐行结果（执行中也可读取已完成的部分）
+func handleJobOutput(c *gin.Context) {
+	j, ok := tenantJob(c)
+	if !ok {
+		return
+	}
+	if j.Kind != job.KindBatch {
+		c.JSON(400, gin.H{"error": "only batch jobs have output"})
+		return
+	}
+	path := batchOutput(j.ID)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(404, gin.H{"error": "output not ready"})
+			return
+		}
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.File(path)
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/memory"
+	"gollm-mini/internal/types"
+)
+
+/* ---------- session branching ---------- */
+
+// EditRequest 编辑第 Index 条消息（从 0 计）；编辑 user 消息时按其余字段重新生成回答
+type EditRequest struct {
+	Index   *int   `json:"index"`
+	Content string `json:"content"`
+	types.ChatRequest
+}
+
+func handleMemoryTree(c *gin.Context) {
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	t, err := memory.GetTree(sid)
+	if err != nil {
+		memoryError(c, err)
+		return
+	}
+	c.JSON(200, t)
+}
+
+// handleMemoryRegenerate 重新生成当前分支最后一条回答，旧回答保留为兄弟分支；
+// 会话在回答保存时才切换到新分支
+func handleMemoryRegenerate(c *gin.Context) {
+	var req types.ChatRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	req.SessionID = sid
+	llm, err := newChatLLM(&req, tenantOf(c))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	turn, err := memory.Regenerate(req.SessionID)
+	if err != nil {
+		memoryError(c, err)
+		return
+	}
+	respondChat(c, llm, &req, turn.Messages, req.GenerateOptions, saveBranch(turn))
+}
+
+// handleMemoryEdit 在新分支上替换消息；编辑的是 user 消息时继续生成回答，与回答一并保存
+func handleMemoryEdit(c *gin.Context) {
+	var req EditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Index == nil {
+		c.JSON(400, gin.H{"error": "index is required"})
+		return
+	}
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	req.SessionID = sid
+	llm, err := newChatLLM(&req.ChatRequest, tenantOf(c))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	turn, err := memory.Edit(req.SessionID, *req.Index, req.Content)
+	if err != nil {
+		memoryError(c, err)
+		return
+	}
+	if turn.Messages[len(turn.Messages)-1].Role != types.RoleUser {
+		c.JSON(200, gin.H{"messages": turn.Messages})
+		return
+	}
+	respondChat(c, llm, &req.ChatRequest, turn.Messages, req.GenerateOptions, saveBranch(turn))
+}
+
+// handleMemoryFork 复制会话到新 sid（未指定时自动生成）
+func handleMemoryFork(c *gin.Context) {
+	var req struct {
+		SessionID string `json:"session_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.SessionID == "" {
+		req.SessionID = helper.NewID("sess-")
+	}
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	newID, ok := qualify(c, req.SessionID)
+	if !ok {
+		return
+	}
+	if err := memory.Fork(sid, newID); err != nil {
+		memoryError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"session_id": req.SessionID})
+}
+
+func handleMemoryUndo(c *gin.Context) {
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	msgs, err := memory.Undo(sid)
+	if err != nil {
+		memoryError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"messages": msgs})
+}
+
+// handleMemoryCheckout 切换到以 node 结尾的分支
+func handleMemoryCheckout(c *gin.Context) {
+	var req struct {
+		Node *int `json:"node"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Node == nil {
+		c.JSON(400, gin.H{"error": "node is required"})
+		return
+	}
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	msgs, err := memory.Checkout(sid, *req.Node)
+	if err != nil {
+		memoryError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"messages": msgs})
+}
+
+// saveBranch 生成成功后才把分支操作写入会话
+func saveBranch(turn memory.Turn) func(string) {
+	return func(reply string) {
+		_ = turn.Save(reply)
+	}
+}
+
+func memoryError(c *gin.Context, err error) {
+	if errors.Is(err, memory.ErrNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(400, gin.H{"error": err.Error()})
+}
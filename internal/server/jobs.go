@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/apikey"
+	"gollm-mini/internal/job"
+	"gollm-mini/internal/optimizer"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+/* ---------- async jobs ---------- */
+
+// JobRequest POST /jobs 的请求体
+type JobRequest struct {
+	Type    string          `json:"type"`    // chat / structured / optimizer / batch
+	Payload json.RawMessage `json:"payload"` // 同 POST /chat 或 POST /optimizer 的请求体，batch 见 BatchRequest
+	Webhook string          `json:"webhook"` // 可选：任务结束后 POST 任务详情
+}
+
+// handleJobSubmit 校验并保存任务，立即返回 202 与任务 ID
+func handleJobSubmit(c *gin.Context) {
+	var req JobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkJobPayload(req.Type, req.Payload, tenantOf(c)); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	j := job.Job{Kind: req.Type, Payload: req.Payload, Webhook: req.Webhook, Tenant: tenantOf(c)}
+	if k, ok := currentKey(c); ok {
+		j.KeyID = k.ID
+	}
+	j, err := job.Submit(j)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(202, j)
+}
+
+// checkJobPayload 提交时尽早发现请求体错误；模板与会话在执行时读取
+func checkJobPayload(kind string, payload json.RawMessage, t string) error {
+	switch kind {
+	case job.KindOptimizer:
+		_, err := parseOptimize(payload)
+		return err
+	case job.KindChat, job.KindStructured:
+		req, err := jobChatRequest(kind, payload, t)
+		if err != nil {
+			return err
+		}
+		if len(req.Messages) == 0 && req.Tpl == "" {
+			return errors.New("no messages or template provided")
+		}
+		_, err = newChatLLM(&req, t)
+		return err
+	case job.KindBatch:
+		return checkBatch(payload, t)
+	}
+	return fmt.Errorf("unknown job type %q (chat / structured / optimizer / batch)", kind)
+}
+
+// jobChatRequest 解析 chat / structured 任务的请求体；任务不流式，session_id 放入租户命名空间
+func jobChatRequest(kind string, payload json.RawMessage, t string) (types.ChatRequest, error) {
+	var req types.ChatRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return req, fmt.Errorf("invalid payload: %w", err)
+	}
+	if kind == job.KindStructured && req.Schema == "" {
+		return req, errors.New("structured jobs require schema")
+	}
+	req.Stream = false
+	if req.SessionID != "" {
+		sid, err := tenant.Qualify(t, req.SessionID)
+		if err != nil {
+			return req, err
+		}
+		req.SessionID = sid
+	}
+	return req, nil
+}
+
+func handleJobList(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	list, err := job.List(tenantOf(c), limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, list)
+}
+
+func handleJobGet(c *gin.Context) {
+	j, ok := tenantJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, j)
+}
+
+// handleJobCancel 取消排队中或执行中的任务；执行中的任务随后变为 cancelled
+func handleJobCancel(c *gin.Context) {
+	if _, ok := tenantJob(c); !ok {
+		return
+	}
+	j, err := job.Cancel(c.Param("id"))
+	switch {
+	case errors.Is(err, job.ErrFinished):
+		c.JSON(409, gin.H{"error": err.Error(), "job": j})
+	case err != nil:
+		jobError(c, err)
+	default:
+		c.JSON(200, j)
+	}
+}
+
+// tenantJob 读取路径中的任务；其他租户的任务视为不存在。出错时已写响应
+func tenantJob(c *gin.Context) (job.Job, bool) {
+	j, err := job.Get(c.Param("id"))
+	if err == nil && j.Tenant != tenantOf(c) {
+		err = job.ErrNotFound
+	}
+	if err != nil {
+		jobError(c, err)
+		return j, false
+	}
+	return j, true
+}
+
+func jobError(c *gin.Context, err error) {
+	if errors.Is(err, job.ErrNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(500, gin.H{"error": err.Error()})
+}
+
+// runJob 任务执行器：按类型复用 /chat、/optimizer 与 batch 的逻辑，用量计入提交任务的 Key
+func runJob(tplStore *template.Store) job.Runner {
+	return func(ctx context.Context, j job.Job, progress func(done, total int)) (any, types.Usage, error) {
+		var total types.Usage
+		k, metered, err := jobKey(j)
+		if err != nil {
+			return nil, total, err
+		}
+		check := func() error {
+			if metered && k.ID != staticKey.ID {
+				return apikey.CheckQuota(k)
+			}
+			return nil
+		}
+		if err := check(); err != nil {
+			return nil, total, err
+		}
+		var mu sync.Mutex // batch 并发计费
+		charge := func(servedBy string, u types.Usage) {
+			mu.Lock()
+			defer mu.Unlock()
+			total.PromptTokens += u.PromptTokens
+			total.CompletionTokens += u.CompletionTokens
+			total.TrimmedTokens += u.TrimmedTokens
+			if metered {
+				chargeKey(k, servedBy, u)
+			}
+		}
+		store := tplStore.In(j.Tenant)
+
+		if j.Kind == job.KindOptimizer {
+			req, err := parseOptimize(j.Payload)
+			if err != nil {
+				return nil, total, err
+			}
+			progress(0, len(req.Variants))
+			ctx = optimizer.WithProgress(optimizer.WithUsage(tenant.With(ctx, j.Tenant), charge), progress)
+			best, scores, answers, lat, err := optimizer.RunVariants(ctx, req.Variants, req.Vars, store)
+			if err != nil {
+				return nil, total, err
+			}
+			return gin.H{"best": best, "scores": scores, "answers": answers, "latencies": lat}, total, nil
+		}
+		if j.Kind == job.KindBatch {
+			res, err := runBatch(ctx, j, store, check, charge, progress)
+			mu.Lock()
+			defer mu.Unlock()
+			return res, total, err
+		}
+
+		req, err := jobChatRequest(j.Kind, j.Payload, j.Tenant)
+		if err != nil {
+			return nil, total, err
+		}
+		llm, err := newChatLLM(&req, j.Tenant)
+		if err != nil {
+			return nil, total, err
+		}
+		msgs, opts, _, err := prepareChat(&req, store)
+		if err != nil {
+			return nil, total, err
+		}
+		progress(0, 1)
+		resp, err := generateReply(ctx, llm, &req, msgs, opts)
+		charge(resp.ServedBy, resp.Usage)
+		if err != nil {
+			return nil, total, err
+		}
+		if req.SessionID != "" && req.Schema == "" {
+			saveTurn(req.SessionID, msgs)(resp.Text)
+		}
+		return resp, total, nil
+	}
+}
+
+// jobKey 提交任务的 Key；未启用鉴权时 metered 为 false。Key 已被删除时任务失败
+func jobKey(j job.Job) (k apikey.Key, metered bool, err error) {
+	switch j.KeyID {
+	case "":
+		return k, false, nil
+	case staticKey.ID:
+		return staticKey, true, nil
+	}
+	if k, err = apikey.Get(j.KeyID); err != nil {
+		return k, false, fmt.Errorf("api key %s: %w", j.KeyID, err)
+	}
+	return k, true, nil
+}
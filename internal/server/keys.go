@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/apikey"
+	"gollm-mini/internal/tenant"
+)
+
+// keyView 对外展示的 Key：不含哈希，附带今天的用量
+type keyView struct {
+	apikey.Key
+	Today apikey.Usage `json:"today"`
+}
+
+func viewKey(k apikey.Key) (keyView, error) {
+	k.Hash = ""
+	u, err := apikey.Today(k.ID)
+	return keyView{Key: k, Today: u}, err
+}
+
+// handleKeyCreate 创建 Key，明文只在本次响应中返回；绑定租户的 Key 只能创建同一租户的 Key
+func handleKeyCreate(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name"`
+		Scopes      []string `json:"scopes"`
+		Tenant      string   `json:"tenant"`
+		DailyTokens int      `json:"daily_tokens"`
+		DailyCost   float64  `json:"daily_cost"`
+		RPM         int      `json:"rpm"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if bound, ok := boundTenant(c); ok && req.Tenant != bound {
+		c.JSON(403, gin.H{"error": "api key is bound to tenant " + tenant.Name(bound)})
+		return
+	}
+	secret, k, err := apikey.Create(apikey.Key{
+		Name: req.Name, Scopes: req.Scopes, Tenant: req.Tenant,
+		DailyTokens: req.DailyTokens, DailyCost: req.DailyCost, RPM: req.RPM,
+	})
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	k.Hash = ""
+	c.JSON(201, gin.H{"key": secret, "info": k})
+}
+
+func handleKeyList(c *gin.Context) {
+	list, err := apikey.List()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]keyView, 0, len(list))
+	for _, k := range list {
+		v, err := viewKey(k)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		out = append(out, v)
+	}
+	c.JSON(200, out)
+}
+
+func handleKeyGet(c *gin.Context) {
+	k, err := apikey.Get(c.Param("id"))
+	if err == nil {
+		var v keyView
+		if v, err = viewKey(k); err == nil {
+			c.JSON(200, v)
+			return
+		}
+	}
+	keyError(c, err)
+}
+
+func handleKeyDelete(c *gin.Context) {
+	if err := apikey.Delete(c.Param("id")); err != nil {
+		keyError(c, err)
+		return
+	}
+	c.Status(204)
+}
+
+func keyError(c *gin.Context, err error) {
+	if errors.Is(err, apikey.ErrNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(500, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/core"
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
+)
+
+/* ---------- OpenAI 兼容网关：/v1/chat/completions & /v1/models ---------- */
+
+// splitModel "openai/gpt-4o-mini" → (openai, gpt-4o-mini)；
+// 前缀不是已注册 Provider 时，整个字符串视为默认 Provider 的模型名（如 "llama3:8b"）；
+// model 为空时使用默认模型
+func splitModel(model string) (string, string) {
+	def, defModel := defaults()
+	if model == "" {
+		return def, defModel
+	}
+	if i := strings.Index(model, "/"); i > 0 {
+		prefix := model[:i]
+		for _, n := range provider.Names() {
+			if n == prefix {
+				return prefix, model[i+1:]
+			}
+		}
+	}
+	return def, model
+}
+
+func handleOpenAIChat(c *gin.Context) {
+	var req openai.ChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIError(c, 400, "invalid_request_error", err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		openAIError(c, 400, "invalid_request_error", "messages is required")
+		return
+	}
+
+	name, model := splitModel(req.Model)
+	llm, err := core.New(name, model)
+	if err != nil {
+		openAIError(c, 404, "model_not_found", err.Error())
+		return
+	}
+	mode, err := cache.ParseMode(c.GetHeader("X-Cache-Mode"))
+	if err != nil {
+		openAIError(c, 400, "invalid_request_error", err.Error())
+		return
+	}
+	llm.SetCacheMode(mode)
+	llm.SetCacheNamespace(tenant.Prefix(tenantOf(c)))
+
+	msgs := fromOpenAIMessages(req.Messages)
+	opts := fromOpenAIOptions(req)
+	id := helper.NewID("chatcmpl-")
+	created := time.Now().Unix()
+	ctx := c.Request.Context() // 客户端断开时取消上游生成
+
+	/* ① 工具定义透传：只做单轮调用，由客户端执行工具 */
+	if len(req.Tools) > 0 {
+		reply, usage, err := llm.GenerateWithTools(ctx, msgs, fromOpenAITools(req.Tools), opts)
+		noteUsage(c, usage.ServedBy, usage)
+		if clientGone(c, ctx, err) {
+			return
+		}
+		if err != nil {
+			openAIError(c, 502, "upstream_error", err.Error())
+			return
+		}
+		msg, finish := toOpenAIMessage(reply)
+		if req.Stream {
+			calls := msg.ToolCalls
+			for i := range calls {
+				idx := i // chunk 中的 tool_calls 需要 index
+				calls[i].Index = &idx
+			}
+			streamOpenAI(c, id, created, req, func(send func(openai.ChatCompletionStreamChoiceDelta)) (types.Usage, error) {
+				send(openai.ChatCompletionStreamChoiceDelta{Content: msg.Content, ToolCalls: calls})
+				return usage, nil
+			}, finish)
+			return
+		}
+		c.JSON(200, openAIResponse(id, created, req.Model, msg, finish, usage))
+		return
+	}
+
+	/* ② 非流式 */
+	if !req.Stream {
+		text, usage, err := llm.Generate(ctx, msgs, opts)
+		noteUsage(c, usage.ServedBy, usage)
+		if clientGone(c, ctx, err) {
+			return
+		}
+		if err != nil {
+			openAIError(c, 502, "upstream_error", err.Error())
+			return
+		}
+		msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text}
+		c.JSON(200, openAIResponse(id, created, req.Model, msg, openai.FinishReasonStop, usage))
+		return
+	}
+
+	/* ③ 流式 chat.completion.chunk */
+	streamOpenAI(c, id, created, req, func(send func(openai.ChatCompletionStreamChoiceDelta)) (types.Usage, error) {
+		usage, err := llm.Stream(ctx, msgs, opts, func(ch types.Chunk) {
+			send(openai.ChatCompletionStreamChoiceDelta{Content: ch.Content})
+		})
+		noteUsage(c, usage.ServedBy, usage)
+		clientGone(c, ctx, err)
+		return usage, err
+	}, openai.FinishReasonStop)
+}
+
+// streamOpenAI 写出 role 首块 → 内容块 → finish 块 →（可选）usage 块 → [DONE]
+func streamOpenAI(
+	c *gin.Context,
+	id string, created int64,
+	req openai.ChatCompletionRequest,
+	run func(send func(openai.ChatCompletionStreamChoiceDelta)) (types.Usage, error),
+	finish openai.FinishReason,
+) {
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := c.Writer.(http.Flusher)
+
+	write := func(v any) {
+		b, _ := json.Marshal(v)
+		_ = writeSSE(c.Writer, "data", string(b))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta openai.ChatCompletionStreamChoiceDelta, fr openai.FinishReason) openai.ChatCompletionStreamResponse {
+		return openai.ChatCompletionStreamResponse{
+			ID: id, Object: "chat.completion.chunk", Created: created, Model: req.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{Index: 0, Delta: delta, FinishReason: fr}},
+		}
+	}
+
+	write(chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, ""))
+	usage, err := run(func(d openai.ChatCompletionStreamChoiceDelta) { write(chunk(d, "")) })
+	if err != nil {
+		write(gin.H{"error": gin.H{"message": err.Error(), "type": "upstream_error"}})
+		_ = writeSSE(c.Writer, "data", "[DONE]")
+		return
+	}
+	write(chunk(openai.ChatCompletionStreamChoiceDelta{}, finish))
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		write(openai.ChatCompletionStreamResponse{
+			ID: id, Object: "chat.completion.chunk", Created: created, Model: req.Model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   toOpenAIUsage(usage),
+		})
+	}
+	_ = writeSSE(c.Writer, "data", "[DONE]")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func handleOpenAIModels(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	data := []model{}
+	for _, name := range provider.Names() {
+		p, err := provider.New(name, provider.Config{})
+		if err != nil {
+			continue
+		}
+		ml, ok := p.(provider.ModelLister)
+		if !ok {
+			continue
+		}
+		ids, err := ml.ListModels(ctx)
+		if err != nil {
+			continue // 后端不可达时跳过，不影响其他 Provider
+		}
+		for _, id := range ids {
+			data = append(data, model{ID: name + "/" + id, Object: "model", OwnedBy: name})
+		}
+	}
+	c.JSON(200, gin.H{"object": "list", "data": data})
+}
+
+/* ---------- 格式转换 ---------- */
+
+func fromOpenAIMessages(in []openai.ChatCompletionMessage) []types.Message {
+	out := make([]types.Message, len(in))
+	for i, m := range in {
+		content := m.Content
+		if content == "" && len(m.MultiContent) > 0 {
+			// 只取文本部分
+			var sb strings.Builder
+			for _, part := range m.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText {
+					sb.WriteString(part.Text)
+				}
+			}
+			content = sb.String()
+		}
+		out[i] = types.Message{Role: types.Role(m.Role), Content: content, ToolCallID: m.ToolCallID, Name: m.Name}
+		for _, tc := range m.ToolCalls {
+			out[i].ToolCalls = append(out[i].ToolCalls, types.ToolCall{
+				ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments,
+			})
+		}
+	}
+	return out
+}
+
+func fromOpenAIOptions(req openai.ChatCompletionRequest) types.GenerateOptions {
+	opts := types.GenerateOptions{
+		MaxTokens: req.MaxTokens,
+		Stop:      req.Stop,
+		Seed:      req.Seed,
+	}
+	if req.MaxCompletionTokens > 0 {
+		opts.MaxTokens = req.MaxCompletionTokens
+	}
+	if req.Temperature != 0 {
+		t := float64(req.Temperature)
+		opts.Temperature = &t
+	}
+	if req.TopP != 0 {
+		p := float64(req.TopP)
+		opts.TopP = &p
+	}
+	return opts
+}
+
+func fromOpenAITools(in []openai.Tool) []types.Tool {
+	out := make([]types.Tool, 0, len(in))
+	for _, t := range in {
+		if t.Function == nil {
+			continue
+		}
+		params, _ := json.Marshal(t.Function.Parameters)
+		out = append(out, types.Tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  params,
+		})
+	}
+	return out
+}
+
+func toOpenAIMessage(m types.Message) (openai.ChatCompletionMessage, openai.FinishReason) {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: m.Content}
+	if len(m.ToolCalls) == 0 {
+		return msg, openai.FinishReasonStop
+	}
+	for _, tc := range m.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+			ID:       tc.ID,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+		})
+	}
+	return msg, openai.FinishReasonToolCalls
+}
+
+func toOpenAIUsage(u types.Usage) *openai.Usage {
+	return &openai.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.Total(),
+	}
+}
+
+func openAIResponse(id string, created int64, model string, msg openai.ChatCompletionMessage,
+	finish openai.FinishReason, usage types.Usage) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		ID: id, Object: "chat.completion", Created: created, Model: model,
+		Choices: []openai.ChatCompletionChoice{{Index: 0, Message: msg, FinishReason: finish}},
+		Usage:   *toOpenAIUsage(usage),
+	}
+}
+
+// openAIError 按 OpenAI 错误格式返回
+func openAIError(c *gin.Context, status int, typ, msg string) {
+	c.JSON(status, gin.H{"error": gin.H{"message": msg, "type": typ}})
+}
@@ -4,48 +4,66 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"gollm-mini/internal/apikey"
 	"gollm-mini/internal/cache"
+	"gollm-mini/internal/catalog"
+	"gollm-mini/internal/config"
 	"gollm-mini/internal/core"
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/job"
 	"gollm-mini/internal/memory"
 	"gollm-mini/internal/optimizer"
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/sse"
 	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
 	"gollm-mini/internal/types"
 )
 
-/* ---------- request / response ---------- */
-
-type ChatRequest struct {
-	Messages  []types.Message   `json:"messages"`
-	Tpl       string            `json:"tpl"`
-	Vars      map[string]string `json:"vars"`
-	System    string            `json:"system"`
-	Provider  string            `json:"provider" default:"ollama"`
-	Model     string            `json:"model"    default:"llama3"`
-	Schema    string            `json:"schema"`
-	Stream    bool              `json:"stream,omitempty"`
-	SessionID string            `json:"session_id"` // 新增：对话记忆
-}
+/* ---------- bootstrap ---------- */
 
-type ChatResponse struct {
-	Text   string      `json:"text,omitempty"`
-	JSON   interface{} `json:"json,omitempty"`
-	Usage  types.Usage `json:"usage"`
-	ErrMsg string      `json:"error,omitempty"`
+// 未指定摘要模型时使用
+const defaultSummarizer = "ollama:llama3"
+
+// Config 服务端启动参数
+type Config struct {
+	Addr        string
+	Provider    string               // 默认 Provider
+	Model       string               // 默认模型
+	APIKeys     []string             // 静态 Key，拥有全部权限；与 Key 库（apikey）都为空时不鉴权
+	Compact     memory.CompactPolicy // 会话自动压缩，Every 为 0 时关闭
+	Summarizer  string               // 压缩摘要使用的 "provider:model"
+	JobWorkers  int                  // 异步任务并发数，默认 2
+	WebhookNets []string             // 允许接收任务 webhook 的内网网段（CIDR），默认只允许公网地址
+
+	// Reloader 非空时监听配置文件与 SIGHUP，并提供 POST /admin/reload；
+	// 重新加载后以新配置的 provider / model / api_keys 替换上面三项
+	Reloader *config.Reloader
 }
 
-/* ---------- bootstrap ---------- */
-
-func Run(ctx context.Context, addr string) error {
+func Run(ctx context.Context, cfg Config) error {
+	if cfg.Summarizer == "" {
+		cfg.Summarizer = defaultSummarizer
+	}
+	setSettings(cfg.Provider, cfg.Model, cfg.APIKeys)
+	if cfg.Reloader != nil {
+		cfg.Reloader.OnReload(func(c config.Config) {
+			setSettings(c.Provider, c.Model, c.Server.Auth.APIKeys)
+		})
+		go cfg.Reloader.Watch(ctx)
+	}
 	r := gin.Default()
 
 	r.Use(func(c *gin.Context) {
@@ -58,34 +76,96 @@ func Run(ctx context.Context, addr string) error {
 		c.Next()
 	})
 
-	tplStore, err := template.Open("templates.db")
+	r.Use(apiKeyAuth(), tenantScope())
+
+	tplStore, err := template.Open("templates")
 	if err != nil {
 		return err
 	}
+	if err := apikey.Open(); err != nil {
+		return err
+	}
+	if err := job.Open(); err != nil {
+		return err
+	}
+	if cfg.JobWorkers <= 0 {
+		cfg.JobWorkers = 2
+	}
+	if err := job.AllowWebhookNets(cfg.WebhookNets); err != nil {
+		return err
+	}
+	if err := job.Start(ctx, cfg.JobWorkers, runJob(tplStore)); err != nil {
+		return err
+	}
+
+	if cfg.Compact.Every > 0 {
+		sum, err := core.NewSummarizer(cfg.Summarizer)
+		if err != nil {
+			return err
+		}
+		go memory.RunCompactor(ctx, cfg.Compact, sum)
+	}
 
 	r.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/models", handleModels)
 
-	chat := r.Group("/chat")
+	chatScope := require(apikey.ScopeChat)
+	adminScope := require(apikey.ScopeAdmin)
+	tplWrite := require(apikey.ScopeTemplateWrite)
+
+	chat := r.Group("/chat", chatScope, metered())
+	{
+		chat.POST("", func(c *gin.Context) { handleChat(c, tplStore.In(tenantOf(c))) })
+	}
+
+	// WebSocket 对话：浏览器无法设置请求头，可用 ?api_key= 与 ?tenant=
+	r.GET("/ws/chat", chatScope, metered(), handleWSChat)
+
+	// 异步任务：chat / structured / optimizer
+	jobs := r.Group("/jobs", chatScope)
 	{
-		chat.POST("", func(c *gin.Context) { handleChat(c, tplStore) })
+		jobs.POST("", metered(), handleJobSubmit)
+		jobs.GET("", handleJobList)
+		jobs.GET("/:id", handleJobGet)
+		jobs.GET("/:id/output", handleJobOutput)
+		jobs.DELETE("/:id", handleJobCancel)
+	}
+
+	// OpenAI 兼容网关
+	v1 := r.Group("/v1", chatScope)
+	{
+		v1.POST("/chat/completions", metered(), handleOpenAIChat)
+		v1.GET("/models", handleOpenAIModels)
 	}
 
 	tpl := r.Group("/template")
 	{
-		tpl.POST("", func(c *gin.Context) { handleTplSave(c, tplStore) })
-		tpl.GET("", func(c *gin.Context) { handleTplListAllLatest(c, tplStore) }) // NEW
-		tpl.GET("/:name", func(c *gin.Context) { handleTplLatestOrVersions(c, tplStore) })
-		tpl.GET("/:name/:ver", func(c *gin.Context) { handleTplGet(c, tplStore) })
-		tpl.DELETE("/:name/:ver", func(c *gin.Context) { handleTplDel(c, tplStore) })
+		tpl.POST("", tplWrite, func(c *gin.Context) { handleTplSave(c, tplStore.In(tenantOf(c))) })
+		tpl.GET("", func(c *gin.Context) { handleTplListAllLatest(c, tplStore.In(tenantOf(c))) }) // NEW
+		tpl.GET("/:name", func(c *gin.Context) { handleTplLatestOrVersions(c, tplStore.In(tenantOf(c))) })
+		tpl.GET("/:name/:ver", func(c *gin.Context) { handleTplGet(c, tplStore.In(tenantOf(c))) })
+		tpl.DELETE("/:name/:ver", tplWrite, func(c *gin.Context) { handleTplDel(c, tplStore.In(tenantOf(c))) })
+	}
+
+	opt := r.Group("/optimizer", chatScope, metered())
+	{
+		opt.POST("", func(c *gin.Context) { handleOptimize(c, tplStore.In(tenantOf(c))) })
 	}
 
-	opt := r.Group("/optimizer")
+	admin := r.Group("/admin", adminScope)
 	{
-		opt.POST("", func(c *gin.Context) { handleOptimize(c, tplStore) })
+		admin.POST("/reload", func(c *gin.Context) { handleAdminReload(c, cfg.Reloader) })
+		admin.GET("/keys", handleKeyList)
+		admin.POST("/keys", handleKeyCreate)
+		admin.GET("/keys/:id", handleKeyGet)
+		admin.DELETE("/keys/:id", handleKeyDelete)
+		admin.GET("/tenants", func(c *gin.Context) { handleTenantList(c, tplStore) })
+		admin.GET("/tenants/:name/export", func(c *gin.Context) { handleTenantExport(c, tplStore) })
+		admin.DELETE("/tenants/:name", func(c *gin.Context) { handleTenantDelete(c, tplStore) })
 	}
 
-	cacheGrp := r.Group("/cache")
+	cacheGrp := r.Group("/cache", adminScope)
 	{
 		cacheGrp.DELETE("/all", handleCacheClearAll)
 		cacheGrp.DELETE("/:key", handleCacheDelKey)
@@ -94,11 +174,22 @@ func Run(ctx context.Context, addr string) error {
 
 	mem := r.Group("/memory")
 	{
-		mem.DELETE("/:sid", handleMemoryDelete) // DELETE /memory/{sid}
+		mem.GET("", chatScope, handleMemoryList)            // GET /memory?offset=&limit=
+		mem.GET("/export", chatScope, handleMemoryExport)   // GET /memory/export?sid=a,b
+		mem.POST("/import", adminScope, handleMemoryImport) // POST /memory/import?overwrite=1
+		mem.GET("/:sid", chatScope, handleMemoryGet)        // GET /memory/{sid}
+		mem.DELETE("/:sid", adminScope, handleMemoryDelete) // DELETE /memory/{sid}
+		mem.POST("/:sid/compact", adminScope, func(c *gin.Context) { handleMemoryCompact(c, cfg) })
+		mem.GET("/:sid/tree", chatScope, handleMemoryTree)
+		mem.POST("/:sid/regenerate", chatScope, metered(), handleMemoryRegenerate)
+		mem.POST("/:sid/edit", chatScope, metered(), handleMemoryEdit)
+		mem.POST("/:sid/fork", chatScope, handleMemoryFork)
+		mem.POST("/:sid/undo", chatScope, handleMemoryUndo)
+		mem.POST("/:sid/checkout", chatScope, handleMemoryCheckout)
 	}
 
 	srv := &http.Server{
-		Addr:              addr,
+		Addr:              cfg.Addr,
 		Handler:           r,
 		ReadHeaderTimeout: 15 * time.Second,
 		WriteTimeout:      300 * time.Second,
@@ -112,94 +203,249 @@ func Run(ctx context.Context, addr string) error {
 /* ---------- chat ---------- */
 
 func handleChat(c *gin.Context, tplStore *template.Store) {
-	var req ChatRequest
+	var req types.ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	llm, err := core.New(req.Provider, req.Model)
+	if req.SessionID != "" {
+		sid, ok := qualify(c, req.SessionID)
+		if !ok {
+			return
+		}
+		req.SessionID = sid
+	}
+	llm, err := newChatLLM(&req, tenantOf(c))
 	if err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
+	msgs, opts, status, err := prepareChat(&req, tplStore)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	respondChat(c, llm, &req, msgs, opts, saveTurn(req.SessionID, msgs))
+}
+
+// prepareChat 读取会话历史并组装 prompt（messages 或模板）；出错时返回应答的 HTTP 状态码
+func prepareChat(req *types.ChatRequest, tplStore *template.Store) ([]types.Message, types.GenerateOptions, int, error) {
 	/* ① 读取历史 */
 	var history []types.Message
 	if req.SessionID != "" {
-		history, err = memory.Load(req.SessionID)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+		var err error
+		if history, err = memory.Load(req.SessionID); err != nil {
+			return nil, req.GenerateOptions, 500, err
 		}
 	}
 
 	/* ② 组装 prompt */
 	msgs := req.Messages
+	opts := req.GenerateOptions
 	if len(msgs) == 0 && req.Tpl != "" {
 		tpl, e := tplStore.Latest(req.Tpl)
 		if e != nil {
-			c.JSON(404, gin.H{"error": e.Error()})
-			return
+			return nil, opts, 404, e
 		}
+		opts = opts.Merge(tpl.Options)
 		msgs, e = tpl.Render(req.Vars, history, req.System)
 		if e != nil {
-			c.JSON(400, gin.H{"error": e.Error()})
-			return
+			return nil, opts, 400, e
 		}
 	}
 	if len(history) > 0 && len(req.Messages) > 0 {
 		msgs = append(history, req.Messages...)
 	}
 	if len(msgs) == 0 {
-		c.JSON(400, gin.H{"error": "no messages or template provided"})
-		return
+		return nil, opts, 400, errors.New("no messages or template provided")
 	}
+	return msgs, opts, 200, nil
+}
 
-	/* ③ 非流式 & 无 schema */
-	if !req.Stream && req.Schema == "" {
-		text, usage, err := llm.Generate(c, msgs)
-		c.JSON(200, ChatResponse{Text: text, Usage: usage, ErrMsg: errMsg(err)})
+// saveTurn 把最后一条 user 消息与回答追加到会话
+func saveTurn(sid string, msgs []types.Message) func(reply string) {
+	return func(reply string) {
+		_ = memory.Append(sid, []types.Message{
+			{Role: types.RoleUser, Content: msgs[len(msgs)-1].Content},
+			{Role: types.RoleAssistant, Content: reply},
+		})
+	}
+}
 
-		if req.SessionID != "" && err == nil {
-			_ = memory.Append(req.SessionID, []types.Message{
-				{Role: types.RoleUser, Content: msgs[len(msgs)-1].Content},
-				{Role: types.RoleAssistant, Content: text},
-			})
+// newChatLLM 按请求创建 LLM：缓存模式与租户前缀、fallback 链、上下文策略
+func newChatLLM(req *types.ChatRequest, t string) (*core.LLM, error) {
+	if req.Provider == "" {
+		p, m := defaults()
+		req.Provider = p
+		if req.Model == "" {
+			req.Model = m
+		}
+	}
+	llm, err := core.New(req.Provider, req.Model)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := cache.ParseMode(req.Cache)
+	if err != nil {
+		return nil, err
+	}
+	llm.SetCacheMode(mode)
+	llm.SetCacheNamespace(tenant.Prefix(t))
+	if req.Fallback != "" {
+		on, err := core.ParseFallbackClasses(req.FallbackOn)
+		if err == nil {
+			err = llm.WithFallback(req.Fallback, on)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := llm.UseContextStrategy(req.Context, req.Summarizer); err != nil {
+		return nil, err
+	}
+	return llm, nil
+}
+
+// respondChat 按请求选择工具 / 非流式 / 结构化 / SSE 输出；
+// 成功且带 session_id 时调用 save 保存回答（结构化输出不入记忆）
+func respondChat(c *gin.Context, llm *core.LLM, req *types.ChatRequest, msgs []types.Message, opts types.GenerateOptions, save func(reply string)) {
+	if req.SessionID == "" {
+		save = func(string) {}
+	}
+	// 客户端断开或写出失败时取消上游生成，避免为没人读的 token 付费
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	/* ③ 工具调用 / 非流式 / 结构化 JSON */
+	if !req.Stream || req.Schema != "" || len(req.Tools) > 0 {
+		resp, err := generateReply(ctx, llm, req, msgs, opts)
+		noteUsage(c, resp.ServedBy, resp.Usage)
+		if clientGone(c, ctx, err) {
+			return
+		}
+		c.JSON(200, resp)
+		if err == nil && req.Schema == "" {
+			save(resp.Text)
 		}
 		return
 	}
 
-	/* ④ 结构化 JSON */
-	if req.Schema != "" {
-		var out map[string]interface{}
-		usage, err := llm.StructuredGenerate(c, msgs, req.Schema, &out)
-		c.JSON(200, ChatResponse{JSON: out, Usage: usage, ErrMsg: errMsg(err)})
+	/* ④ 流式 SSE，协议见 sse 包 */
+	reqID := helper.NewID("req-")
+	c.Header("X-Request-ID", reqID)
+	out := sse.NewWriter(c.Writer)
+	text, usage, err := streamTurn(ctx, cancel, out, reqID, llm, msgs, opts)
+	noteUsage(c, usage.ServedBy, usage)
+	if clientGone(c, ctx, err) {
+		log.Printf("[SSE] %s cancelled by client after %d bytes", reqID, len(text))
+		if req.SavePartial && text != "" {
+			save(text)
+		}
 		return
 	}
+	endTurn(out, opts, usage, err)
+	if err == nil {
+		save(text)
+	}
+}
 
-	/* ⑤ 流式 SSE */
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	flusher, _ := c.Writer.(http.Flusher)
+// eventSender 按 sse 协议发送事件：SSE 响应与 WebSocket 连接共用
+type eventSender interface {
+	Send(event string, v any) error
+}
 
+// streamTurn 发出 start 与 delta 事件并返回已生成的文本；写出失败时调用 cancel 终止上游生成。
+// usage / done 由 endTurn 发出
+func streamTurn(ctx context.Context, cancel context.CancelFunc, out eventSender, reqID string, llm *core.LLM, msgs []types.Message, opts types.GenerateOptions) (string, types.Usage, error) {
+	_ = out.Send(sse.EventStart, sse.Start{
+		Version: sse.Version, RequestID: reqID, Provider: llm.Provider(), Model: llm.Model(),
+	})
 	var buf bytes.Buffer
-	_, err = llm.Stream(c, msgs, func(ch types.Chunk) {
-		_ = writeSSE(c.Writer, "data", ch.Content)
+	usage, err := llm.Stream(ctx, msgs, opts, func(ch types.Chunk) {
 		buf.WriteString(ch.Content)
-		flusher.Flush()
+		if err := out.Send(sse.EventDelta, sse.Delta{Content: ch.Content}); err != nil {
+			cancel() // 连接已断开
+		}
 	})
-	_ = writeSSE(c.Writer, "event", "done")
-	if err != nil {
-		_ = writeSSE(c.Writer, "error", err.Error())
+	return buf.String(), usage, err
+}
+
+// endTurn 发出 [error] → usage → done；被取消的生成不发 error
+func endTurn(out eventSender, opts types.GenerateOptions, usage types.Usage, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		_ = out.Send(sse.EventError, sseError(err))
 	}
+	u := sse.FromUsage(usage)
+	_ = out.Send(sse.EventUsage, u)
+	_ = out.Send(sse.EventDone, sse.Done{FinishReason: finishReason(err, opts, usage), Usage: u, ServedBy: usage.ServedBy})
+}
 
-	if req.SessionID != "" && err == nil {
-		_ = memory.Append(req.SessionID, []types.Message{
-			{Role: types.RoleUser, Content: msgs[len(msgs)-1].Content},
-			{Role: types.RoleAssistant, Content: buf.String()},
-		})
+// generateReply 一次性生成：带 tools 时走工具调用，带 schema 时为结构化 JSON，否则为普通文本
+func generateReply(ctx context.Context, llm *core.LLM, req *types.ChatRequest, msgs []types.Message, opts types.GenerateOptions) (types.ChatResponse, error) {
+	var resp types.ChatResponse
+	var err error
+	switch {
+	case len(req.Tools) > 0 && req.Schema == "":
+		resp.Text, resp.Steps, resp.Usage, err = llm.RunTools(ctx, msgs, req.Tools, opts)
+	case req.Schema != "":
+		var out map[string]interface{}
+		resp.Usage, err = llm.StructuredGenerate(ctx, msgs, req.Schema, opts, &out)
+		resp.JSON = out
+	default:
+		resp.Text, resp.Usage, err = llm.Generate(ctx, msgs, opts)
 	}
+	resp.ServedBy, resp.ErrMsg = resp.Usage.ServedBy, errMsg(err)
+	return resp, err
+}
+
+// clientGone 上游调用因客户端断开而被取消时返回 true，并把本次请求的 Key 指标记为 cancelled
+func clientGone(c *gin.Context, ctx context.Context, err error) bool {
+	if !errors.Is(err, context.Canceled) || ctx.Err() == nil {
+		return false
+	}
+	c.Set(ctxStatus, statusCancelled)
+	return true
+}
+
+// finishReason 流式结束原因；输出 token 达到 max_tokens 视为被截断
+func finishReason(err error, opts types.GenerateOptions, u types.Usage) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return sse.FinishCancelled
+	case err != nil:
+		return sse.FinishError
+	case opts.MaxTokens > 0 && u.CompletionTokens >= opts.MaxTokens:
+		return sse.FinishLength
+	}
+	return sse.FinishStop
+}
+
+func sseError(err error) sse.Error {
+	e := sse.Error{Message: err.Error()}
+	var pe *provider.Error
+	if errors.As(err, &pe) {
+		e.Kind = string(pe.Kind)
+	}
+	return e
+}
+
+/* ---------- model catalog ---------- */
+
+// handleModels 列出模型目录，?provider= 过滤
+func handleModels(c *gin.Context) {
+	list := catalog.List()
+	if p := c.Query("provider"); p != "" {
+		filtered := list[:0]
+		for _, m := range list {
+			if m.Provider == p {
+				filtered = append(filtered, m)
+			}
+		}
+		list = filtered
+	}
+	c.JSON(200, list)
 }
 
 /* ---------- template CRUD ---------- */
@@ -270,18 +516,15 @@ func handleTplDel(c *gin.Context, store *template.Store) {
 
 /* ---------- optimizer ---------- */
 
-func handleOptimize(c *gin.Context, store *template.Store) {
-	raw, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
-		return
-	}
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(raw))
+// optimizeRequest POST /optimizer 的请求体
+type optimizeRequest struct {
+	Variants []optimizer.Variant `json:"variants"`
+	Vars     map[string]string   `json:"vars"`
+}
 
-	var req struct {
-		Variants []optimizer.Variant `json:"variants"`
-		Vars     map[string]string   `json:"vars"`
-	}
+// parseOptimize 解析 optimizer 请求，兼容旧格式 {"tpls":[…],"provider","model"}
+func parseOptimize(raw []byte) (optimizeRequest, error) {
+	var req optimizeRequest
 	_ = json.Unmarshal(raw, &req)
 
 	/* 兼容旧格式 */
@@ -305,12 +548,28 @@ func handleOptimize(c *gin.Context, store *template.Store) {
 	}
 
 	if len(req.Variants) == 0 {
-		c.JSON(400, gin.H{"error": "variants required"})
+		return req, errors.New("variants required")
+	}
+	return req, nil
+}
+
+func handleOptimize(c *gin.Context, store *template.Store) {
+	raw, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(raw))
 
+	req, err := parseOptimize(raw)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := optimizer.WithUsage(tenant.With(c, tenantOf(c)), func(servedBy string, u types.Usage) { noteUsage(c, servedBy, u) })
 	best, scores, answers, lat, err :=
-		optimizer.RunVariants(c, req.Variants, req.Vars, store)
+		optimizer.RunVariants(ctx, req.Variants, req.Vars, store)
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
@@ -323,22 +582,32 @@ func handleOptimize(c *gin.Context, store *template.Store) {
 
 /* ---------- cache handlers ---------- */
 
+// 缓存接口只作用于请求所属租户
+
 func handleCacheClearAll(c *gin.Context) {
-	if err := cache.ClearAll(); err != nil {
+	if _, err := cache.DeleteTenant(tenantOf(c)); err != nil {
 		c.JSON(500, err)
 	} else {
 		c.Status(204)
 	}
 }
 func handleCacheDelKey(c *gin.Context) {
-	if err := cache.DeleteKey(c.Param("key")); err != nil {
+	key, ok := qualify(c, c.Param("key"))
+	if !ok {
+		return
+	}
+	if err := cache.DeleteKey(key); err != nil {
 		c.JSON(500, err)
 	} else {
 		c.Status(204)
 	}
 }
 func handleCacheDelPrefix(c *gin.Context) {
-	if err := cache.DeletePrefix(c.Param("prefix")); err != nil {
+	prefix, ok := qualify(c, c.Param("prefix"))
+	if !ok {
+		return
+	}
+	if err := cache.DeletePrefix(prefix); err != nil {
 		c.JSON(500, err)
 	} else {
 		c.Status(204)
@@ -348,15 +617,123 @@ func handleCacheDelPrefix(c *gin.Context) {
 /* ---------- memory handlers ---------- */
 
 func handleMemoryDelete(c *gin.Context) {
-	if err := memory.Delete(c.Param("sid")); err != nil {
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	if err := memory.Delete(sid); err != nil {
 		c.JSON(500, err)
 	} else {
 		c.Status(204) // No Content
 	}
 }
 
+// handleMemoryList 分页列出会话，按最近更新排序
+func handleMemoryList(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if offset < 0 || limit <= 0 || limit > 1000 {
+		c.JSON(400, gin.H{"error": "offset must be >= 0 and limit in 1..1000"})
+		return
+	}
+	list, total, err := memory.List(tenantOf(c), offset, limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"sessions": list, "total": total, "offset": offset, "limit": limit})
+}
+
+func handleMemoryGet(c *gin.Context) {
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	s, err := memory.Get(sid)
+	switch {
+	case errors.Is(err, memory.ErrNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+	default:
+		c.JSON(200, s)
+	}
+}
+
+// handleMemoryExport 以 JSONL 导出会话，?sid=a,b 只导出指定会话
+func handleMemoryExport(c *gin.Context) {
+	var ids []string
+	for _, id := range strings.Split(c.Query("sid"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	var buf bytes.Buffer
+	if err := memory.Export(&buf, tenantOf(c), ids...); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="sessions.jsonl"`)
+	c.Data(200, "application/x-ndjson", buf.Bytes())
+}
+
+// handleMemoryImport 请求体为 Export 的 JSONL
+func handleMemoryImport(c *gin.Context) {
+	res, err := memory.Import(c.Request.Body, tenantOf(c), c.Query("overwrite") == "1")
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "result": res})
+		return
+	}
+	c.JSON(200, res)
+}
+
+// handleMemoryCompact 立即压缩会话，忽略阈值
+func handleMemoryCompact(c *gin.Context, cfg Config) {
+	var req struct {
+		Summarizer string `json:"summarizer"`  // 默认沿用服务端配置
+		KeepRecent int    `json:"keep_recent"` // 保留的最近消息数
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	target := cfg.Summarizer
+	if req.Summarizer != "" {
+		target = req.Summarizer
+	}
+	sum, err := core.NewSummarizer(target)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	policy := cfg.Compact
+	if req.KeepRecent > 0 {
+		policy.KeepRecent = req.KeepRecent
+	}
+
+	sid, ok := sessionID(c)
+	if !ok {
+		return
+	}
+	res, err := memory.Compact(c.Request.Context(), sid, policy, sum, true)
+	res.SessionID = c.Param("sid")
+	switch {
+	case errors.Is(err, memory.ErrNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, memory.ErrSessionChanged):
+		c.JSON(409, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": err.Error()})
+	default:
+		c.JSON(200, res)
+	}
+}
+
 /* ---------- helpers ---------- */
 
+// writeSSE 写出单个 SSE 字段（OpenAI 兼容流使用 data: <json>）
 func writeSSE(w http.ResponseWriter, field, data string) error {
 	_, err := w.Write([]byte(field + ": " + data + "\n\n"))
 	return err
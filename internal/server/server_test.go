@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/memory"
+	"gollm-mini/internal/provider"
+	"gollm-mini/internal/provider/mock"
+	_ "gollm-mini/internal/provider/replay"
+	"gollm-mini/internal/sse"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/types"
+)
+
+// modelEcho 回复自身的模型名，用于确认每个请求用的是自己的实例
+type modelEcho struct{ model string }
+
+func (p modelEcho) Generate(_ context.Context, msgs []types.Message, _ types.GenerateOptions) (string, types.Usage, error) {
+	return p.model + ": " + msgs[len(msgs)-1].Content, types.Usage{PromptTokens: 1, CompletionTokens: 1}, nil
+}
+
+func (p modelEcho) Stream(ctx context.Context, msgs []types.Message, opts types.GenerateOptions, cb func(types.Chunk)) (types.Usage, error) {
+	txt, u, err := p.Generate(ctx, msgs, opts)
+	cb(types.Chunk{Content: txt, Delta: 1})
+	return u, err
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := storage.Configure(storage.Config{Backend: storage.Memory}); err != nil {
+		panic(err)
+	}
+	if err := cache.Open(); err != nil {
+		panic(err)
+	}
+	if err := memory.Open(); err != nil {
+		panic(err)
+	}
+	provider.Register("model-echo", func(cfg provider.Config) (provider.Provider, error) {
+		return modelEcho{model: cfg.Model}, nil
+	})
+	setSettings("model-echo", "default", nil)
+	os.Exit(m.Run())
+}
+
+func chatRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	r := gin.New()
+	r.POST("/chat", func(c *gin.Context) { handleChat(c, templates(t)) })
+	return r
+}
+
+func templates(t *testing.T) *template.Store {
+	t.Helper()
+	store, err := template.Open("templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func postRaw(r http.Handler, req types.ChatRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/chat", bytes.NewReader(body)))
+	return w
+}
+
+func postChat(r http.Handler, req types.ChatRequest) (types.ChatResponse, int) {
+	w := postRaw(r, req)
+	var resp types.ChatResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp, w.Code
+}
+
+// 不同模型的 /chat 并发执行，互不串台；配合 go test -race
+func TestHandleChatConcurrentModels(t *testing.T) {
+	r := chatRouter(t)
+	const n = 32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			model := fmt.Sprintf("m%d", i%8)
+			req := types.ChatRequest{
+				Provider: "model-echo",
+				Model:    model,
+				Messages: []types.Message{{Role: types.RoleUser, Content: fmt.Sprintf("q%d", i)}},
+				Cache:    "off",
+			}
+			if i%2 == 1 { // 一半走 fallback 链，主实例与链一起被并发使用
+				req.Fallback = "model-echo:backup"
+			}
+			resp, code := postChat(r, req)
+			if code != 200 {
+				t.Errorf("request %d: status %d (%s)", i, code, resp.ErrMsg)
+				return
+			}
+			if want := fmt.Sprintf("%s: q%d", model, i); resp.Text != want {
+				t.Errorf("request %d: text %q, want %q", i, resp.Text, want)
+			}
+			if want := "model-echo:" + model; resp.ServedBy != want {
+				t.Errorf("request %d: served_by %q, want %q", i, resp.ServedBy, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 模板渲染 + 会话记忆：第二轮请求带上第一轮的问答
+func TestHandleChatTemplateAndSession(t *testing.T) {
+	m := mock.Register("chat-mock",
+		mock.Response{Text: "Go is a language.", Usage: types.Usage{PromptTokens: 8, CompletionTokens: 4}},
+		mock.Response{Text: "Since 2009."},
+	)
+	if err := templates(t).Save(template.Template{Name: "about", Version: 1, System: "Be brief.", Content: "Tell me about {{.topic}}", Vars: []string{"topic"}}); err != nil {
+		t.Fatal(err)
+	}
+	r := chatRouter(t)
+
+	resp, code := postChat(r, types.ChatRequest{Provider: "chat-mock", Model: "m", Tpl: "about", Vars: map[string]string{"topic": "Go"}, SessionID: "s1", Cache: "off"})
+	if code != 200 || resp.Text != "Go is a language." || resp.Usage.CompletionTokens != 4 || resp.ServedBy != "chat-mock:m" {
+		t.Fatalf("first turn: %d %+v", code, resp)
+	}
+	resp, code = postChat(r, types.ChatRequest{Provider: "chat-mock", Model: "m", Messages: []types.Message{{Role: types.RoleUser, Content: "Since when?"}}, SessionID: "s1", Cache: "off"})
+	if code != 200 || resp.Text != "Since 2009." {
+		t.Fatalf("second turn: %d %+v", code, resp)
+	}
+
+	reqs := m.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("%d provider calls", len(reqs))
+	}
+	var got []string
+	for _, msg := range reqs[1] {
+		got = append(got, string(msg.Role)+": "+msg.Content)
+	}
+	want := []string{"user: Tell me about Go", "assistant: Go is a language.", "user: Since when?"} // 会话只保存问答
+	if !slices.Equal(got, want) {
+		t.Errorf("second turn prompt = %q, want %q", got, want)
+	}
+	if hist, _ := memory.Load("s1"); len(hist) != 4 {
+		t.Errorf("session has %d messages, want 4", len(hist))
+	}
+}
+
+// 流式对话经 replay 录制后，换一个 Provider 从 cassette 回放，SSE 事件与录制时一致且不再调用上游
+func TestHandleChatStreamReplay(t *testing.T) {
+	upstream := mock.Register("chat-upstream", mock.Response{Chunks: []string{"Hello", ", ", "world"}, Usage: types.Usage{PromptTokens: 6, CompletionTokens: 3}})
+	dir := t.TempDir()
+	recorded, committed := filepath.Join(dir, "rec.json"), filepath.Join(dir, "ci.json")
+	specs := []provider.Spec{
+		{Name: "chat-rec", Type: "replay", Config: provider.Config{Model: "m", Options: map[string]string{"inner": "chat-upstream", "cassette": recorded, "mode": "record"}}},
+		{Name: "chat-ci", Type: "replay", Config: provider.Config{Model: "m", Options: map[string]string{"cassette": committed}}},
+	}
+	for _, sp := range specs {
+		if err := provider.RegisterSpec(sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := chatRouter(t)
+	// 不传 model：由 spec 中的 "m" 决定，与录制时的请求一致
+	stream := func(name string) (deltas []string, done sse.Done) {
+		t.Helper()
+		w := postRaw(r, types.ChatRequest{Provider: name, Messages: []types.Message{{Role: types.RoleUser, Content: "hi"}}, Stream: true, Cache: "off"})
+		if w.Code != 200 {
+			t.Fatalf("%s: status %d: %s", name, w.Code, w.Body.String())
+		}
+		err := sse.Read(w.Body, func(e sse.Event) error {
+			switch e.Name {
+			case sse.EventDelta:
+				var d sse.Delta
+				if err := e.Decode(&d); err != nil {
+					return err
+				}
+				deltas = append(deltas, d.Content)
+			case sse.EventDone:
+				return e.Decode(&done)
+			case sse.EventError:
+				t.Errorf("%s: error event %s", name, e.Data)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return deltas, done
+	}
+
+	want, wantDone := stream("chat-rec")
+	if !slices.Equal(want, []string{"Hello", ", ", "world"}) || wantDone.Usage.CompletionTokens != 3 {
+		t.Fatalf("recorded stream = %q %+v", want, wantDone)
+	}
+	data, err := os.ReadFile(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(committed, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, done := stream("chat-ci")
+	if !slices.Equal(got, want) || done.Usage != wantDone.Usage || done.FinishReason != wantDone.FinishReason {
+		t.Errorf("replayed stream = %q %+v, want %q %+v", got, done, want, wantDone)
+	}
+	if done.ServedBy != "chat-ci:m" {
+		t.Errorf("served by %q", done.ServedBy)
+	}
+	if n := len(upstream.Requests()); n != 1 {
+		t.Errorf("upstream called %d times, want 1", n)
+	}
+}
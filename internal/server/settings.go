@@ -0,0 +1,71 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/config"
+)
+
+// 请求未指定 provider / model 且配置也未指定时使用
+const (
+	builtinProvider = "ollama"
+	builtinModel    = "llama3"
+)
+
+// settings 可热加载的服务端设置；每次整体替换，正在处理的请求不受影响
+type settings struct {
+	provider, model string
+	keys            [][]byte // 为空时不鉴权
+}
+
+var current atomic.Pointer[settings]
+
+func loadSettings() *settings {
+	if s := current.Load(); s != nil {
+		return s
+	}
+	return &settings{provider: builtinProvider, model: builtinModel}
+}
+
+func setSettings(provider, model string, keys []string) {
+	s := &settings{provider: provider, model: model}
+	if s.provider == "" {
+		s.provider, s.model = builtinProvider, builtinModel
+	}
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			s.keys = append(s.keys, []byte(k))
+		}
+	}
+	if len(keys) > 0 && len(s.keys) == 0 {
+		log.Printf("[AUTH] all configured api keys are empty, authentication disabled")
+	}
+	current.Store(s)
+}
+
+// defaults 请求未指定时使用的 provider / model
+func defaults() (string, string) {
+	s := loadSettings()
+	return s.provider, s.model
+}
+
+// handleAdminReload 重新加载配置文件，返回变化项；失败时保持原配置
+func handleAdminReload(c *gin.Context, r *config.Reloader) {
+	if r == nil {
+		c.JSON(501, gin.H{"error": "server started without a config reloader"})
+		return
+	}
+	changes, err := r.Reload()
+	if err != nil {
+		c.JSON(422, gin.H{"error": err.Error()})
+		return
+	}
+	if changes == nil {
+		changes = []config.Change{}
+	}
+	c.JSON(200, gin.H{"changes": changes})
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"gollm-mini/internal/apikey"
+	"gollm-mini/internal/cache"
+	"gollm-mini/internal/job"
+	"gollm-mini/internal/memory"
+	"gollm-mini/internal/optimizer"
+	"gollm-mini/internal/template"
+	"gollm-mini/internal/tenant"
+)
+
+/* ---------- tenant admin ---------- */
+
+// TenantInfo 一个租户的数据量
+type TenantInfo struct {
+	Tenant     string `json:"tenant"`
+	Sessions   int    `json:"sessions"`
+	Templates  int    `json:"templates"`
+	Records    int    `json:"optimizer_records"`
+	CacheItems int    `json:"cache_entries"`
+	APIKeys    int    `json:"api_keys"`
+	Jobs       int    `json:"jobs"`
+}
+
+// handleTenantList 列出有数据或绑定了 Key 的租户（含 default）；仅限未绑定租户的 Key
+func handleTenantList(c *gin.Context, tplStore *template.Store) {
+	if bound, ok := boundTenant(c); ok {
+		c.JSON(403, gin.H{"error": "api key is bound to tenant " + tenant.Name(bound)})
+		return
+	}
+	infos, err := tenantInfos(tplStore)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, infos)
+}
+
+func tenantInfos(tplStore *template.Store) ([]TenantInfo, error) {
+	recStore, err := optimizer.Open("optimize")
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*TenantInfo{}
+	get := func(t string) *TenantInfo {
+		if byName[t] == nil {
+			byName[t] = &TenantInfo{Tenant: tenant.Name(t)}
+		}
+		return byName[t]
+	}
+	get(tenant.Default)
+
+	sessions, err := memory.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	for t, n := range sessions {
+		get(t).Sessions = n
+	}
+	entries, err := cache.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	for t, n := range entries {
+		get(t).CacheItems = n
+	}
+	keys, err := apikey.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.Tenant != apikey.AnyTenant {
+			get(k.Tenant).APIKeys++
+		}
+	}
+	jobs, err := job.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	for t, n := range jobs {
+		get(t).Jobs = n
+	}
+	tpls, err := tplStore.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	recs, err := recStore.Tenants()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range append(tpls, recs...) {
+		get(t)
+	}
+	for t, info := range byName {
+		list, err := tplStore.In(t).All()
+		if err != nil {
+			return nil, err
+		}
+		info.Templates = len(list)
+		records, err := recStore.In(t).All()
+		if err != nil {
+			return nil, err
+		}
+		info.Records = len(records)
+	}
+
+	out := make([]TenantInfo, 0, len(byName))
+	for _, info := range byName {
+		out = append(out, *info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+	return out, nil
+}
+
+// tenantParam 解析路径中的租户名；绑定租户的 Key 只能操作自己的租户。出错时已写响应
+func tenantParam(c *gin.Context) (string, bool) {
+	t, err := tenant.Parse(c.Param("name"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if bound, ok := boundTenant(c); ok && bound != t {
+		c.JSON(403, gin.H{"error": "api key is bound to tenant " + tenant.Name(bound)})
+		return "", false
+	}
+	return t, true
+}
+
+// boundTenant 当前 Key 固定使用的租户；未启用鉴权或 Key 可选择租户时 ok 为 false
+func boundTenant(c *gin.Context) (string, bool) {
+	k, ok := currentKey(c)
+	if !ok {
+		return "", false
+	}
+	return k.BoundTenant()
+}
+
+// exportLine 租户导出的一行：type 为 template / session / optimizer_record
+type exportLine struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// handleTenantExport 以 JSONL 导出租户的模板、会话（含归档）与评分记录；缓存可重建，不导出
+func handleTenantExport(c *gin.Context, tplStore *template.Store) {
+	t, ok := tenantParam(c)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := exportTenant(&buf, t, tplStore); err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tenant-%s.jsonl"`, tenant.Name(t)))
+	c.Data(200, "application/x-ndjson", buf.Bytes())
+}
+
+func exportTenant(buf *bytes.Buffer, t string, tplStore *template.Store) error {
+	enc := json.NewEncoder(buf)
+	tpls, err := tplStore.In(t).All()
+	if err != nil {
+		return err
+	}
+	for _, tpl := range tpls {
+		if err := enc.Encode(exportLine{"template", tpl}); err != nil {
+			return err
+		}
+	}
+
+	var sessions bytes.Buffer
+	if err := memory.Export(&sessions, t); err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(&sessions)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if err := enc.Encode(exportLine{"session", json.RawMessage(sc.Bytes())}); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	recStore, err := optimizer.Open("optimize")
+	if err != nil {
+		return err
+	}
+	recs, err := recStore.In(t).All()
+	if err != nil {
+		return err
+	}
+	for _, r := range recs {
+		if err := enc.Encode(exportLine{"optimizer_record", r}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleTenantDelete 删除租户的全部数据（含异步任务）与绑定的 Key；默认租户不能整体删除
+func handleTenantDelete(c *gin.Context, tplStore *template.Store) {
+	t, ok := tenantParam(c)
+	if !ok {
+		return
+	}
+	if t == tenant.Default {
+		c.JSON(400, gin.H{"error": "the default tenant cannot be deleted"})
+		return
+	}
+	info := TenantInfo{Tenant: t}
+	var err error
+	if info.Sessions, err = memory.DeleteTenant(t); err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+		return
+	}
+	if info.Templates, err = tplStore.In(t).Drop(); err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+		return
+	}
+	recStore, err := optimizer.Open("optimize")
+	if err == nil {
+		info.Records, err = recStore.In(t).Drop()
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+		return
+	}
+	if info.CacheItems, err = cache.DeleteTenant(t); err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+		return
+	}
+	if err = removeBatchOutputs(t); err == nil {
+		info.Jobs, err = job.DeleteTenant(t)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+		return
+	}
+	keys, err := apikey.List()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+		return
+	}
+	for _, k := range keys {
+		if k.Tenant != t {
+			continue
+		}
+		if err := apikey.Delete(k.ID); err != nil {
+			c.JSON(500, gin.H{"error": err.Error(), "deleted": info})
+			return
+		}
+		info.APIKeys++
+	}
+	c.JSON(200, gin.H{"deleted": info})
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"gollm-mini/internal/apikey"
+	"gollm-mini/internal/helper"
+	"gollm-mini/internal/memory"
+	"gollm-mini/internal/monitor"
+	"gollm-mini/internal/sse"
+	"gollm-mini/internal/types"
+)
+
+/* ---------- WebSocket chat ---------- */
+
+// WSCommand 客户端发来的一帧
+type WSCommand struct {
+	Type    string          `json:"type"`              // message / stop / regenerate / options
+	Content string          `json:"content,omitempty"` // message 的文本
+	Options json.RawMessage `json:"options,omitempty"` // options：要修改的 types.ChatRequest 字段，如 {"model":"gpt-4o-mini","temperature":0.2}
+}
+
+// WSEvent 服务端发出的一帧；事件名与数据同 /chat 的 SSE 流
+type WSEvent struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// 帧大小上限
+const wsMaxPayload = 1 << 20
+
+// handleWSChat GET /ws/chat?session_id=…：绑定一个会话的双向对话。
+// 同一时间只生成一条回答；生成中可以 stop，参数修改从下一轮生效
+func handleWSChat(c *gin.Context) {
+	raw := c.Query("session_id")
+	if raw == "" {
+		c.JSON(400, gin.H{"error": "session_id is required"})
+		return
+	}
+	sid, ok := qualify(c, raw)
+	if !ok {
+		return
+	}
+	req := types.ChatRequest{Provider: c.Query("provider"), Model: c.Query("model")}
+	probe := req
+	if _, err := newChatLLM(&probe, tenantOf(c)); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	srv := websocket.Server{Handler: func(conn *websocket.Conn) {
+		conn.MaxPayloadBytes = wsMaxPayload
+		_ = conn.SetDeadline(time.Time{}) // 取消 http.Server 的 WriteTimeout，长连接由客户端关闭
+		w := &wsChat{c: c, conn: conn, sid: sid, req: req}
+		w.serve()
+	}}
+	srv.ServeHTTP(c.Writer, c.Request)
+}
+
+type wsChat struct {
+	c    *gin.Context
+	conn *websocket.Conn
+	sid  string // 带租户前缀
+
+	wmu sync.Mutex // 串行写帧
+
+	mu     sync.Mutex
+	req    types.ChatRequest  // 当前参数，options 修改
+	cancel context.CancelFunc // 进行中的生成；nil 表示空闲
+	wg     sync.WaitGroup
+}
+
+// Send 实现 eventSender
+func (w *wsChat) Send(event string, v any) error {
+	w.wmu.Lock()
+	defer w.wmu.Unlock()
+	return websocket.JSON.Send(w.conn, WSEvent{Event: event, Data: v})
+}
+
+// fail 在生成之外报告命令错误
+func (w *wsChat) fail(kind, msg string) {
+	_ = w.Send(sse.EventError, sse.Error{Message: msg, Kind: kind})
+}
+
+func (w *wsChat) serve() {
+	defer w.wg.Wait()
+	defer w.stop() // 连接断开时终止进行中的生成
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(w.conn, &data); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("[WS] %s: %v", w.sid, err)
+			}
+			return
+		}
+		var cmd WSCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			w.fail("bad_request", "invalid command: "+err.Error())
+			continue
+		}
+		switch cmd.Type {
+		case "message":
+			if strings.TrimSpace(cmd.Content) == "" {
+				w.fail("bad_request", "content is required")
+				continue
+			}
+			w.start(cmd.Content)
+		case "regenerate":
+			w.start("")
+		case "stop":
+			w.stop()
+		case "options":
+			w.setOptions(cmd.Options)
+		default:
+			w.fail("bad_request", "unknown command type "+cmd.Type)
+		}
+	}
+}
+
+// start 开始一轮生成；user 为空表示重新生成最后一条回答
+func (w *wsChat) start(user string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.fail("busy", "a reply is being generated; send stop first")
+		return
+	}
+	ctx, cancel := context.WithCancel(w.c.Request.Context())
+	w.cancel = cancel
+	req := w.req
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.turn(ctx, cancel, req, user)
+		w.mu.Lock()
+		w.cancel = nil
+		w.mu.Unlock()
+		cancel()
+	}()
+}
+
+func (w *wsChat) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
+
+// setOptions 把 options 合并到当前参数；会话、消息、模板、结构化与工具不能通过 options 修改
+func (w *wsChat) setOptions(raw json.RawMessage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	next := w.req
+	if err := json.Unmarshal(raw, &next); err != nil {
+		w.fail("bad_request", "invalid options: "+err.Error())
+		return
+	}
+	if next.SessionID != "" || len(next.Messages) > 0 || next.Tpl != "" || next.Schema != "" || len(next.Tools) > 0 {
+		w.fail("bad_request", "session_id, messages, tpl, schema and tools cannot be set over websocket")
+		return
+	}
+	next.Stream = false
+	probe := next
+	if _, err := newChatLLM(&probe, tenantOf(w.c)); err != nil {
+		w.fail("bad_request", err.Error())
+		return
+	}
+	w.req = next
+}
+
+// turn 一轮生成：事件同 SSE 流；stop 结束的回答 finish_reason 为 cancelled，
+// 仅在 save_partial 时保存已生成的部分
+func (w *wsChat) turn(ctx context.Context, cancel context.CancelFunc, req types.ChatRequest, user string) {
+	if err := checkKey(w.c); err != nil {
+		kind := "server"
+		switch {
+		case errors.Is(err, apikey.ErrRateLimited):
+			kind = "rate_limit"
+		case errors.Is(err, apikey.ErrQuotaExceeded):
+			kind = "quota_exceeded"
+		}
+		w.fail(kind, err.Error())
+		return
+	}
+	llm, err := newChatLLM(&req, tenantOf(w.c))
+	if err != nil {
+		w.fail("bad_request", err.Error())
+		return
+	}
+
+	var (
+		msgs []types.Message
+		save func(string)
+	)
+	if user != "" {
+		history, err := memory.Load(w.sid)
+		if err != nil {
+			w.fail("server", err.Error())
+			return
+		}
+		msgs = append(history, types.Message{Role: types.RoleUser, Content: user})
+		save = func(reply string) {
+			_ = memory.Append(w.sid, []types.Message{
+				{Role: types.RoleUser, Content: user},
+				{Role: types.RoleAssistant, Content: reply},
+			})
+		}
+	} else {
+		turn, err := memory.Regenerate(w.sid)
+		if err != nil {
+			w.fail("bad_request", err.Error())
+			return
+		}
+		msgs, save = turn.Messages, saveBranch(turn)
+	}
+	if req.System != "" {
+		msgs = append([]types.Message{{Role: types.RoleSystem, Content: req.System}}, msgs...)
+	}
+
+	text, usage, err := streamTurn(ctx, cancel, w, helper.NewID("req-"), llm, msgs, req.GenerateOptions)
+	noteUsage(w.c, usage.ServedBy, usage)
+	endTurn(w, req.GenerateOptions, usage, err)
+	switch {
+	case err == nil:
+		save(text)
+	case errors.Is(err, context.Canceled) && req.SavePartial && text != "":
+		save(text)
+	}
+}
+
+// checkKey 每轮生成前检查 RPM 与每日配额：长连接只在握手时经过中间件
+func checkKey(c *gin.Context) error {
+	k, ok := currentKey(c)
+	if !ok || k.ID == staticKey.ID {
+		return nil
+	}
+	if err := apikey.Allow(k); err != nil {
+		monitor.KeyRequests.WithLabelValues(k.ID, "rate_limited").Inc()
+		return err
+	}
+	if err := apikey.CheckQuota(k); err != nil {
+		if errors.Is(err, apikey.ErrQuotaExceeded) {
+			monitor.KeyRequests.WithLabelValues(k.ID, "quota_exceeded").Inc()
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package sse 流式接口使用的 SSE 协议。每个事件是一个 event 字段加一行 JSON：
+//
+//	event: delta
+//	data: {"content":"Hel"}
+//
+// 事件顺序为 start → delta* → [error] → usage → done，done 一定是最后一个事件。
+// 版本号见 Version，通过 start 事件和响应头 X-Stream-Protocol 告知客户端。
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gollm-mini/internal/types"
+)
+
+// Version 协议版本；事件名或字段语义不兼容变化时递增
+const Version = 1
+
+// Header 响应头，值为协议版本
+const Header = "X-Stream-Protocol"
+
+// 事件名
+const (
+	EventStart = "start"
+	EventDelta = "delta"
+	EventUsage = "usage"
+	EventError = "error"
+	EventDone  = "done"
+)
+
+// Finish reasons
+const (
+	FinishStop      = "stop"      // 正常结束
+	FinishLength    = "length"    // 达到 max_tokens
+	FinishError     = "error"     // 出错，见之前的 error 事件
+	FinishCancelled = "cancelled" // 被客户端停止（WebSocket stop）
+)
+
+// Start 第一个事件
+type Start struct {
+	Version   int    `json:"version"`
+	RequestID string `json:"request_id"`
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+}
+
+// Delta 新生成的文本片段
+type Delta struct {
+	Content string `json:"content"`
+}
+
+// Usage token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	TrimmedTokens    int `json:"trimmed_tokens,omitempty"` // 超出上下文窗口被裁掉的 token
+}
+
+// FromUsage 转换 types.Usage
+func FromUsage(u types.Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.Total(),
+		TrimmedTokens:    u.TrimmedTokens,
+	}
+}
+
+// Error 生成失败；之后仍会发送 usage 与 done
+type Error struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind,omitempty"` // provider.ErrorKind，如 rate_limit / timeout
+}
+
+// Done 最后一个事件
+type Done struct {
+	FinishReason string `json:"finish_reason"`
+	Usage        Usage  `json:"usage"`
+	ServedBy     string `json:"served_by,omitempty"` // 实际完成请求的 provider:model
+}
+
+// Writer 写 SSE 事件，每个事件后立即 flush
+type Writer struct {
+	w     io.Writer
+	flush func()
+}
+
+// NewWriter 设置 SSE 响应头；需在写出任何内容之前调用
+func NewWriter(w http.ResponseWriter) *Writer {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	h.Set(Header, strconv.Itoa(Version))
+	out := &Writer{w: w, flush: func() {}}
+	if f, ok := w.(http.Flusher); ok {
+		out.flush = f.Flush
+	}
+	return out
+}
+
+// Send 写出一个事件，v 编码为单行 JSON
+func (w *Writer) Send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	w.flush()
+	return nil
+}
+
+// Event 读到的一个事件
+type Event struct {
+	Name string
+	Data json.RawMessage
+}
+
+// Decode 把事件数据解到 v
+func (e Event) Decode(v any) error { return json.Unmarshal(e.Data, v) }
+
+// Read 逐个解析 r 中的事件并回调，fn 返回错误时停止；
+// 忽略注释行与 id / retry 字段，多行 data 按规范以换行连接
+func Read(r io.Reader, fn func(Event) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var (
+		name string
+		data bytes.Buffer
+	)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" { // 空行结束一个事件
+			if data.Len() > 0 {
+				if name == "" {
+					name = "message"
+				}
+				if err := fn(Event{Name: name, Data: append(json.RawMessage(nil), data.Bytes()...)}); err != nil {
+					return err
+				}
+			}
+			name = ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			name = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type boltDB struct{ db *bolt.DB }
+
+// openBolt 文件被其他进程占用时 1s 后报错，而不是一直阻塞
+func openBolt(path string) (DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &boltDB{db: db}, nil
+}
+
+func (d *boltDB) View(fn func(Tx) error) error {
+	return d.db.View(func(tx *bolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+func (d *boltDB) Update(fn func(Tx) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+func (d *boltDB) Close() error { return d.db.Close() }
+
+type boltTx struct{ tx *bolt.Tx }
+
+func (t boltTx) Bucket(name []byte) Bucket {
+	if b := t.tx.Bucket(name); b != nil {
+		return boltBucket{b}
+	}
+	return nil
+}
+
+func (t boltTx) CreateBucket(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucket(name)
+	if err != nil {
+		return nil, boltErr(err)
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, boltErr(err)
+	}
+	return boltBucket{b}, nil
+}
+
+func (t boltTx) DeleteBucket(name []byte) error { return boltErr(t.tx.DeleteBucket(name)) }
+
+func (t boltTx) ForEachBucket(fn func(name []byte) error) error {
+	return t.tx.ForEach(func(name []byte, _ *bolt.Bucket) error { return fn(name) })
+}
+
+type boltBucket struct{ b *bolt.Bucket }
+
+func (b boltBucket) Get(key []byte) []byte { return b.b.Get(key) }
+func (b boltBucket) Put(key, value []byte) error {
+	return boltErr(b.b.Put(key, value))
+}
+func (b boltBucket) Delete(key []byte) error { return boltErr(b.b.Delete(key)) }
+func (b boltBucket) KeyN() int               { return b.b.Stats().KeyN }
+func (b boltBucket) Sequence() uint64        { return b.b.Sequence() }
+func (b boltBucket) SetSequence(n uint64) error {
+	return boltErr(b.b.SetSequence(n))
+}
+func (b boltBucket) NextSequence() (uint64, error) {
+	n, err := b.b.NextSequence()
+	return n, boltErr(err)
+}
+
+func (b boltBucket) ForEach(fn func(k, v []byte) error) error {
+	return b.b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil // 嵌套桶
+		}
+		return fn(k, v)
+	})
+}
+
+func (b boltBucket) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	c := b.b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if v == nil {
+			continue
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltErr 映射为本包的错误，调用方不必区分后端
+func boltErr(err error) error {
+	switch {
+	case errors.Is(err, bolt.ErrBucketNotFound):
+		return ErrBucketNotFound
+	case errors.Is(err, bolt.ErrBucketExists):
+		return ErrBucketExists
+	case errors.Is(err, bolt.ErrTxNotWritable):
+		return ErrTxNotWritable
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// memDB 进程内存储；写事务记录 undo 日志，出错时回滚
+type memDB struct {
+	mu      sync.RWMutex
+	buckets map[string]*memBucket
+}
+
+type memBucket struct {
+	data map[string][]byte
+	seq  uint64
+}
+
+func newMemDB() *memDB { return &memDB{buckets: map[string]*memBucket{}} }
+
+// NewMemory 返回独立的内存存储，不经过 Configure / Open，便于测试
+func NewMemory() DB { return newMemDB() }
+
+func (d *memDB) View(fn func(Tx) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return fn(&memTx{db: d})
+}
+
+func (d *memDB) Update(fn func(Tx) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx := &memTx{db: d, writable: true}
+	if err := fn(tx); err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+func (d *memDB) Close() error { return nil }
+
+type memTx struct {
+	db       *memDB
+	writable bool
+	undo     []func()
+}
+
+func (t *memTx) Bucket(name []byte) Bucket {
+	if b, ok := t.db.buckets[string(name)]; ok {
+		return &memBucketTx{tx: t, b: b}
+	}
+	return nil
+}
+
+func (t *memTx) CreateBucket(name []byte) (Bucket, error) {
+	if !t.writable {
+		return nil, ErrTxNotWritable
+	}
+	key := string(name)
+	if _, ok := t.db.buckets[key]; ok {
+		return nil, ErrBucketExists
+	}
+	b := &memBucket{data: map[string][]byte{}}
+	t.db.buckets[key] = b
+	t.undo = append(t.undo, func() { delete(t.db.buckets, key) })
+	return &memBucketTx{tx: t, b: b}, nil
+}
+
+func (t *memTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+	return t.CreateBucket(name)
+}
+
+func (t *memTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return ErrTxNotWritable
+	}
+	key := string(name)
+	b, ok := t.db.buckets[key]
+	if !ok {
+		return ErrBucketNotFound
+	}
+	delete(t.db.buckets, key)
+	t.undo = append(t.undo, func() { t.db.buckets[key] = b })
+	return nil
+}
+
+func (t *memTx) ForEachBucket(fn func(name []byte) error) error {
+	names := make([]string, 0, len(t.db.buckets))
+	for n := range t.db.buckets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := fn([]byte(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memBucketTx struct {
+	tx *memTx
+	b  *memBucket
+}
+
+func (b *memBucketTx) Get(key []byte) []byte { return b.b.data[string(key)] }
+
+func (b *memBucketTx) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	b.set(string(key), append([]byte{}, value...))
+	return nil
+}
+
+func (b *memBucketTx) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	if _, ok := b.b.data[string(key)]; ok {
+		b.set(string(key), nil)
+	}
+	return nil
+}
+
+// set 写入或删除（v 为 nil），并记录旧值用于回滚
+func (b *memBucketTx) set(k string, v []byte) {
+	old, existed := b.b.data[k]
+	data := b.b.data
+	b.tx.undo = append(b.tx.undo, func() {
+		if existed {
+			data[k] = old
+		} else {
+			delete(data, k)
+		}
+	})
+	if v == nil {
+		delete(data, k)
+	} else {
+		data[k] = v
+	}
+}
+
+func (b *memBucketTx) ForEach(fn func(k, v []byte) error) error { return b.Scan(nil, fn) }
+
+func (b *memBucketTx) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	keys := make([]string, 0, len(b.b.data))
+	for k := range b.b.data {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), b.b.data[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memBucketTx) KeyN() int        { return len(b.b.data) }
+func (b *memBucketTx) Sequence() uint64 { return b.b.seq }
+
+func (b *memBucketTx) SetSequence(n uint64) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	old, mb := b.b.seq, b.b
+	b.tx.undo = append(b.tx.undo, func() { mb.seq = old })
+	mb.seq = n
+	return nil
+}
+
+func (b *memBucketTx) NextSequence() (uint64, error) {
+	if err := b.SetSequence(b.b.seq + 1); err != nil {
+		return 0, err
+	}
+	return b.b.seq, nil
+}
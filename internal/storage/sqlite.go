@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlite 后端：所有桶共用一张 kv 表，桶名与序列号存在 buckets 表
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (name BLOB PRIMARY KEY, seq INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE IF NOT EXISTS kv (
+	bucket BLOB NOT NULL,
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;`
+
+// sqliteDB 写连接池只有一个连接且以 BEGIN IMMEDIATE 开事务，写事务串行，与 bolt 一致；
+// 只读事务走独立的读连接池，以 BEGIN DEFERRED 开事务，WAL 下不与写事务互相阻塞
+type sqliteDB struct{ write, read *sql.DB }
+
+func openSQLite(path string) (DB, error) {
+	write, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	write.SetMaxOpenConns(1)
+	if _, err := write.Exec(sqliteSchema); err != nil {
+		write.Close()
+		return nil, err
+	}
+	read, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_txlock=deferred&_query_only=true")
+	if err != nil {
+		write.Close()
+		return nil, err
+	}
+	return &sqliteDB{write: write, read: read}, nil
+}
+
+func (d *sqliteDB) View(fn func(Tx) error) error { return d.run(d.read, false, fn) }
+
+func (d *sqliteDB) Update(fn func(Tx) error) error { return d.run(d.write, true, fn) }
+
+func (d *sqliteDB) run(db *sql.DB, writable bool, fn func(Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	t := &sqliteTx{tx: tx, writable: writable}
+	err = fn(t)
+	if err == nil {
+		err = t.err
+	}
+	if err != nil || !writable {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *sqliteDB) Close() error { return errors.Join(d.read.Close(), d.write.Close()) }
+
+// sqliteTx Get / KeyN 等无法返回错误的读取失败时记在 err，事务结束时返回
+type sqliteTx struct {
+	tx       *sql.Tx
+	writable bool
+	err      error
+}
+
+func (t *sqliteTx) fail(err error) {
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *sqliteTx) exists(name []byte) bool {
+	var n int
+	err := t.tx.QueryRow(`SELECT COUNT(*) FROM buckets WHERE name = ?`, name).Scan(&n)
+	t.fail(err)
+	return n > 0
+}
+
+func (t *sqliteTx) Bucket(name []byte) Bucket {
+	if !t.exists(name) {
+		return nil
+	}
+	return &sqliteBucket{tx: t, name: append([]byte{}, name...)}
+}
+
+func (t *sqliteTx) CreateBucket(name []byte) (Bucket, error) {
+	if !t.writable {
+		return nil, ErrTxNotWritable
+	}
+	if t.exists(name) {
+		return nil, ErrBucketExists
+	}
+	if _, err := t.tx.Exec(`INSERT INTO buckets (name) VALUES (?)`, name); err != nil {
+		return nil, err
+	}
+	return &sqliteBucket{tx: t, name: append([]byte{}, name...)}, nil
+}
+
+func (t *sqliteTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+	return t.CreateBucket(name)
+}
+
+func (t *sqliteTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return ErrTxNotWritable
+	}
+	res, err := t.tx.Exec(`DELETE FROM buckets WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBucketNotFound
+	}
+	_, err = t.tx.Exec(`DELETE FROM kv WHERE bucket = ?`, name)
+	return err
+}
+
+func (t *sqliteTx) ForEachBucket(fn func(name []byte) error) error {
+	names, err := t.column(`SELECT name FROM buckets ORDER BY name`)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sqliteTx) column(query string, args ...any) ([][]byte, error) {
+	rows, err := t.tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out [][]byte
+	for rows.Next() {
+		var v []byte
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+type sqliteBucket struct {
+	tx   *sqliteTx
+	name []byte
+}
+
+func (b *sqliteBucket) Get(key []byte) []byte {
+	var v []byte
+	err := b.tx.tx.QueryRow(`SELECT value FROM kv WHERE bucket = ? AND key = ?`, b.name, key).Scan(&v)
+	if !errors.Is(err, sql.ErrNoRows) {
+		b.tx.fail(err)
+	}
+	return v
+}
+
+func (b *sqliteBucket) Put(key, value []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := b.tx.tx.Exec(`INSERT OR REPLACE INTO kv (bucket, key, value) VALUES (?, ?, ?)`, b.name, key, value)
+	return err
+}
+
+func (b *sqliteBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	_, err := b.tx.tx.Exec(`DELETE FROM kv WHERE bucket = ? AND key = ?`, b.name, key)
+	return err
+}
+
+func (b *sqliteBucket) ForEach(fn func(k, v []byte) error) error { return b.Scan(nil, fn) }
+
+// Scan 先读完结果集再回调，回调中可以继续查询
+func (b *sqliteBucket) Scan(prefix []byte, fn func(k, v []byte) error) error {
+	query, args := `SELECT key, value FROM kv WHERE bucket = ?`, []any{b.name}
+	if len(prefix) > 0 {
+		query += ` AND key >= ?`
+		args = append(args, prefix)
+		if end := prefixEnd(prefix); end != nil {
+			query += ` AND key < ?`
+			args = append(args, end)
+		}
+	}
+	rows, err := b.tx.tx.Query(query+` ORDER BY key`, args...)
+	if err != nil {
+		return err
+	}
+	var kvs [][2][]byte
+	for rows.Next() {
+		var k, v []byte
+		if err := rows.Scan(&k, &v); err != nil {
+			rows.Close()
+			return err
+		}
+		kvs = append(kvs, [2][]byte{k, v})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		if err := fn(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *sqliteBucket) KeyN() int {
+	var n int
+	b.tx.fail(b.tx.tx.QueryRow(`SELECT COUNT(*) FROM kv WHERE bucket = ?`, b.name).Scan(&n))
+	return n
+}
+
+func (b *sqliteBucket) Sequence() uint64 {
+	var n int64
+	b.tx.fail(b.tx.tx.QueryRow(`SELECT seq FROM buckets WHERE name = ?`, b.name).Scan(&n))
+	return uint64(n)
+}
+
+func (b *sqliteBucket) SetSequence(n uint64) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+	_, err := b.tx.tx.Exec(`UPDATE buckets SET seq = ? WHERE name = ?`, int64(n), b.name)
+	return err
+}
+
+func (b *sqliteBucket) NextSequence() (uint64, error) {
+	n := b.Sequence() + 1
+	if b.tx.err != nil {
+		return 0, fmt.Errorf("read sequence: %w", b.tx.err)
+	}
+	return n, b.SetSequence(n)
+}
+
+// prefixEnd 大于所有以 prefix 开头的 key 的最小值；prefix 全为 0xff 时返回 nil
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Package storage 是 cache / memory / template / optimizer 共用的键值存储：
+// 命名桶 + 事务，语义与 BoltDB 一致，后端可选 bolt / sqlite / memory。
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 后端名称
+const (
+	Bolt   = "bolt"
+	SQLite = "sqlite"
+	Memory = "memory" // 进程内，重启即丢失，适合测试
+)
+
+var (
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrBucketExists   = errors.New("bucket already exists")
+	ErrTxNotWritable  = errors.New("tx not writable")
+)
+
+// DB 一个命名存储；同一 DB 同时只有一个写事务
+type DB interface {
+	View(fn func(tx Tx) error) error   // 只读事务
+	Update(fn func(tx Tx) error) error // 读写事务，fn 返回错误时整体回滚
+	Close() error
+}
+
+// Tx 事务内的桶操作；取到的 Bucket 与 []byte 只在事务内有效
+type Tx interface {
+	Bucket(name []byte) Bucket // 不存在时返回 nil
+	CreateBucket(name []byte) (Bucket, error)
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+	DeleteBucket(name []byte) error
+	ForEachBucket(fn func(name []byte) error) error // 按名称升序
+}
+
+// Bucket 有序键值集合；ForEach / Scan 的回调中不要修改本桶
+type Bucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error             // 按 key 字节序升序
+	Scan(prefix []byte, fn func(k, v []byte) error) error // 仅 prefix 开头的 key
+	KeyN() int
+	Sequence() uint64
+	SetSequence(n uint64) error
+	NextSequence() (uint64, error)
+}
+
+// Config 存储配置：所有模块共用一个后端与数据目录
+type Config struct {
+	Backend string `json:"backend" yaml:"backend"` // bolt（默认）/ sqlite / memory
+	Dir     string `json:"dir" yaml:"dir"`         // 数据目录，默认 GOLLM_DATA_DIR 或当前目录
+}
+
+var (
+	mu     sync.Mutex
+	cfg    = Config{Backend: Bolt, Dir: defaultDir()}
+	opened = map[string]DB{}
+)
+
+func defaultDir() string {
+	if d := os.Getenv("GOLLM_DATA_DIR"); d != "" {
+		return d
+	}
+	return "."
+}
+
+// Configure 设置后端与数据目录，需在首次 Open 之前调用；空字段取默认值
+func Configure(c Config) error {
+	if c.Backend == "" {
+		c.Backend = Bolt
+	}
+	if c.Dir == "" {
+		c.Dir = defaultDir()
+	}
+	switch c.Backend {
+	case Bolt, SQLite:
+		if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+			return fmt.Errorf("storage: data dir: %w", err)
+		}
+	case Memory:
+	default:
+		return fmt.Errorf("storage: unknown backend %q (bolt / sqlite / memory)", c.Backend)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	cfg = c
+	return nil
+}
+
+// Current 当前配置
+func Current() Config {
+	mu.Lock()
+	defer mu.Unlock()
+	return cfg
+}
+
+// Open 打开名为 name 的存储（bolt: <dir>/<name>.db，sqlite: <dir>/<name>.sqlite）；
+// 同名重复打开返回同一实例
+func Open(name string) (DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if db, ok := opened[name]; ok {
+		return db, nil
+	}
+	var (
+		db  DB
+		err error
+	)
+	switch cfg.Backend {
+	case SQLite:
+		db, err = openSQLite(filepath.Join(cfg.Dir, name+".sqlite"))
+	case Memory:
+		db = newMemDB()
+	default:
+		db, err = openBolt(filepath.Join(cfg.Dir, name+".db"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: open %s: %w", name, err)
+	}
+	opened[name] = db
+	return db, nil
+}
+
+// CloseAll 关闭所有已打开的存储
+func CloseAll() error {
+	mu.Lock()
+	defer mu.Unlock()
+	var errs []error
+	for name, db := range opened {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		delete(opened, name)
+	}
+	return errors.Join(errs...)
+}
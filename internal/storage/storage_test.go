@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// backends 每个后端各开一个全新的存储
+var backends = []struct {
+	name string
+	open func(t *testing.T) DB
+}{
+	{Bolt, func(t *testing.T) DB { return mustOpen(t, openBolt, "t.db") }},
+	{SQLite, func(t *testing.T) DB { return mustOpen(t, openSQLite, "t.sqlite") }},
+	{Memory, func(t *testing.T) DB { return newMemDB() }},
+}
+
+func mustOpen(t *testing.T, open func(string) (DB, error), file string) DB {
+	t.Helper()
+	db, err := open(filepath.Join(t.TempDir(), file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func put(t *testing.T, db DB, bucket string, kvs ...string) {
+	t.Helper()
+	err := db.Update(func(tx Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(kvs); i += 2 {
+			if err := b.Put([]byte(kvs[i]), []byte(kvs[i+1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// scan 返回 prefix 下的 k=v；prefix 为 nil 时走 ForEach
+func scan(t *testing.T, db DB, bucket string, prefix []byte) []string {
+	t.Helper()
+	var out []string
+	err := db.View(func(tx Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrBucketNotFound
+		}
+		collect := func(k, v []byte) error { out = append(out, string(k)+"="+string(v)); return nil }
+		if prefix == nil {
+			return b.ForEach(collect)
+		}
+		return b.Scan(prefix, collect)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// 三个后端对同一组操作给出相同结果
+func TestConformance(t *testing.T) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, db DB)
+	}{
+		{"put get delete", func(t *testing.T, db DB) {
+			put(t, db, "b", "k", "v1")
+			put(t, db, "b", "k", "v2")
+			err := db.Update(func(tx Tx) error {
+				b := tx.Bucket([]byte("b"))
+				if got := string(b.Get([]byte("k"))); got != "v2" {
+					t.Errorf("get %q, want v2", got)
+				}
+				if b.Get([]byte("missing")) != nil {
+					t.Error("missing key not nil")
+				}
+				return b.Delete([]byte("k"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := scan(t, db, "b", nil); len(got) != 0 {
+				t.Errorf("after delete %q", got)
+			}
+		}},
+		{"foreach order", func(t *testing.T, db DB) {
+			put(t, db, "b", "b", "2", "a", "1", "\xff", "4", "ab", "3")
+			if got := scan(t, db, "b", nil); !slices.Equal(got, []string{"a=1", "ab=3", "b=2", "\xff=4"}) {
+				t.Errorf("foreach %q", got)
+			}
+			_ = db.View(func(tx Tx) error {
+				if n := tx.Bucket([]byte("b")).KeyN(); n != 4 {
+					t.Errorf("KeyN %d, want 4", n)
+				}
+				return nil
+			})
+		}},
+		{"prefix scan", func(t *testing.T, db DB) {
+			put(t, db, "b", "a", "0", "ab", "1", "ab\x00", "2", "ab\xff", "3", "ac", "4", "\xff", "5", "\xff\x01", "6")
+			for _, tc := range []struct {
+				prefix string
+				want   []string
+			}{
+				{"ab", []string{"ab=1", "ab\x00=2", "ab\xff=3"}},
+				{"a", []string{"a=0", "ab=1", "ab\x00=2", "ab\xff=3", "ac=4"}},
+				{"\xff", []string{"\xff=5", "\xff\x01=6"}},
+				{"z", nil},
+			} {
+				if got := scan(t, db, "b", []byte(tc.prefix)); !slices.Equal(got, tc.want) {
+					t.Errorf("scan %q: %q, want %q", tc.prefix, got, tc.want)
+				}
+			}
+		}},
+		{"buckets", func(t *testing.T, db DB) {
+			put(t, db, "y", "k", "y")
+			put(t, db, "x", "k", "x")
+			err := db.Update(func(tx Tx) error {
+				if _, err := tx.CreateBucket([]byte("x")); !errors.Is(err, ErrBucketExists) {
+					t.Errorf("create existing: %v", err)
+				}
+				if err := tx.DeleteBucket([]byte("none")); !errors.Is(err, ErrBucketNotFound) {
+					t.Errorf("delete missing: %v", err)
+				}
+				if tx.Bucket([]byte("none")) != nil {
+					t.Error("missing bucket not nil")
+				}
+				var names []string
+				_ = tx.ForEachBucket(func(name []byte) error { names = append(names, string(name)); return nil })
+				if !slices.Equal(names, []string{"x", "y"}) {
+					t.Errorf("buckets %q", names)
+				}
+				return tx.DeleteBucket([]byte("x"))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 桶之间互不可见，删除的桶连同数据一起消失
+			put(t, db, "x")
+			if got := scan(t, db, "x", nil); len(got) != 0 {
+				t.Errorf("recreated bucket %q", got)
+			}
+			if got := scan(t, db, "y", nil); !slices.Equal(got, []string{"k=y"}) {
+				t.Errorf("other bucket %q", got)
+			}
+		}},
+		{"sequence", func(t *testing.T, db DB) {
+			err := db.Update(func(tx Tx) error {
+				b, _ := tx.CreateBucket([]byte("b"))
+				if err := b.SetSequence(41); err != nil {
+					return err
+				}
+				n, err := b.NextSequence()
+				if n != 42 || b.Sequence() != 42 {
+					t.Errorf("next %d, sequence %d", n, b.Sequence())
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"rollback", func(t *testing.T, db DB) {
+			put(t, db, "b", "k", "v")
+			boom := errors.New("boom")
+			err := db.Update(func(tx Tx) error {
+				b := tx.Bucket([]byte("b"))
+				_ = b.Put([]byte("k"), []byte("changed"))
+				_ = b.Put([]byte("new"), []byte("x"))
+				_, _ = tx.CreateBucket([]byte("c"))
+				return boom
+			})
+			if !errors.Is(err, boom) {
+				t.Fatalf("err %v", err)
+			}
+			if got := scan(t, db, "b", nil); !slices.Equal(got, []string{"k=v"}) {
+				t.Errorf("after rollback %q", got)
+			}
+			_ = db.View(func(tx Tx) error {
+				if tx.Bucket([]byte("c")) != nil {
+					t.Error("bucket created in rolled back tx")
+				}
+				return nil
+			})
+		}},
+		{"read only", func(t *testing.T, db DB) {
+			put(t, db, "b", "k", "v")
+			_ = db.View(func(tx Tx) error {
+				if _, err := tx.CreateBucket([]byte("c")); !errors.Is(err, ErrTxNotWritable) {
+					t.Errorf("create bucket: %v", err)
+				}
+				if err := tx.Bucket([]byte("b")).Put([]byte("k"), []byte("x")); !errors.Is(err, ErrTxNotWritable) {
+					t.Errorf("put: %v", err)
+				}
+				return nil
+			})
+		}},
+	}
+	for _, be := range backends {
+		for _, tc := range cases {
+			t.Run(be.name+"/"+tc.name, func(t *testing.T) { tc.run(t, be.open(t)) })
+		}
+	}
+}
+
+// sqlite 的只读事务不等待进行中的写事务
+func TestSQLiteViewDuringUpdate(t *testing.T) {
+	db := mustOpen(t, openSQLite, "t.sqlite")
+	put(t, db, "b", "k", "v")
+	err := db.Update(func(tx Tx) error {
+		if err := tx.Bucket([]byte("b")).Put([]byte("k"), []byte("uncommitted")); err != nil {
+			return err
+		}
+		done := make(chan string, 1)
+		go func() {
+			_ = db.View(func(tx Tx) error {
+				done <- string(tx.Bucket([]byte("b")).Get([]byte("k")))
+				return nil
+			})
+		}()
+		select {
+		case got := <-done:
+			if got != "v" {
+				t.Errorf("view during update %q, want committed v", got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("view blocked by update")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
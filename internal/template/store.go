@@ -1,14 +1,15 @@
 package template
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
 	"time"
 
-	bolt "go.etcd.io/bbolt"
+	"gollm-mini/internal/storage"
+	"gollm-mini/internal/tenant"
+	"gollm-mini/internal/types"
 )
 
 const bucket = "prompts"
@@ -20,19 +21,87 @@ type Template struct {
 	Content string   `json:"content"`
 	Vars    []string `json:"vars,omitempty"`
 	Parts
-	CreatedAt time.Time `json:"created_at"`
+	Options   types.GenerateOptions `json:"options"` // 默认生成参数，请求中显式指定的优先
+	CreatedAt time.Time             `json:"created_at"`
 }
 
-type Store struct{ db *bolt.DB }
+// Store 模板库；In 返回某个租户的视图，各租户的模板在各自的桶中
+type Store struct {
+	db     storage.DB
+	bucket []byte
+}
+
+// Open 打开名为 name 的模板库（见 storage.Open）
+func Open(name string) (*Store, error) {
+	db, err := storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(db), nil
+}
+
+// NewStore 使用指定的存储，测试时可传 storage.NewMemory()
+func NewStore(db storage.DB) *Store { return &Store{db: db, bucket: []byte(bucket)} }
 
-func Open(path string) (*Store, error) {
-	db, err := bolt.Open(path, 0600, nil)
-	return &Store{db: db}, err
+// In 租户 t 的模板库，桶名为 "@<t>/prompts"；默认租户即原桶
+func (s *Store) In(t string) *Store {
+	return &Store{db: s.db, bucket: []byte(tenant.Prefix(t) + bucket)}
+}
+
+// Tenants 有模板的非默认租户
+func (s *Store) Tenants() ([]string, error) {
+	var out []string
+	err := s.db.View(func(tx storage.Tx) error {
+		return tx.ForEachBucket(func(name []byte) error {
+			if t, rest := tenant.Split(string(name)); t != tenant.Default && rest == bucket {
+				out = append(out, t)
+			}
+			return nil
+		})
+	})
+	return out, err
+}
+
+// All 本租户全部模板（按名称、版本升序）
+func (s *Store) All() ([]Template, error) {
+	var list []Template
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var t Template
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			list = append(list, t)
+			return nil
+		})
+	})
+	return list, err
+}
+
+// Drop 删除本租户的全部模板，返回删除数量
+func (s *Store) Drop() (int, error) {
+	n := 0
+	err := s.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return nil
+		}
+		n = b.KeyN()
+		return tx.DeleteBucket(s.bucket)
+	})
+	return n, err
 }
 
 func (s *Store) Save(tpl Template) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		b, _ := tx.CreateBucketIfNotExists([]byte(bucket))
+	return s.db.Update(func(tx storage.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return err
+		}
 		data, _ := json.Marshal(tpl)
 		return b.Put([]byte(tplKey(tpl.Name, tpl.Version)), data)
 	})
@@ -40,8 +109,8 @@ func (s *Store) Save(tpl Template) error {
 
 func (s *Store) Get(name string, version int) (Template, error) {
 	var tpl Template
-	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
 		if b == nil {
 			return errors.New("no bucket")
 		}
@@ -56,17 +125,15 @@ func (s *Store) Get(name string, version int) (Template, error) {
 
 func (s *Store) Latest(name string) (Template, error) {
 	var latest Template
-	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
 		if b == nil {
 			return errors.New("no bucket")
 		}
-		c := b.Cursor()
-		prefix := []byte(name + ":")
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		return b.Scan([]byte(name+":"), func(_, v []byte) error {
 			_ = json.Unmarshal(v, &latest)
-		}
-		return nil
+			return nil
+		})
 	})
 	if latest.Name == "" {
 		return latest, errors.New("not found")
@@ -77,27 +144,25 @@ func (s *Store) Latest(name string) (Template, error) {
 // List 返回同名模板所有版本（按版本升序）
 func (s *Store) List(name string) ([]Template, error) {
 	var list []Template
-	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
 		if b == nil {
 			return nil
 		}
-		c := b.Cursor()
-		prefix := []byte(name + ":")
-		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		return b.Scan([]byte(name+":"), func(_, v []byte) error {
 			var t Template
 			_ = json.Unmarshal(v, &t)
 			list = append(list, t)
-		}
-		return nil
+			return nil
+		})
 	})
 	return list, err
 }
 
 // Delete (name, version) 删除指定版本
 func (s *Store) Delete(name string, version int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	return s.db.Update(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
 		if b == nil {
 			return nil
 		}
@@ -109,20 +174,19 @@ func (s *Store) Delete(name string, version int) error {
 func (s *Store) ListAllLatest() ([]Template, error) {
 	latest := make(map[string]Template)
 
-	err := s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+	err := s.db.View(func(tx storage.Tx) error {
+		b := tx.Bucket(s.bucket)
 		if b == nil {
 			return nil
 		}
-		c := b.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+		return b.ForEach(func(_, v []byte) error {
 			var t Template
 			_ = json.Unmarshal(v, &t)
 			if cur, ok := latest[t.Name]; !ok || t.Version > cur.Version {
 				latest[t.Name] = t
 			}
-		}
-		return nil
+			return nil
+		})
 	})
 
 	// 组装为切片
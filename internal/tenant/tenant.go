@@ -0,0 +1,90 @@
+// Package tenant 多租户命名空间：租户数据的桶名 / key 以 "@<tenant>/" 开头，
+// 默认租户不加前缀，与已有数据兼容。
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Default 默认租户（未绑定租户的 Key、未带 X-Tenant 的请求）
+const Default = ""
+
+// DefaultName 管理接口中指代默认租户的名称
+const DefaultName = "default"
+
+// ErrReserved 以 "@" 开头的 ID 留给租户前缀
+var ErrReserved = errors.New(`ids starting with "@" are reserved for tenant namespaces`)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Validate 租户名：小写字母、数字、- 与 _，最长 63；空串为默认租户
+func Validate(t string) error {
+	if t == Default || namePattern.MatchString(t) {
+		return nil
+	}
+	return fmt.Errorf("invalid tenant %q (lowercase letters, digits, - and _, up to 63 chars)", t)
+}
+
+// Parse 解析管理接口中的租户名，DefaultName 对应默认租户
+func Parse(name string) (string, error) {
+	if name == DefaultName {
+		return Default, nil
+	}
+	if name == "" {
+		return "", errors.New("tenant name required")
+	}
+	return name, Validate(name)
+}
+
+// Name Parse 的逆操作，用于展示
+func Name(t string) string {
+	if t == Default {
+		return DefaultName
+	}
+	return t
+}
+
+// Prefix 租户的桶名 / key 前缀，默认租户为空
+func Prefix(t string) string {
+	if t == Default {
+		return ""
+	}
+	return "@" + t + "/"
+}
+
+// Qualify 把调用方给出的 ID（会话 ID 等）放入租户命名空间
+func Qualify(t, id string) (string, error) {
+	if strings.HasPrefix(id, "@") {
+		return "", ErrReserved
+	}
+	return Prefix(t) + id, nil
+}
+
+// Split 拆出带前缀的名称所属租户与剩余部分；无前缀时属于默认租户
+func Split(s string) (t, rest string) {
+	if !strings.HasPrefix(s, "@") {
+		return Default, s
+	}
+	name, rest, ok := strings.Cut(s[1:], "/")
+	if !ok || name == "" || Validate(name) != nil {
+		return Default, s
+	}
+	return name, rest
+}
+
+type ctxKey struct{}
+
+// With 把租户放入 ctx
+func With(ctx context.Context, t string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// From 取出 ctx 中的租户，未设置时为默认租户
+func From(ctx context.Context) string {
+	t, _ := ctx.Value(ctxKey{}).(string)
+	return t
+}
@@ -0,0 +1,245 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BPE 字节级 BPE，词表为 tiktoken 格式：每行 "<base64 token> <rank>"
+type BPE struct {
+	name  string
+	ranks map[string]int
+}
+
+// LoadBPE 从 tiktoken 词表文件加载
+func LoadBPE(name, path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int, 200_000)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := bytes.Fields(sc.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: malformed line", path, line)
+		}
+		tok, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ranks[string(tok)] = rank
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", path)
+	}
+	return &BPE{name: name, ranks: ranks}, nil
+}
+
+func (b *BPE) Name() string { return b.name }
+
+func (b *BPE) Count(s string) int {
+	n := 0
+	for _, piece := range split(s) {
+		if _, ok := b.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(b.merge(piece))
+	}
+	return n
+}
+
+func (b *BPE) Encode(s string) []int {
+	var ids []int
+	for _, piece := range split(s) {
+		if r, ok := b.ranks[piece]; ok {
+			ids = append(ids, r)
+			continue
+		}
+		for _, part := range b.merge(piece) {
+			ids = append(ids, b.ranks[part])
+		}
+	}
+	return ids
+}
+
+// merge 反复合并 rank 最小的相邻字节对，直到无法合并
+func (b *BPE) merge(piece string) []string {
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, at := math.MaxInt, -1
+		for i := 0; i < len(parts)-1; i++ {
+			if r, ok := b.ranks[parts[i]+parts[i+1]]; ok && r < best {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		parts[at] += parts[at+1]
+		parts = append(parts[:at+1], parts[at+2:]...)
+	}
+	return parts
+}
+
+// split 预分词，手写实现 cl100k 的切分正则（RE2 不支持 \s+(?!\S) 这样的前瞻）：
+//
+//	'(?i:s|t|re|ve|m|ll|d) | [^\r\n\p{L}\p{N}]?\p{L}+ | \p{N}{1,3} |
+//	 ?[^\s\p{L}\p{N}]+[\r\n]* | \s*[\r\n]+ | \s+(?!\S) | \s+
+//
+// o200k 的正则在大小写切分上略有不同，这里共用，计数误差可以忽略
+func split(s string) []string {
+	var out []string
+	for i := 0; i < len(s); {
+		n := matchAt(s, i)
+		out = append(out, s[i:i+n])
+		i += n
+	}
+	return out
+}
+
+func matchAt(s string, i int) int {
+	r, size := utf8.DecodeRuneInString(s[i:])
+
+	// 英文缩写
+	if r == '\'' {
+		for _, suf := range []string{"ll", "re", "ve", "s", "t", "m", "d"} {
+			end := i + 1 + len(suf)
+			if end <= len(s) && equalFoldASCII(s[i+1:end], suf) {
+				return end - i
+			}
+		}
+	}
+
+	// 可选前导符号 + 字母串
+	if isLetter(r) {
+		return spanLetters(s, i+size) - i
+	}
+	if r != '\r' && r != '\n' && !isNumber(r) {
+		if next, nsz := decodeAt(s, i+size); isLetter(next) {
+			j := i + size + nsz
+			return spanLetters(s, j) - i
+		}
+	}
+
+	// 最多 3 位数字
+	if isNumber(r) {
+		j, k := i, 0
+		for k < 3 && j < len(s) {
+			c, csz := decodeAt(s, j)
+			if !isNumber(c) {
+				break
+			}
+			j += csz
+			k++
+		}
+		return j - i
+	}
+
+	// 可选空格 + 标点串 + 换行
+	j := i
+	if r == ' ' {
+		j += size
+	}
+	if c, _ := decodeAt(s, j); j < len(s) && isPunct(c) {
+		for j < len(s) {
+			c, csz := decodeAt(s, j)
+			if !isPunct(c) {
+				break
+			}
+			j += csz
+		}
+		for j < len(s) && (s[j] == '\r' || s[j] == '\n') {
+			j++
+		}
+		return j - i
+	}
+
+	// 空白串
+	end, lastNL, lastStart := i, -1, i
+	for end < len(s) {
+		c, csz := decodeAt(s, end)
+		if !unicode.IsSpace(c) {
+			break
+		}
+		if c == '\r' || c == '\n' {
+			lastNL = end + csz
+		}
+		lastStart = end
+		end += csz
+	}
+	switch {
+	case lastNL > 0: // \s*[\r\n]+
+		return lastNL - i
+	case end == len(s): // 末尾空白整体成段
+		return end - i
+	case lastStart > i: // \s+(?!\S)：留最后一个空白给下一个词
+		return lastStart - i
+	case end > i:
+		return end - i
+	}
+	return size // 兜底：单个字符
+}
+
+// spanLetters 返回从 j 起连续字母结束的位置
+func spanLetters(s string, j int) int {
+	for j < len(s) {
+		c, csz := decodeAt(s, j)
+		if !isLetter(c) {
+			break
+		}
+		j += csz
+	}
+	return j
+}
+
+func decodeAt(s string, i int) (rune, int) {
+	if i >= len(s) {
+		return utf8.RuneError, 0
+	}
+	return utf8.DecodeRuneInString(s[i:])
+}
+
+func isLetter(r rune) bool { return unicode.IsLetter(r) }
+
+func isNumber(r rune) bool { return unicode.IsNumber(r) }
+
+func isPunct(r rune) bool {
+	return r != utf8.RuneError && !unicode.IsSpace(r) && !isLetter(r) && !isNumber(r)
+}
+
+func equalFoldASCII(a, b string) bool {
+	for i := 0; i < len(a); i++ {
+		c := a[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != b[i] {
+			return false
+		}
+	}
+	return true
+}
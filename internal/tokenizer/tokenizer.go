@@ -0,0 +1,159 @@
+package tokenizer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gollm-mini/internal/types"
+)
+
+// Tokenizer 把文本切成 token；Count 用于计费、截断与指标
+type Tokenizer interface {
+	Name() string
+	Encode(s string) []int
+	Count(s string) int
+}
+
+const (
+	CL100K = "cl100k_base"
+	O200K  = "o200k_base"
+	Approx = "approx"
+)
+
+// 词表目录：<dir>/<encoding>.tiktoken，可用 GOLLM_TOKENIZER_DIR 覆盖
+const defaultDir = "tokenizers"
+
+var (
+	mu      sync.Mutex
+	loaded  = map[string]Tokenizer{}
+	dirPath = envOr("GOLLM_TOKENIZER_DIR", defaultDir)
+)
+
+// modelEncodings 按模型名前缀选择编码，先匹配最长前缀；
+// 本地模型（llama / qwen …）没有公开 BPE，用 cl100k 近似，误差远小于 runes/4
+var modelEncodings = map[string]string{
+	"gpt-4o":                 O200K,
+	"gpt-4.1":                O200K,
+	"gpt-4.5":                O200K,
+	"gpt-5":                  O200K,
+	"o1":                     O200K,
+	"o3":                     O200K,
+	"o4":                     O200K,
+	"chatgpt-4o":             O200K,
+	"gpt-4":                  CL100K,
+	"gpt-3.5":                CL100K,
+	"text-embedding-3":       CL100K,
+	"text-embedding-ada-002": CL100K,
+}
+
+// SetDir 修改词表目录并清空已加载的编码
+func SetDir(dir string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dirPath = dir
+	loaded = map[string]Tokenizer{}
+}
+
+// MapModel 为模型名前缀指定编码，如 MapModel("my-gpt", tokenizer.O200K)
+func MapModel(prefix, encoding string) {
+	mu.Lock()
+	defer mu.Unlock()
+	modelEncodings[prefix] = encoding
+}
+
+// ForModel 按模型名返回分词器；model 可带 provider 前缀（openai/gpt-4o）
+func ForModel(model string) Tokenizer {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	mu.Lock()
+	enc, best := CL100K, 0
+	for p, e := range modelEncodings {
+		if strings.HasPrefix(model, p) && len(p) > best {
+			enc, best = e, len(p)
+		}
+	}
+	mu.Unlock()
+	return Get(enc)
+}
+
+// Get 按编码名返回分词器；词表缺失时退化为 runes/4 估算并打印一次日志
+func Get(encoding string) Tokenizer {
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := loaded[encoding]; ok {
+		return t
+	}
+	var t Tokenizer = approx{}
+	if encoding != Approx {
+		path := filepath.Join(dirPath, encoding+".tiktoken")
+		bpe, err := LoadBPE(encoding, path)
+		if err != nil {
+			log.Printf("[TOKENIZER] %s unavailable (%v), falling back to approximation", encoding, err)
+		} else {
+			t = bpe
+		}
+	}
+	loaded[encoding] = t
+	return t
+}
+
+// Count 按模型计数的简写
+func Count(model, s string) int { return ForModel(model).Count(s) }
+
+// 与 OpenAI 计费口径一致：每条消息额外 3 token，name 再 +1，回复引导 3 token
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensReply      = 3
+)
+
+// CountMessage 单条消息的 token 数（含角色开销）
+func CountMessage(t Tokenizer, m types.Message) int {
+	n := tokensPerMessage + t.Count(m.Content)
+	if m.Name != "" {
+		n += tokensPerName + t.Count(m.Name)
+	}
+	for _, tc := range m.ToolCalls {
+		n += t.Count(tc.Name) + t.Count(tc.Arguments)
+	}
+	return n
+}
+
+// CountMessages 整个请求的 prompt token 数
+func CountMessages(t Tokenizer, msgs []types.Message) int {
+	if len(msgs) == 0 {
+		return 0
+	}
+	n := tokensReply
+	for _, m := range msgs {
+		n += CountMessage(t, m)
+	}
+	return n
+}
+
+// approx 没有词表时的兜底估算
+type approx struct{}
+
+func (approx) Name() string { return Approx }
+
+func (a approx) Encode(s string) []int { return make([]int, a.Count(s)) }
+
+func (approx) Count(s string) int {
+	n := utf8.RuneCountInString(s)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
+
+func envOr(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
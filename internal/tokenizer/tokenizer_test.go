@@ -0,0 +1,116 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gollm-mini/internal/types"
+)
+
+// writeVocab 把 token→rank 写成 tiktoken 格式的 <dir>/<name>.tiktoken
+func writeVocab(t *testing.T, dir, name string, ranks map[string]int) string {
+	t.Helper()
+	var sb strings.Builder
+	for tok, r := range ranks {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), r)
+	}
+	path := filepath.Join(dir, name+".tiktoken")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 预分词与 cl100k 正则的切分一致
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"Hello world", []string{"Hello", " world"}},
+		{"don't we'LL", []string{"don", "'t", " we", "'LL"}},
+		{"12345 67", []string{"123", "45", " ", "67"}},
+		{"x+=1;", []string{"x", "+=", "1", ";"}},
+		{"a   b", []string{"a", "  ", " b"}},
+		{"a \n\n b", []string{"a", " \n\n", " b"}},
+		{"end  ", []string{"end", "  "}},
+		{"你好，世界", []string{"你好", "，世界"}},
+		{"hi 😀😀!", []string{"hi", " 😀😀!"}},
+	}
+	for _, tc := range cases {
+		if got := split(tc.in); !slices.Equal(got, tc.want) {
+			t.Errorf("split(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+// 总是先合并 rank 最小的相邻对
+func TestMergeOrder(t *testing.T) {
+	dir := t.TempDir()
+	base := map[string]int{"a": 0, "b": 1, "c": 2}
+	for _, tc := range []struct {
+		ab, bc int
+		want   []int
+	}{
+		{ab: 4, bc: 3, want: []int{0, 3}}, // b+c 先合并，a 无法再与 bc 合并
+		{ab: 3, bc: 4, want: []int{3, 2}},
+	} {
+		ranks := map[string]int{"ab": tc.ab, "bc": tc.bc}
+		for k, v := range base {
+			ranks[k] = v
+		}
+		bpe, err := LoadBPE("tiny", writeVocab(t, dir, "tiny", ranks))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bpe.Encode("abc"); !slices.Equal(got, tc.want) {
+			t.Errorf("ab=%d bc=%d: Encode(abc) = %v, want %v", tc.ab, tc.bc, got, tc.want)
+		}
+		if n := bpe.Count("abc"); n != len(tc.want) {
+			t.Errorf("Count(abc) = %d, want %d", n, len(tc.want))
+		}
+	}
+}
+
+// 每条消息 3 token、name 1 token、回复引导 3 token，工具调用计入名称与参数
+func TestCountMessages(t *testing.T) {
+	tk := approx{}
+	msgs := []types.Message{
+		{Role: types.RoleUser, Content: "abcd"},
+		{Role: types.RoleAssistant, Content: "abcdefgh", Name: "bob"},
+		{Role: types.RoleAssistant, ToolCalls: []types.ToolCall{{Name: "now", Arguments: "{}"}}},
+	}
+	// 3 + (3+1) + (3+2+1+1) + (3+0+1+1)
+	if n := CountMessages(tk, msgs); n != 19 {
+		t.Errorf("CountMessages = %d, want 19", n)
+	}
+	if n := CountMessages(tk, nil); n != 0 {
+		t.Errorf("empty = %d, want 0", n)
+	}
+}
+
+// 词表文件缺失时按 runes/4 估算，存在时使用 BPE
+func TestFallbackWithoutVocab(t *testing.T) {
+	dir := t.TempDir()
+	SetDir(dir)
+	defer SetDir(defaultDir)
+
+	tk := ForModel("openai/gpt-4o")
+	if tk.Name() != Approx {
+		t.Fatalf("name %q, want %s", tk.Name(), Approx)
+	}
+	if n := tk.Count("你好世界hello"); n != 3 {
+		t.Errorf("approx count %d, want 3", n)
+	}
+
+	writeVocab(t, dir, CL100K, map[string]int{"h": 0, "i": 1, "hi": 2})
+	SetDir(dir)
+	if tk := Get(CL100K); tk.Name() != CL100K || tk.Count("hi") != 1 {
+		t.Errorf("with vocab: %s counts %d", tk.Name(), tk.Count("hi"))
+	}
+}
@@ -0,0 +1,37 @@
+package types
+
+// ChatRequest /chat 的请求体，也用于 /jobs、批处理行与 WebSocket；CLI 的 -remote 模式直接发送
+type ChatRequest struct {
+	Messages  []Message         `json:"messages"`
+	Tpl       string            `json:"tpl"`
+	Vars      map[string]string `json:"vars"`
+	System    string            `json:"system"`
+	Provider  string            `json:"provider"` // 空为服务端默认 Provider
+	Model     string            `json:"model"`
+	Schema    string            `json:"schema"`
+	Stream    bool              `json:"stream,omitempty"`
+	SessionID string            `json:"session_id"` // 新增：对话记忆
+	Cache     string            `json:"cache"`      // off / read-write / read-only / refresh
+	Tools     []string          `json:"tools"`      // 启用的工具名，见 core.RegisterTool
+
+	Fallback   string   `json:"fallback"`    // 如 "openai:gpt-4o-mini -> hf"
+	FallbackOn []string `json:"fallback_on"` // conn_refused / 5xx / timeout / context_length，空为全部
+
+	Context    string `json:"context"`    // 上下文裁剪策略：tail / keep-system / pin-first:N / summary
+	Summarizer string `json:"summarizer"` // summary 策略的 "provider:model"，空为当前模型
+
+	// 流式输出被客户端中断时，仍把已生成的部分作为 assistant 回复写入会话
+	SavePartial bool `json:"save_partial,omitempty"`
+
+	GenerateOptions // temperature / max_tokens / top_p / stop / seed
+}
+
+// ChatResponse /chat 的非流式响应
+type ChatResponse struct {
+	Text     string      `json:"text,omitempty"`
+	JSON     interface{} `json:"json,omitempty"`
+	Steps    []Message   `json:"steps,omitempty"` // 工具调用过程
+	Usage    Usage       `json:"usage"`
+	ServedBy string      `json:"served_by,omitempty"` // 实际完成请求的 provider:model
+	ErrMsg   string      `json:"error,omitempty"`
+}
@@ -0,0 +1,30 @@
+package types
+
+// GenerateOptions 与具体 Provider 无关的生成参数；nil / 零值表示沿用模型默认
+type GenerateOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// Merge 以 o 为准，o 未设置的字段回落到 def（如模板默认值）
+func (o GenerateOptions) Merge(def GenerateOptions) GenerateOptions {
+	if o.Temperature == nil {
+		o.Temperature = def.Temperature
+	}
+	if o.MaxTokens == 0 {
+		o.MaxTokens = def.MaxTokens
+	}
+	if o.TopP == nil {
+		o.TopP = def.TopP
+	}
+	if len(o.Stop) == 0 {
+		o.Stop = def.Stop
+	}
+	if o.Seed == nil {
+		o.Seed = def.Seed
+	}
+	return o
+}
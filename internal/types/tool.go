@@ -0,0 +1,17 @@
+package types
+
+import "encoding/json"
+
+// Tool 提供给模型的函数定义；Parameters 为 JSON Schema（object）
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall 模型发起的一次函数调用；Arguments 为 JSON 字符串
+type ToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
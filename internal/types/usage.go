@@ -3,6 +3,11 @@ package types
 type Usage struct {
 	PromptTokens     int
 	CompletionTokens int
+	TrimmedTokens    int // 超出上下文窗口被裁掉的 token，不计入 Total
+
+	// ServedBy 实际完成本次调用的 "provider:model"（fallback 后可能不是主实例）；
+	// 随结果返回而不存放在 LLM 上，同一实例可被多个 goroutine 共用
+	ServedBy string `json:"-"`
 }
 
 func (u Usage) Total() int {
@@ -0,0 +1,103 @@
+package window
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"gollm-mini/internal/tokenizer"
+	"gollm-mini/internal/types"
+)
+
+// Summarizer 把被丢弃的消息压缩成摘要；previous 为此前已有的摘要，可为空
+type Summarizer func(ctx context.Context, previous string, dropped []types.Message) (string, error)
+
+// SummaryPrefix 摘要消息的固定开头，便于识别
+const SummaryPrefix = "Summary of the earlier conversation:\n"
+
+// 摘要最多占预算的比例
+const summaryShare = 5 // 1/5
+
+const maxSummaries = 256
+
+// 丢弃前缀哈希 → 摘要；进程内共享，服务端每个请求新建 LLM 也能复用
+var (
+	mu        sync.Mutex
+	summaries = map[string]string{}
+)
+
+// Summary 先按 Base 裁剪，再把丢弃部分压缩成一条 system 摘要插在开头的 system 消息之后。
+// 摘要按丢弃前缀缓存，后续请求只需把新丢弃的轮次并入已有摘要
+type Summary struct {
+	Base      KeepSystem
+	Summarize Summarizer
+}
+
+func NewSummary(base KeepSystem, s Summarizer) *Summary {
+	return &Summary{Base: base, Summarize: s}
+}
+
+func (s *Summary) Name() string { return "summary:" + s.Base.Name() }
+
+func (s *Summary) Apply(ctx context.Context, msgs []types.Message, budget int, tk tokenizer.Tokenizer) (Result, error) {
+	r, err := s.Base.Apply(ctx, msgs, budget-budget/summaryShare, tk)
+	if err != nil || len(r.Dropped) == 0 {
+		return r, err
+	}
+
+	// 找到已摘要过的最长丢弃前缀
+	hashes := prefixHashes(r.Dropped)
+	mu.Lock()
+	from, prev := 0, ""
+	for i := len(hashes) - 1; i >= 0; i-- {
+		if v, ok := summaries[hashes[i]]; ok {
+			from, prev = i+1, v
+			break
+		}
+	}
+	mu.Unlock()
+
+	text := prev
+	if from < len(r.Dropped) {
+		text, err = s.Summarize(ctx, prev, r.Dropped[from:])
+		if err != nil {
+			// 摘要失败不影响本次请求，退化为直接丢弃
+			log.Printf("[CONTEXT] summary failed, dropping %d messages: %v", len(r.Dropped), err)
+			return r, nil
+		}
+		mu.Lock()
+		if len(summaries) >= maxSummaries {
+			summaries = map[string]string{}
+		}
+		summaries[hashes[len(hashes)-1]] = text
+		mu.Unlock()
+	}
+
+	// 插在开头连续的 system 消息之后
+	at := 0
+	for at < len(r.Messages) && r.Messages[at].Role == types.RoleSystem {
+		at++
+	}
+	out := make([]types.Message, 0, len(r.Messages)+1)
+	out = append(out, r.Messages[:at]...)
+	out = append(out, types.Message{Role: types.RoleSystem, Content: SummaryPrefix + text})
+	out = append(out, r.Messages[at:]...)
+	r.Messages = out
+	return r, nil
+}
+
+// prefixHashes 第 i 项为 msgs[:i+1] 的哈希
+func prefixHashes(msgs []types.Message) []string {
+	out := make([]string, len(msgs))
+	var prev []byte
+	for i, m := range msgs {
+		b, _ := json.Marshal(m)
+		sum := sha256.Sum256(append(prev, b...))
+		prev = sum[:]
+		out[i] = hex.EncodeToString(prev)
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package window
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gollm-mini/internal/tokenizer"
+	"gollm-mini/internal/types"
+)
+
+// Strategy 把消息裁剪到 budget 个 token 以内
+type Strategy interface {
+	Name() string
+	Apply(ctx context.Context, msgs []types.Message, budget int, tk tokenizer.Tokenizer) (Result, error)
+}
+
+// Result 裁剪结果；Trimmed 为被丢弃消息的 token 数
+type Result struct {
+	Messages []types.Message
+	Dropped  []types.Message
+	Trimmed  int
+}
+
+// Default 未指定策略时使用：保留 system 与最近一轮用户输入
+var Default Strategy = KeepSystem{}
+
+// Parse 解析策略描述：
+//
+//	tail | keep-system | pin-first:N | summary | summary:pin-first:N
+//
+// summary 需要 summarizer，为 nil 时报错
+func Parse(spec string, summarizer Summarizer) (Strategy, error) {
+	spec = strings.TrimSpace(spec)
+	name, arg, _ := strings.Cut(spec, ":")
+	switch name {
+	case "":
+		return Default, nil
+	case "tail":
+		return Tail{}, nil
+	case "keep-system":
+		return KeepSystem{}, nil
+	case "pin-first":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid context strategy %q: want pin-first:N", spec)
+		}
+		return KeepSystem{PinFirst: n}, nil
+	case "summary":
+		if summarizer == nil {
+			return nil, fmt.Errorf("context strategy %q needs a summarizer", spec)
+		}
+		base := KeepSystem{}
+		if arg != "" {
+			b, err := Parse(arg, nil)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := b.(KeepSystem)
+			if !ok {
+				return nil, fmt.Errorf("invalid context strategy %q: summary base must be keep-system or pin-first:N", spec)
+			}
+			base = ks
+		}
+		return NewSummary(base, summarizer), nil
+	}
+	return nil, fmt.Errorf("unknown context strategy %q", spec)
+}
+
+// Tail 旧行为：只保留尾部
+type Tail struct{}
+
+func (Tail) Name() string { return "tail" }
+
+func (Tail) Apply(_ context.Context, msgs []types.Message, budget int, tk tokenizer.Tokenizer) (Result, error) {
+	var total int
+	// 从后往前累加
+	for i := len(msgs) - 1; i >= 0; i-- {
+		total += tokenizer.CountMessage(tk, msgs[i])
+		if total > budget {
+			cut := i + 1
+			for cut < len(msgs) && msgs[cut].Role == types.RoleTool {
+				cut++ // 不以孤立的工具结果开头
+			}
+			return result(msgs[cut:], msgs[:cut], tk), nil
+		}
+	}
+	return Result{Messages: msgs}, nil
+}
+
+// KeepSystem 始终保留全部 system 消息、前 PinFirst 条非 system 消息
+// 以及最后一条 user 及其之后的消息，其余按时间从新到旧填满预算
+type KeepSystem struct {
+	PinFirst int
+}
+
+func (k KeepSystem) Name() string {
+	if k.PinFirst > 0 {
+		return fmt.Sprintf("pin-first:%d", k.PinFirst)
+	}
+	return "keep-system"
+}
+
+func (k KeepSystem) Apply(_ context.Context, msgs []types.Message, budget int, tk tokenizer.Tokenizer) (Result, error) {
+	cost := make([]int, len(msgs))
+	total := 0
+	for i, m := range msgs {
+		cost[i] = tokenizer.CountMessage(tk, m)
+		total += cost[i]
+	}
+	if total <= budget {
+		return Result{Messages: msgs}, nil
+	}
+
+	keep := make([]bool, len(msgs))
+	used := 0
+	pin := func(i int) {
+		if !keep[i] {
+			keep[i] = true
+			used += cost[i]
+		}
+	}
+
+	// 最近一轮：最后一条 user 起到结尾（含其后的工具消息）
+	last := len(msgs)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == types.RoleUser {
+			last = i
+			break
+		}
+	}
+	for i := last; i < len(msgs); i++ {
+		pin(i)
+	}
+	pinned := 0
+	for i, m := range msgs {
+		switch {
+		case m.Role == types.RoleSystem:
+			pin(i)
+		case pinned < k.PinFirst:
+			pin(i)
+			pinned++
+		}
+	}
+
+	// 从新到旧连续填充，遇到放不下的即停止，避免对话出现空洞
+	first := last
+	for i := last - 1; i >= 0; i-- {
+		if keep[i] {
+			continue
+		}
+		if used+cost[i] > budget {
+			break
+		}
+		pin(i)
+		first = i
+	}
+	// 对应的 tool_calls 已被裁掉的工具结果也一并丢弃
+	for ; first < last && msgs[first].Role == types.RoleTool; first++ {
+		if keep[first] {
+			keep[first] = false
+			used -= cost[first]
+		}
+	}
+
+	var kept, dropped []types.Message
+	for i, m := range msgs {
+		if keep[i] {
+			kept = append(kept, m)
+		} else {
+			dropped = append(dropped, m)
+		}
+	}
+	return result(kept, dropped, tk), nil
+}
+
+func result(kept, dropped []types.Message, tk tokenizer.Tokenizer) Result {
+	r := Result{Messages: kept, Dropped: dropped}
+	for _, m := range dropped {
+		r.Trimmed += tokenizer.CountMessage(tk, m)
+	}
+	return r
+}
@@ -0,0 +1,148 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"gollm-mini/internal/types"
+)
+
+// chars 每个字节一个 token，每条消息的开销即 3 + len(content)；
+// 下面的消息内容都是 7 个字节，每条 10 token
+type chars struct{}
+
+func (chars) Name() string          { return "chars" }
+func (chars) Encode(s string) []int { return make([]int, len(s)) }
+func (chars) Count(s string) int    { return len(s) }
+
+func msg(role types.Role, s string) types.Message { return types.Message{Role: role, Content: s} }
+
+func contents(msgs []types.Message) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Content
+	}
+	return out
+}
+
+// 超出预算时所有 system 消息都保留，即使预算连它们都放不下
+func TestKeepSystemKeepsAllSystem(t *testing.T) {
+	msgs := []types.Message{
+		msg(types.RoleSystem, "system1"), msg(types.RoleUser, "user--1"), msg(types.RoleAssistant, "reply-1"),
+		msg(types.RoleSystem, "system2"), msg(types.RoleUser, "user--2"), msg(types.RoleAssistant, "reply-2"),
+		msg(types.RoleUser, "user--3"),
+	}
+	for _, budget := range []int{0, 35} {
+		r, err := KeepSystem{}.Apply(context.Background(), msgs, budget, chars{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(r.Messages); !slices.Equal(got, []string{"system1", "system2", "user--3"}) {
+			t.Errorf("budget %d: kept %q", budget, got)
+		}
+		if len(r.Dropped) != 4 || r.Trimmed != 40 {
+			t.Errorf("budget %d: dropped %d, trimmed %d", budget, len(r.Dropped), r.Trimmed)
+		}
+	}
+}
+
+// pin-first 固定开头的用户输入，其余从新到旧填满预算
+func TestPinFirst(t *testing.T) {
+	msgs := []types.Message{
+		msg(types.RoleSystem, "system1"), msg(types.RoleUser, "user--1"), msg(types.RoleAssistant, "reply-1"),
+		msg(types.RoleUser, "user--2"), msg(types.RoleAssistant, "reply-2"), msg(types.RoleUser, "user--3"),
+	}
+	r, err := KeepSystem{PinFirst: 1}.Apply(context.Background(), msgs, 40, chars{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(r.Messages); !slices.Equal(got, []string{"system1", "user--1", "reply-2", "user--3"}) {
+		t.Errorf("kept %q", got)
+	}
+}
+
+// 无论预算多少，裁剪后都不会出现缺少 tool_calls 的工具结果
+func TestToolResultsKeepTheirCall(t *testing.T) {
+	call := types.Message{Role: types.RoleAssistant, ToolCalls: []types.ToolCall{{ID: "1", Name: "f", Arguments: "{}"}, {ID: "2", Name: "g", Arguments: "{}"}}}
+	msgs := []types.Message{
+		msg(types.RoleUser, "user--1"), call, msg(types.RoleTool, "result1"), msg(types.RoleTool, "result2"),
+		msg(types.RoleAssistant, "reply-1"), msg(types.RoleUser, "user--2"),
+	}
+	for _, s := range []Strategy{Tail{}, KeepSystem{}} {
+		for budget := 0; budget <= 60; budget++ {
+			r, err := s.Apply(context.Background(), msgs, budget, chars{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, m := range r.Messages {
+				if m.Role != types.RoleTool {
+					continue
+				}
+				if i == 0 || (r.Messages[i-1].Role != types.RoleTool && len(r.Messages[i-1].ToolCalls) == 0) {
+					t.Errorf("%s, budget %d: orphan tool result in %q", s.Name(), budget, contents(r.Messages))
+					break
+				}
+			}
+		}
+	}
+}
+
+// 相同的丢弃前缀复用缓存的摘要；新丢弃的轮次并入已有摘要
+func TestSummaryReusesCache(t *testing.T) {
+	var calls [][]string
+	summarize := func(_ context.Context, prev string, dropped []types.Message) (string, error) {
+		calls = append(calls, append([]string{prev}, contents(dropped)...))
+		return "gist" + string(rune('0'+len(calls))), nil
+	}
+	s := NewSummary(KeepSystem{}, summarize)
+	msgs := []types.Message{
+		msg(types.RoleSystem, "cache-s"), msg(types.RoleUser, "cache-1"), msg(types.RoleAssistant, "cache-2"),
+		msg(types.RoleUser, "cache-3"), msg(types.RoleAssistant, "cache-4"), msg(types.RoleUser, "cache-5"),
+	}
+	want := []string{"cache-s", SummaryPrefix + "gist1", "cache-5"}
+	for i := 0; i < 2; i++ {
+		r, err := s.Apply(context.Background(), msgs, 25, chars{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(r.Messages); !slices.Equal(got, want) {
+			t.Errorf("apply %d: %q", i, got)
+		}
+	}
+	if len(calls) != 1 {
+		t.Fatalf("summarizer called %d times, want 1", len(calls))
+	}
+
+	msgs = append(msgs, msg(types.RoleAssistant, "cache-6"), msg(types.RoleUser, "cache-7"))
+	r, err := s.Apply(context.Background(), msgs, 25, chars{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(r.Messages); !slices.Equal(got, []string{"cache-s", SummaryPrefix + "gist2", "cache-7"}) {
+		t.Errorf("after new turn %q", got)
+	}
+	if len(calls) != 2 || !slices.Equal(calls[1], []string{"gist1", "cache-5", "cache-6"}) {
+		t.Errorf("calls %q, want only the new messages folded into gist1", calls)
+	}
+}
+
+// 摘要失败时退化为 Base 的裁剪结果
+func TestSummaryFailureFallsBack(t *testing.T) {
+	failing := func(context.Context, string, []types.Message) (string, error) { return "", errors.New("down") }
+	msgs := []types.Message{
+		msg(types.RoleSystem, "fail-sy"), msg(types.RoleUser, "fail--1"), msg(types.RoleAssistant, "fail--2"),
+		msg(types.RoleUser, "fail--3"),
+	}
+	r, err := NewSummary(KeepSystem{}, failing).Apply(context.Background(), msgs, 25, chars{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(r.Messages); !slices.Equal(got, []string{"fail-sy", "fail--3"}) {
+		t.Errorf("kept %q", got)
+	}
+	if len(r.Dropped) != 2 || r.Trimmed != 20 {
+		t.Errorf("dropped %d, trimmed %d", len(r.Dropped), r.Trimmed)
+	}
+}